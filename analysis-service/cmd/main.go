@@ -5,8 +5,6 @@ import (
 	"log"
 	"net/http"
 	"os"
-	"os/signal"
-	"syscall"
 	"time"
 
 	"github.com/KEPTANy/plag-check/analysis-service/internal/config"
@@ -15,38 +13,108 @@ import (
 	"github.com/KEPTANy/plag-check/analysis-service/internal/repository"
 	"github.com/KEPTANy/plag-check/analysis-service/internal/service"
 	"github.com/KEPTANy/plag-check/analysis-service/internal/storage"
+	"github.com/KEPTANy/plag-check/analysis-service/internal/webhook"
+	"github.com/KEPTANy/plag-check/analysis-service/migrations"
+	"github.com/KEPTANy/plag-check/shared/audit"
+	auditMigrations "github.com/KEPTANy/plag-check/shared/audit/migrations"
+	"github.com/KEPTANy/plag-check/shared/bootstrap"
+	"github.com/KEPTANy/plag-check/shared/events"
+	eventsMigrations "github.com/KEPTANy/plag-check/shared/events/migrations"
+	"github.com/KEPTANy/plag-check/shared/health"
+	"github.com/KEPTANy/plag-check/shared/logging"
 	"github.com/KEPTANy/plag-check/shared/middleware"
+	"github.com/KEPTANy/plag-check/shared/migrate"
+	"github.com/KEPTANy/plag-check/shared/tracing"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 func main() {
+	logging.Setup("analysis-service")
+
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := bootstrap.MigrateCommand("analysis-service", migrations.FS, os.Args[2:]); err != nil {
+			log.Fatalf("Failed to migrate: %v", err)
+		}
+		return
+	}
+
+	shutdownTracing, err := tracing.Setup(context.Background(), "analysis-service")
+	if err != nil {
+		log.Fatalf("Failed to set up tracing: %v", err)
+	}
+
 	var cfg config.Config
-	err := cfg.Load()
+	err = cfg.Load()
 	if err != nil {
 		log.Fatalf("Failed to load config: %v", err)
 	}
 
-	db, err := repository.NewPgRepository(cfg.DatabaseURL)
+	app := bootstrap.New(cfg.Lifecycle)
+	app.OnShutdown(shutdownTracing)
+
+	db, err := repository.NewPgRepository(context.Background(), cfg.Database)
 	if err != nil {
 		log.Fatalf("Failed to connect to db: %v", err)
 	}
-	defer db.Close()
+	app.OnShutdown(func(context.Context) error {
+		db.Close()
+		return nil
+	})
+
+	if err := migrate.Up(context.Background(), db.GetPool(), "analysis-service", migrations.FS); err != nil {
+		log.Fatalf("Failed to run migrations: %v", err)
+	}
+	if err := migrate.Up(context.Background(), db.GetPool(), "audit", auditMigrations.FS); err != nil {
+		log.Fatalf("Failed to run audit log migrations: %v", err)
+	}
+	auditLog := audit.New(db.GetPool(), "analysis-service")
+	if err := migrate.Up(context.Background(), db.GetPool(), "events", eventsMigrations.FS); err != nil {
+		log.Fatalf("Failed to run event outbox migrations: %v", err)
+	}
+	publisher := events.NewPublisher(db.GetPool(), "analysis-service")
 
 	fileRepo := repository.NewFileRepository(db)
+	matchRepo := repository.NewMatchRepository(db)
 	fileStorage, err := storage.NewStorage(cfg.StorageRoot)
 	if err != nil {
 		log.Fatalf("Failed to init storage: %v", err)
 	}
-	analysisService := service.NewAnalysisService(fileRepo, fileStorage)
-
-	healthHandler := handler.NewHealthHandler()
-	analysisHandler := handler.NewAnalysisHandler(analysisService)
+	analysisService := service.NewAnalysisService(fileRepo, matchRepo, fileStorage, db, publisher)
+	webhookRepo := repository.NewWebhookRepository(db)
+	webhookService := service.NewWebhookService(webhookRepo)
+
+	consumer := events.NewConsumer(db.GetPool(), "analysis-service")
+	consumer.Handle(events.TopicFileUploaded, analysisService.HandleFileUploaded)
+	consumer.Handle(events.TopicAnalysisCompleted, webhookService.HandleAnalysisCompleted)
+	if err := consumer.Subscribe(context.Background()); err != nil {
+		log.Fatalf("Failed to subscribe to events: %v", err)
+	}
+	app.Go("events", consumer.Run)
+
+	webhookGuard := webhook.NewGuard(cfg.WebhookAllowedNetworks)
+	dispatcher := webhook.NewDispatcher(webhookRepo, cfg.WebhookTimeout, webhookGuard)
+	dispatcher.MaxAttempts = cfg.WebhookMaxAttempts
+	dispatcher.RetryDelay = cfg.WebhookRetryDelay
+	app.Go("webhooks", dispatcher.Run)
+
+	healthHandler := health.NewHandler(map[string]health.Check{
+		"serving":  app.CheckReady,
+		"postgres": db.GetPool().Ping,
+		"storage":  fileStorage.CheckReadable,
+		// the files table belongs to file-storage-service
+		"schema": func(ctx context.Context) error {
+			return migrate.Require(ctx, db.GetPool(), "file-storage-service", 1)
+		},
+	})
+	analysisHandler := handler.NewAnalysisHandler(analysisService, auditLog)
+	webhookHandler := handler.NewWebhookHandler(webhookService, auditLog, webhookGuard)
 
 	mux := http.NewServeMux()
 
-	mux.Handle("GET /health", http.HandlerFunc(healthHandler.Health))
+	mux.Handle("GET /health", healthHandler)
 
 	baseChain := middleware.Chain(
-		intMiddleware.AuthMiddleware(cfg.JWTSecret),
+		intMiddleware.AuthMiddleware(cfg.JWTSecret, cfg.IdentitySecret),
 	)
 
 	teacherChain := middleware.Chain(
@@ -58,10 +126,20 @@ func main() {
 
 	mux.Handle("GET /analysis/wordcloud/{id}", teacherChain(http.HandlerFunc(analysisHandler.GetWordCloud)))
 
+	mux.Handle("POST /analysis/webhooks", teacherChain(http.HandlerFunc(webhookHandler.Create)))
+	mux.Handle("GET /analysis/webhooks", teacherChain(http.HandlerFunc(webhookHandler.List)))
+	mux.Handle("DELETE /analysis/webhooks/{id}", teacherChain(http.HandlerFunc(webhookHandler.Delete)))
+	mux.Handle("GET /analysis/webhooks/{id}/deliveries", teacherChain(http.HandlerFunc(webhookHandler.Deliveries)))
+	mux.Handle("POST /analysis/webhooks/{id}/ping", teacherChain(http.HandlerFunc(webhookHandler.Ping)))
+
 	handler := middleware.Chain(
+		middleware.RequestIDMiddleware,
+		middleware.ClientIP(cfg.TrustedProxies),
+		middleware.TracingMiddleware,
 		middleware.RecoveringMiddleware,
 		middleware.LoggingMiddleware,
-	)(mux)
+		middleware.MetricsMiddleware,
+	)(middleware.PatternMiddleware(mux))
 
 	server := &http.Server{
 		Addr:         ":" + cfg.Port,
@@ -71,24 +149,24 @@ func main() {
 		IdleTimeout:  60 * time.Second,
 	}
 
-	go func() {
-		log.Printf("Analysis service starting on port: %v", cfg.Port)
-		if err := server.ListenAndServe(); err != nil {
-			log.Fatalf("Failed to start server: %v", err)
-		}
-	}()
-
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
-	log.Println("Shutting down server...")
+	adminMux := http.NewServeMux()
+	adminMux.Handle("GET /metrics", promhttp.Handler())
+
+	adminServer := &http.Server{
+		Addr: ":" + cfg.AdminPort,
+		Handler: middleware.Chain(
+			middleware.RequestIDMiddleware,
+			middleware.RecoveringMiddleware,
+			middleware.LoggingMiddleware,
+		)(adminMux),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+	app.Serve(server)
+	app.Serve(adminServer)
 
-	if err := server.Shutdown(ctx); err != nil {
-		log.Fatal("Server forced to shutdown:", err)
+	log.Printf("Analysis service starting on port: %v, admin API on port: %v", cfg.Port, cfg.AdminPort)
+	if err := app.Run(); err != nil {
+		log.Fatalf("Service stopped: %v", err)
 	}
-
-	log.Println("Server exited properly")
 }
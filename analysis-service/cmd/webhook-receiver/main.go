@@ -0,0 +1,68 @@
+// Command webhook-receiver is a stand-in for an LMS when trying out webhooks
+// locally. It verifies the signature of every delivery, prints it and answers
+// 204, or 500 for the first -fail requests to exercise retries:
+//
+//	go run ./cmd/webhook-receiver -secret whsec_... -fail 2
+//
+// Register http://host.docker.internal:9999/ as the webhook URL when the
+// services run in docker compose, with the address of the docker host in
+// WEBHOOK_ALLOWED_NETWORKS.
+package main
+
+import (
+	"flag"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/KEPTANy/plag-check/analysis-service/internal/webhook"
+)
+
+func main() {
+	addr := flag.String("addr", ":9999", "address to listen on")
+	secret := flag.String("secret", "", "secret of the webhook, signatures are not checked if empty")
+	fail := flag.Int64("fail", 0, "answer 500 to this many requests first")
+	tolerance := flag.Duration("tolerance", 5*time.Minute, "accepted clock difference of the timestamp")
+	flag.Parse()
+
+	var received atomic.Int64
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /", func(w http.ResponseWriter, r *http.Request) {
+		n := received.Add(1)
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "failed to read body", http.StatusBadRequest)
+			return
+		}
+
+		event := r.Header.Get(webhook.HeaderEvent)
+		delivery := r.Header.Get(webhook.HeaderDelivery)
+
+		if *secret != "" {
+			timestamp, err := strconv.ParseInt(r.Header.Get(webhook.HeaderTimestamp), 10, 64)
+			signature := r.Header.Get(webhook.HeaderSignature)
+			if err != nil || !webhook.Verify(*secret, timestamp, body, signature, *tolerance) {
+				log.Printf("#%d %s delivery %s: invalid signature", n, event, delivery)
+				http.Error(w, "invalid signature", http.StatusUnauthorized)
+				return
+			}
+		}
+
+		if n <= *fail {
+			log.Printf("#%d %s delivery %s: failing on purpose", n, event, delivery)
+			http.Error(w, "failing on purpose", http.StatusInternalServerError)
+			return
+		}
+
+		log.Printf("#%d %s delivery %s: %s", n, event, delivery, body)
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	log.Printf("Webhook receiver listening on %s", *addr)
+	log.Fatal(http.ListenAndServe(*addr, mux))
+}
@@ -1,70 +1,62 @@
 package config
 
 import (
-	"errors"
-	"fmt"
-	"os"
+	"net/netip"
+	"time"
+
+	"github.com/KEPTANy/plag-check/shared/bootstrap"
 )
 
 type Config struct {
 	Port        string
-	DatabaseURL string
+	AdminPort   string
+	Database    bootstrap.Database
+	Lifecycle   bootstrap.Lifecycle
 	StorageRoot string
 	JWTSecret   string
-}
-
-func getDatabaseURL() (string, error) {
-	host, ok := os.LookupEnv("DB_HOST")
-	if !ok {
-		return "", errors.New("Failed to load DB_HOST variable")
-	}
-
-	port, ok := os.LookupEnv("DB_PORT")
-	if !ok {
-		return "", errors.New("Failed to load DB_PORT variable")
-	}
-
-	user, ok := os.LookupEnv("DB_USER")
-	if !ok {
-		return "", errors.New("Failed to load DB_USER variable")
-	}
 
-	password, ok := os.LookupEnv("DB_PASSWORD")
-	if !ok {
-		return "", errors.New("Failed to load DB_PASSWORD variable")
-	}
-
-	name, ok := os.LookupEnv("DB_NAME")
-	if !ok {
-		return "", errors.New("Failed to load DB_NAME variable")
-	}
-
-	return fmt.Sprintf("postgresql://%s:%s@%s:%s/%s", user, password, host, port, name), nil
+	// IdentitySecret verifies the identity header signed by the gateway
+	IdentitySecret string
+
+	// WebhookTimeout bounds a single request to a webhook receiver
+	WebhookTimeout     time.Duration
+	WebhookMaxAttempts int
+	// WebhookRetryDelay is the delay after the first failed attempt, it
+	// doubles with every further one
+	WebhookRetryDelay time.Duration
+	// WebhookAllowedNetworks may receive webhooks although they are
+	// loopback or private, e.g. the docker host in development
+	WebhookAllowedNetworks []netip.Prefix
+
+	// TrustedProxies may set X-Forwarded-For, see middleware.ClientIP
+	TrustedProxies []netip.Prefix
 }
 
 func (c *Config) Load() error {
-	var ok bool
+	var env bootstrap.Env
+
+	c.Port = env.Required("PORT")
+	// metrics are not behind authentication and must not be published
+	c.AdminPort = env.String("ADMIN_PORT", "9093")
+	c.Database = bootstrap.LoadDatabase(&env)
+	c.Lifecycle = bootstrap.LoadLifecycle(&env)
+
+	// the gateway, whose X-Forwarded-For names the client
+	c.TrustedProxies = env.Networks("TRUSTED_PROXIES", nil)
 
-	c.Port, ok = os.LookupEnv("PORT")
-	if !ok {
-		return errors.New("Failed to load PORT variable")
-	}
+	c.StorageRoot = env.Required("STORAGE_ROOT")
 
-	var err error
-	c.DatabaseURL, err = getDatabaseURL()
-	if err != nil {
-		return err
-	}
+	c.JWTSecret = env.Required("JWT_SECRET")
+	c.IdentitySecret = env.String("INTERNAL_IDENTITY_SECRET", "")
 
-	c.StorageRoot, ok = os.LookupEnv("STORAGE_ROOT")
-	if !ok {
-		return errors.New("Failed to load STORAGE_ROOT variable")
-	}
+	c.WebhookTimeout = env.Duration("WEBHOOK_TIMEOUT", 10*time.Second)
+	env.Positive("WEBHOOK_TIMEOUT", int64(c.WebhookTimeout))
+	c.WebhookMaxAttempts = env.Int("WEBHOOK_MAX_ATTEMPTS", 8)
+	env.Positive("WEBHOOK_MAX_ATTEMPTS", int64(c.WebhookMaxAttempts))
+	c.WebhookRetryDelay = env.Duration("WEBHOOK_RETRY_DELAY", 30*time.Second)
+	env.Positive("WEBHOOK_RETRY_DELAY", int64(c.WebhookRetryDelay))
 
-	c.JWTSecret, ok = os.LookupEnv("JWT_SECRET")
-	if !ok {
-		return errors.New("Failed to load JWT_SECRET variable")
-	}
+	c.WebhookAllowedNetworks = env.Networks("WEBHOOK_ALLOWED_NETWORKS", nil)
 
-	return nil
+	return env.Err()
 }
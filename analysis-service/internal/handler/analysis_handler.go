@@ -1,84 +1,115 @@
 package handler
 
 import (
-	"log"
 	"net/http"
 	"strconv"
 
 	"github.com/KEPTANy/plag-check/analysis-service/internal/middleware"
 	"github.com/KEPTANy/plag-check/analysis-service/internal/service"
+	"github.com/KEPTANy/plag-check/shared/apperror"
+	"github.com/KEPTANy/plag-check/shared/audit"
 )
 
 type AnalysisHandler struct {
 	AnalysisService service.AnalysisService
+	Audit           *audit.Log
 }
 
-func NewAnalysisHandler(service service.AnalysisService) *AnalysisHandler {
-	return &AnalysisHandler{AnalysisService: service}
+func NewAnalysisHandler(service service.AnalysisService, auditLog *audit.Log) *AnalysisHandler {
+	return &AnalysisHandler{AnalysisService: service, Audit: auditLog}
 }
 
 func (h *AnalysisHandler) CheckPlagiarism(w http.ResponseWriter, r *http.Request) {
-	_, ok := middleware.GetUserIDFromContext(r.Context())
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
 	if !ok {
-		http.Error(w, `{"error": "unauthorized"}`, http.StatusUnauthorized)
+		apperror.Write(w, r, apperror.Unauthorized("unauthorized"))
 		return
 	}
 
 	role, ok := middleware.GetRoleFromContext(r.Context())
 	if !ok {
-		http.Error(w, `{"error": "unauthorized"}`, http.StatusUnauthorized)
+		apperror.Write(w, r, apperror.Unauthorized("unauthorized"))
 		return
 	}
 
 	if role != "teacher" {
-		http.Error(w, `{"error": "only teachers can check plagiarism"}`, http.StatusForbidden)
+		apperror.Write(w, r, apperror.Forbidden("only teachers can check plagiarism"))
 		return
 	}
 
 	results, err := h.AnalysisService.CheckPlagiarism(r.Context())
 	if err != nil {
-		log.Printf("Error checking plagiarism: %v", err)
-		http.Error(w, `{"error": "internal error"}`, http.StatusInternalServerError)
+		apperror.Write(w, r, err)
 		return
 	}
 
+	event := audit.Event{
+		ActorID:      userID,
+		ActorRole:    role,
+		Action:       audit.ActionPlagiarismCheck,
+		ResourceType: "plagiarism_report",
+		Outcome:      audit.OutcomeSuccess,
+		Details:      map[string]any{"groups": len(results)},
+	}
+
+	// results that cannot be recorded are not shown
+	if err := h.Audit.Record(r.Context(), event); err != nil {
+		apperror.Write(w, r, apperror.Internal(err))
+		return
+	}
+
+	// the gateway cache records the views it answers itself
+	audit.SetReplay(w.Header(), event)
 	writeJSON(w, http.StatusOK, map[string]any{
 		"plagiarism_results": results,
 	})
 }
 
 func (h *AnalysisHandler) GetWordCloud(w http.ResponseWriter, r *http.Request) {
-	_, ok := middleware.GetUserIDFromContext(r.Context())
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
 	if !ok {
-		http.Error(w, `{"error": "unauthorized"}`, http.StatusUnauthorized)
+		apperror.Write(w, r, apperror.Unauthorized("unauthorized"))
 		return
 	}
 
 	role, ok := middleware.GetRoleFromContext(r.Context())
 	if !ok {
-		http.Error(w, `{"error": "unauthorized"}`, http.StatusUnauthorized)
+		apperror.Write(w, r, apperror.Unauthorized("unauthorized"))
 		return
 	}
 
 	if role != "teacher" {
-		http.Error(w, `{"error": "only teachers can generate word clouds"}`, http.StatusForbidden)
+		apperror.Write(w, r, apperror.Forbidden("only teachers can generate word clouds"))
 		return
 	}
 
 	fileIDStr := r.PathValue("id")
 	fileID, err := strconv.Atoi(fileIDStr)
 	if err != nil {
-		http.Error(w, `{"error": "invalid file ID"}`, http.StatusBadRequest)
+		apperror.Write(w, r, apperror.Validation("invalid file ID"))
 		return
 	}
 
 	imageData, err := h.AnalysisService.GetWordCloud(r.Context(), fileID)
 	if err != nil {
-		log.Printf("Error generating word cloud: %v", err)
-		http.Error(w, `{"error": "failed to generate word cloud"}`, http.StatusInternalServerError)
+		apperror.Write(w, r, err)
+		return
+	}
+
+	event := audit.Event{
+		ActorID:      userID,
+		ActorRole:    role,
+		Action:       audit.ActionWordCloud,
+		ResourceType: "file",
+		ResourceID:   strconv.Itoa(fileID),
+		Outcome:      audit.OutcomeSuccess,
+	}
+	if err := h.Audit.Record(r.Context(), event); err != nil {
+		apperror.Write(w, r, apperror.Internal(err))
 		return
 	}
 
+	audit.SetReplay(w.Header(), event)
 	w.Header().Set("Content-Type", "image/png")
 	w.WriteHeader(http.StatusOK)
 	w.Write(imageData)
@@ -0,0 +1,264 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/KEPTANy/plag-check/analysis-service/internal/middleware"
+	"github.com/KEPTANy/plag-check/analysis-service/internal/model"
+	"github.com/KEPTANy/plag-check/analysis-service/internal/service"
+	"github.com/KEPTANy/plag-check/analysis-service/internal/webhook"
+	"github.com/KEPTANy/plag-check/shared/apperror"
+	"github.com/KEPTANy/plag-check/shared/audit"
+	"github.com/gofrs/uuid/v5"
+)
+
+const (
+	// maxCourseLength matches the course column of the webhooks table
+	maxCourseLength     = 100
+	maxWebhookURLLength = 2000
+
+	defaultDeliveryLimit = 50
+	maxDeliveryLimit     = 200
+)
+
+type WebhookHandler struct {
+	WebhookService service.WebhookService
+	Audit          *audit.Log
+	// Guard refuses receivers on the internal network
+	Guard *webhook.Guard
+}
+
+func NewWebhookHandler(service service.WebhookService, auditLog *audit.Log, guard *webhook.Guard) *WebhookHandler {
+	return &WebhookHandler{WebhookService: service, Audit: auditLog, Guard: guard}
+}
+
+// teacher returns the id of the teacher making the request, or writes the
+// error and returns false.
+func teacher(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		apperror.Write(w, r, apperror.Unauthorized("unauthorized"))
+		return uuid.Nil, false
+	}
+
+	role, ok := middleware.GetRoleFromContext(r.Context())
+	if !ok {
+		apperror.Write(w, r, apperror.Unauthorized("unauthorized"))
+		return uuid.Nil, false
+	}
+
+	if role != "teacher" {
+		apperror.Write(w, r, apperror.Forbidden("only teachers can manage webhooks"))
+		return uuid.Nil, false
+	}
+
+	return userID, true
+}
+
+func webhookID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		apperror.Write(w, r, apperror.Validation("invalid webhook ID"))
+		return 0, false
+	}
+
+	return id, true
+}
+
+func validateWebhookRequest(req *model.CreateWebhookRequest, guard *webhook.Guard) error {
+	req.Course = strings.TrimSpace(req.Course)
+	if req.Course == "" {
+		return apperror.Validation("course must not be empty")
+	}
+	if len(req.Course) > maxCourseLength {
+		return apperror.Validation("course must be at most 100 characters")
+	}
+
+	if len(req.URL) > maxWebhookURLLength {
+		return apperror.Validation("url must be at most 2000 characters")
+	}
+	target, err := url.Parse(req.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return apperror.Validation("url must be an absolute http or https URL")
+	}
+	if target.User != nil {
+		return apperror.Validation("url must not contain credentials")
+	}
+	// names are only resolved when sending, the dispatcher checks the
+	// address again then
+	host := target.Hostname()
+	if strings.EqualFold(host, "localhost") {
+		host = "127.0.0.1"
+	}
+	if addr, err := netip.ParseAddr(host); err == nil && !guard.Allows(addr) {
+		return apperror.Validation("url must not point to a loopback, private or link-local address")
+	}
+
+	if req.Threshold != nil && (*req.Threshold <= 0 || *req.Threshold > 1) {
+		return apperror.Validation("threshold must be greater than 0 and at most 1")
+	}
+
+	return nil
+}
+
+// Create registers a webhook, the response is the only time its secret is
+// shown.
+func (h *WebhookHandler) Create(w http.ResponseWriter, r *http.Request) {
+	teacherID, ok := teacher(w, r)
+	if !ok {
+		return
+	}
+
+	var req model.CreateWebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apperror.Write(w, r, apperror.Validation("invalid request body"))
+		return
+	}
+
+	if err := validateWebhookRequest(&req, h.Guard); err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	webhook, err := h.WebhookService.CreateWebhook(r.Context(), teacherID, &req)
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	h.Audit.Record(r.Context(), audit.Event{
+		ActorID:      teacherID,
+		ActorRole:    "teacher",
+		Action:       audit.ActionWebhookCreate,
+		ResourceType: "webhook",
+		ResourceID:   strconv.Itoa(webhook.ID),
+		Outcome:      audit.OutcomeSuccess,
+		Details:      map[string]any{"course": webhook.Course, "url": webhook.URL},
+	})
+
+	writeJSON(w, http.StatusCreated, map[string]any{
+		"webhook": webhook,
+	})
+}
+
+func (h *WebhookHandler) List(w http.ResponseWriter, r *http.Request) {
+	teacherID, ok := teacher(w, r)
+	if !ok {
+		return
+	}
+
+	webhooks, err := h.WebhookService.ListWebhooks(r.Context(), teacherID, r.URL.Query().Get("course"))
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"webhooks": webhooks,
+	})
+}
+
+func (h *WebhookHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	teacherID, ok := teacher(w, r)
+	if !ok {
+		return
+	}
+
+	id, ok := webhookID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.WebhookService.DeleteWebhook(r.Context(), teacherID, id); err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	h.Audit.Record(r.Context(), audit.Event{
+		ActorID:      teacherID,
+		ActorRole:    "teacher",
+		Action:       audit.ActionWebhookDelete,
+		ResourceType: "webhook",
+		ResourceID:   strconv.Itoa(id),
+		Outcome:      audit.OutcomeSuccess,
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Deliveries returns the delivery history of a webhook with every attempt,
+// newest first. next_before_id continues the listing and is absent on the
+// last page.
+func (h *WebhookHandler) Deliveries(w http.ResponseWriter, r *http.Request) {
+	teacherID, ok := teacher(w, r)
+	if !ok {
+		return
+	}
+
+	id, ok := webhookID(w, r)
+	if !ok {
+		return
+	}
+
+	q := r.URL.Query()
+	var beforeID int64
+	if value := q.Get("before_id"); value != "" {
+		var err error
+		if beforeID, err = strconv.ParseInt(value, 10, 64); err != nil || beforeID <= 0 {
+			apperror.Write(w, r, apperror.Validation("before_id must be a positive number"))
+			return
+		}
+	}
+
+	limit := defaultDeliveryLimit
+	if value := q.Get("limit"); value != "" {
+		var err error
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit <= 0 || limit > maxDeliveryLimit {
+			apperror.Write(w, r, apperror.Validation("limit must be in a range of 1 to 200"))
+			return
+		}
+	}
+
+	deliveries, err := h.WebhookService.ListDeliveries(r.Context(), teacherID, id, beforeID, limit)
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	resp := map[string]any{
+		"deliveries": deliveries,
+	}
+	if len(deliveries) == limit {
+		resp["next_before_id"] = deliveries[len(deliveries)-1].ID
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// Ping queues a webhook.ping delivery, its result shows up in the history.
+func (h *WebhookHandler) Ping(w http.ResponseWriter, r *http.Request) {
+	teacherID, ok := teacher(w, r)
+	if !ok {
+		return
+	}
+
+	id, ok := webhookID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.WebhookService.Ping(r.Context(), teacherID, id); err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, map[string]any{
+		"status": "queued",
+	})
+}
@@ -0,0 +1,38 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	PlagiarismGroups = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "plagiarism_groups_found",
+		Help: "Groups of identical files found by the last plagiarism check.",
+	})
+
+	PlagiarismChecks = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "plagiarism_checks_total",
+		Help: "Plagiarism checks run.",
+	})
+
+	UploadMatches = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "upload_matches_total",
+		Help: "Matches with earlier files of other students found for new uploads.",
+	})
+
+	// WebhookDeliveries counts attempts to send a webhook delivery, labelled
+	// ok, retry or failed when it was the last attempt
+	WebhookDeliveries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "webhook_delivery_attempts_total",
+		Help: "Attempts to send webhook deliveries.",
+	}, []string{"outcome"})
+
+	// RenderDuration covers the QuickChart request including reading the
+	// image, labelled ok or error
+	RenderDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "wordcloud_render_duration_seconds",
+		Help:    "Latency of word cloud rendering by QuickChart.",
+		Buckets: []float64{.1, .25, .5, 1, 2.5, 5, 10, 30},
+	}, []string{"outcome"})
+)
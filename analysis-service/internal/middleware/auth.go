@@ -5,7 +5,10 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/KEPTANy/plag-check/shared/apperror"
+	"github.com/KEPTANy/plag-check/shared/identity"
 	"github.com/KEPTANy/plag-check/shared/jwt"
+	sharedMiddleware "github.com/KEPTANy/plag-check/shared/middleware"
 	"github.com/gofrs/uuid/v5"
 )
 
@@ -17,7 +20,10 @@ const (
 	RoleKey     contextKey = "role"
 )
 
-func AuthMiddleware(jwtSecret string) func(http.Handler) http.Handler {
+// AuthMiddleware trusts the identity signed by the gateway when identitySecret
+// is configured and the header is present, and falls back to parsing the JWT
+// itself for direct calls.
+func AuthMiddleware(jwtSecret, identitySecret string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			if strings.HasPrefix(r.URL.Path, "/health") {
@@ -25,32 +31,48 @@ func AuthMiddleware(jwtSecret string) func(http.Handler) http.Handler {
 				return
 			}
 
-			authHeader := r.Header.Get("Authorization")
-			if authHeader == "" {
-				http.Error(w, `{"error": "authorization header required"}`, http.StatusUnauthorized)
-				return
-			}
-
-			parts := strings.Split(authHeader, " ")
-			if len(parts) != 2 || parts[0] != "Bearer" {
-				http.Error(w, `{"error": "invalid authorization header format"}`, http.StatusUnauthorized)
-				return
-			}
-
-			token := parts[1]
-
-			claims, err := jwt.GetTokenClaims(token, jwtSecret)
-			if err != nil {
-				http.Error(w, `{"error": "invalid or expired token"}`, http.StatusUnauthorized)
-				return
+			var userID uuid.UUID
+			var username, role string
+
+			if signed := r.Header.Get(identity.Header); signed != "" && identitySecret != "" {
+				id, err := identity.Verify(signed, identitySecret)
+				if err != nil {
+					apperror.Write(w, r, apperror.Unauthorized("invalid identity"))
+					return
+				}
+
+				userID, username, role = id.UserID, id.Username, id.Role
+			} else {
+				authHeader := r.Header.Get("Authorization")
+				if authHeader == "" {
+					apperror.Write(w, r, apperror.Unauthorized("authorization header required"))
+					return
+				}
+
+				parts := strings.Split(authHeader, " ")
+				if len(parts) != 2 || parts[0] != "Bearer" {
+					apperror.Write(w, r, apperror.Unauthorized("invalid authorization header format"))
+					return
+				}
+
+				token := parts[1]
+
+				claims, err := jwt.GetTokenClaims(token, jwtSecret)
+				if err != nil {
+					apperror.Write(w, r, apperror.Unauthorized("invalid or expired token"))
+					return
+				}
+
+				userID, username, role = claims.UserID, claims.Username, claims.Role
 			}
 
-			ctx := context.WithValue(r.Context(), UserIDKey, claims.UserID)
-			ctx = context.WithValue(ctx, UsernameKey, claims.Username)
-			ctx = context.WithValue(ctx, RoleKey, claims.Role)
+			ctx := context.WithValue(r.Context(), UserIDKey, userID)
+			ctx = context.WithValue(ctx, UsernameKey, username)
+			ctx = context.WithValue(ctx, RoleKey, role)
+			sharedMiddleware.SetRequestUser(ctx, userID.String())
 
-			r.Header.Set("X-User-ID", claims.UserID.String())
-			r.Header.Set("X-User-Role", claims.Role)
+			r.Header.Set("X-User-ID", userID.String())
+			r.Header.Set("X-User-Role", role)
 
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
@@ -62,7 +84,7 @@ func RequireRole(requiredRole string) func(http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			role, ok := r.Context().Value(RoleKey).(string)
 			if !ok || role != requiredRole {
-				http.Error(w, `{"error": "insufficient permissions"}`, http.StatusForbidden)
+				apperror.Write(w, r, apperror.Forbidden("insufficient permissions"))
 				return
 			}
 
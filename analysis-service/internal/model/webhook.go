@@ -0,0 +1,79 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+)
+
+const (
+	// WebhookEventSuspiciousPair is sent for every new pair of files of
+	// different students with a similarity at or above the threshold
+	WebhookEventSuspiciousPair = "plagiarism.suspicious_pair"
+	// WebhookEventPing is sent on request to check the receiver
+	WebhookEventPing = "webhook.ping"
+)
+
+const (
+	DeliveryStatusPending   = "pending"
+	DeliveryStatusDelivered = "delivered"
+	DeliveryStatusFailed    = "failed"
+)
+
+type Webhook struct {
+	ID        int       `json:"id"`
+	TeacherID uuid.UUID `json:"teacher_id"`
+	Course    string    `json:"course"`
+	URL       string    `json:"url"`
+	// Secret is only returned when the webhook is created
+	Secret    string    `json:"secret,omitempty"`
+	Threshold float64   `json:"threshold"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type CreateWebhookRequest struct {
+	Course string `json:"course"`
+	URL    string `json:"url"`
+	// Threshold is the minimal similarity of a reported pair, 1 if omitted
+	Threshold *float64 `json:"threshold"`
+}
+
+type WebhookDelivery struct {
+	ID            int64            `json:"id"`
+	WebhookID     int              `json:"webhook_id"`
+	Event         string           `json:"event"`
+	Payload       json.RawMessage  `json:"payload"`
+	Status        string           `json:"status"`
+	Attempts      int              `json:"attempts"`
+	NextAttemptAt *time.Time       `json:"next_attempt_at,omitempty"`
+	CreatedAt     time.Time        `json:"created_at"`
+	DeliveredAt   *time.Time       `json:"delivered_at,omitempty"`
+	History       []WebhookAttempt `json:"history"`
+}
+
+type WebhookAttempt struct {
+	AttemptedAt time.Time `json:"attempted_at"`
+	StatusCode  *int      `json:"status_code,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	DurationMS  int       `json:"duration_ms"`
+}
+
+// SuspiciousPair is the payload of plagiarism.suspicious_pair, FileID is the
+// new upload and MatchedFileID the earlier file.
+type SuspiciousPair struct {
+	Course           string    `json:"course"`
+	FileID           int       `json:"file_id"`
+	StudentID        uuid.UUID `json:"student_id"`
+	MatchedFileID    int       `json:"matched_file_id"`
+	MatchedStudentID uuid.UUID `json:"matched_student_id"`
+	Similarity       float64   `json:"similarity"`
+}
+
+// OutgoingDelivery is a delivery claimed for sending with the target of its
+// webhook.
+type OutgoingDelivery struct {
+	WebhookDelivery
+	URL    string
+	Secret string
+}
@@ -2,9 +2,13 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
 	"github.com/KEPTANy/plag-check/analysis-service/internal/model"
+	"github.com/KEPTANy/plag-check/shared/apperror"
+	"github.com/KEPTANy/plag-check/shared/dbtx"
+	"github.com/jackc/pgx/v5"
 )
 
 type FileRepository interface {
@@ -29,10 +33,13 @@ func (r *fileRepository) GetFileByID(ctx context.Context, id int) (*model.File,
 	`
 
 	var file model.File
-	err := r.db.pool.QueryRow(ctx, query, id).Scan(
+	err := dbtx.From(ctx, r.db.pool).QueryRow(ctx, query, id).Scan(
 		&file.ID, &file.StudentID, &file.FileHash, &file.FileSize, &file.StoragePath, &file.Filename,
 	)
 
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, apperror.NotFound("file not found").Wrap(err)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("Failed to get file info: %w", err)
 	}
@@ -48,7 +55,7 @@ func (r *fileRepository) GetFilesByHash(ctx context.Context, hash string) ([]mod
 		ORDER BY id ASC
 	`
 
-	rows, err := r.db.pool.Query(ctx, query, hash)
+	rows, err := dbtx.From(ctx, r.db.pool).Query(ctx, query, hash)
 	if err != nil {
 		return nil, fmt.Errorf("Failed to get files' info by hash: %w", err)
 	}
@@ -80,7 +87,7 @@ func (r *fileRepository) GetPlagiarismGroups(ctx context.Context) ([]model.Plagi
 		ORDER BY count DESC
 	`
 
-	rows, err := r.db.pool.Query(ctx, query)
+	rows, err := dbtx.From(ctx, r.db.pool).Query(ctx, query)
 	if err != nil {
 		return nil, fmt.Errorf("Failed to get plagiarism groups: %w", err)
 	}
@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/KEPTANy/plag-check/analysis-service/internal/model"
+	"github.com/KEPTANy/plag-check/shared/dbtx"
+	"github.com/gofrs/uuid/v5"
+)
+
+type MatchRepository interface {
+	// MarkAnalyzed records that a file was checked, false means it already
+	// was
+	MarkAnalyzed(ctx context.Context, fileID int) (bool, error)
+	FindMatches(ctx context.Context, fileID int, studentID uuid.UUID, hash string) ([]model.File, error)
+	AddMatches(ctx context.Context, fileID int, matches []model.File) error
+}
+
+type matchRepository struct {
+	db *PgRepository
+}
+
+func NewMatchRepository(db *PgRepository) MatchRepository {
+	return &matchRepository{db: db}
+}
+
+func (r *matchRepository) MarkAnalyzed(ctx context.Context, fileID int) (bool, error) {
+	query := `
+		INSERT INTO analysis_runs (file_id)
+		VALUES ($1)
+		ON CONFLICT DO NOTHING
+	`
+
+	tag, err := dbtx.From(ctx, r.db.pool).Exec(ctx, query, fileID)
+	if err != nil {
+		return false, fmt.Errorf("Failed to mark file as analyzed: %w", err)
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+// FindMatches returns the earlier files of other students with the same hash.
+func (r *matchRepository) FindMatches(ctx context.Context, fileID int, studentID uuid.UUID, hash string) ([]model.File, error) {
+	query := `
+		SELECT id, student_id, file_hash, file_size, storage_path, original_filename
+		FROM files
+		WHERE file_hash = $1 AND student_id <> $2 AND id < $3
+		ORDER BY id ASC
+	`
+
+	rows, err := dbtx.From(ctx, r.db.pool).Query(ctx, query, hash, studentID, fileID)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to find matching files: %w", err)
+	}
+	defer rows.Close()
+
+	var files []model.File
+	for rows.Next() {
+		var file model.File
+		err := rows.Scan(
+			&file.ID, &file.StudentID, &file.FileHash, &file.FileSize, &file.StoragePath, &file.Filename,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to scan file info: %w", err)
+		}
+
+		files = append(files, file)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("Failed to read matching files: %w", err)
+	}
+
+	return files, nil
+}
+
+func (r *matchRepository) AddMatches(ctx context.Context, fileID int, matches []model.File) error {
+	query := `
+		INSERT INTO file_matches (file_id, matched_file_id)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+	`
+
+	db := dbtx.From(ctx, r.db.pool)
+	for _, match := range matches {
+		if _, err := db.Exec(ctx, query, fileID, match.ID); err != nil {
+			return fmt.Errorf("Failed to save file match: %w", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,291 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/KEPTANy/plag-check/analysis-service/internal/model"
+	"github.com/KEPTANy/plag-check/shared/apperror"
+	"github.com/KEPTANy/plag-check/shared/dbtx"
+	"github.com/gofrs/uuid/v5"
+	"github.com/jackc/pgx/v5"
+)
+
+type WebhookRepository interface {
+	CreateWebhook(ctx context.Context, webhook *model.Webhook) error
+	GetWebhook(ctx context.Context, id int) (*model.Webhook, error)
+	// ListWebhooks returns the webhooks of a teacher, of one course unless
+	// course is empty
+	ListWebhooks(ctx context.Context, teacherID uuid.UUID, course string) ([]model.Webhook, error)
+	ListCourseWebhooks(ctx context.Context, course string) ([]model.Webhook, error)
+	DeleteWebhook(ctx context.Context, id int) error
+
+	// EnqueueDelivery stores a delivery unless the webhook already has one
+	// with dedupKey, false means it had
+	EnqueueDelivery(ctx context.Context, webhookID int, event, dedupKey string, payload any) (bool, error)
+	// ListDeliveries returns deliveries with their attempts, newest first
+	ListDeliveries(ctx context.Context, webhookID int, beforeID int64, limit int) ([]model.WebhookDelivery, error)
+	// ClaimDeliveries takes due deliveries and postpones them by lease, so
+	// other instances skip them while they are sent. A delivery whose
+	// sender dies is taken again after the lease.
+	ClaimDeliveries(ctx context.Context, limit int, lease time.Duration) ([]model.OutgoingDelivery, error)
+	// RecordAttempt saves the outcome of sending a delivery
+	RecordAttempt(ctx context.Context, deliveryID int64, attempt *model.WebhookAttempt, status string, nextAttemptAt time.Time) error
+}
+
+type webhookRepository struct {
+	db *PgRepository
+}
+
+func NewWebhookRepository(db *PgRepository) WebhookRepository {
+	return &webhookRepository{db: db}
+}
+
+func (r *webhookRepository) CreateWebhook(ctx context.Context, webhook *model.Webhook) error {
+	query := `
+		INSERT INTO webhooks (teacher_id, course, url, secret, threshold)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at
+	`
+
+	err := dbtx.From(ctx, r.db.pool).QueryRow(
+		ctx, query, webhook.TeacherID, webhook.Course, webhook.URL, webhook.Secret, webhook.Threshold,
+	).Scan(&webhook.ID, &webhook.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("Failed to add webhook: %w", err)
+	}
+
+	return nil
+}
+
+func (r *webhookRepository) GetWebhook(ctx context.Context, id int) (*model.Webhook, error) {
+	query := `
+		SELECT id, teacher_id, course, url, threshold, created_at
+		FROM webhooks
+		WHERE id = $1
+	`
+
+	var webhook model.Webhook
+	err := dbtx.From(ctx, r.db.pool).QueryRow(ctx, query, id).Scan(
+		&webhook.ID, &webhook.TeacherID, &webhook.Course, &webhook.URL, &webhook.Threshold, &webhook.CreatedAt,
+	)
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, apperror.NotFound("webhook not found").Wrap(err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get webhook: %w", err)
+	}
+
+	return &webhook, nil
+}
+
+func (r *webhookRepository) ListWebhooks(ctx context.Context, teacherID uuid.UUID, course string) ([]model.Webhook, error) {
+	query := `
+		SELECT id, teacher_id, course, url, threshold, created_at
+		FROM webhooks
+		WHERE teacher_id = $1 AND ($2 = '' OR course = $2)
+		ORDER BY id ASC
+	`
+
+	return r.listWebhooks(ctx, query, teacherID, course)
+}
+
+func (r *webhookRepository) ListCourseWebhooks(ctx context.Context, course string) ([]model.Webhook, error) {
+	query := `
+		SELECT id, teacher_id, course, url, threshold, created_at
+		FROM webhooks
+		WHERE course = $1
+		ORDER BY id ASC
+	`
+
+	return r.listWebhooks(ctx, query, course)
+}
+
+func (r *webhookRepository) listWebhooks(ctx context.Context, query string, args ...any) ([]model.Webhook, error) {
+	rows, err := dbtx.From(ctx, r.db.pool).Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get webhooks: %w", err)
+	}
+	defer rows.Close()
+
+	webhooks := []model.Webhook{}
+	for rows.Next() {
+		var webhook model.Webhook
+		err := rows.Scan(
+			&webhook.ID, &webhook.TeacherID, &webhook.Course, &webhook.URL, &webhook.Threshold, &webhook.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to scan webhook: %w", err)
+		}
+
+		webhooks = append(webhooks, webhook)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("Failed to read webhooks: %w", err)
+	}
+
+	return webhooks, nil
+}
+
+func (r *webhookRepository) DeleteWebhook(ctx context.Context, id int) error {
+	tag, err := dbtx.From(ctx, r.db.pool).Exec(ctx, `DELETE FROM webhooks WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("Failed to delete webhook: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return apperror.NotFound("webhook not found")
+	}
+
+	return nil
+}
+
+func (r *webhookRepository) EnqueueDelivery(ctx context.Context, webhookID int, event, dedupKey string, payload any) (bool, error) {
+	query := `
+		INSERT INTO webhook_deliveries (webhook_id, event, dedup_key, payload)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (webhook_id, dedup_key) DO NOTHING
+	`
+
+	tag, err := dbtx.From(ctx, r.db.pool).Exec(ctx, query, webhookID, event, dedupKey, payload)
+	if err != nil {
+		return false, fmt.Errorf("Failed to enqueue webhook delivery: %w", err)
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+func (r *webhookRepository) ListDeliveries(ctx context.Context, webhookID int, beforeID int64, limit int) ([]model.WebhookDelivery, error) {
+	query := `
+		SELECT id, webhook_id, event, payload, status, attempts,
+			CASE WHEN status = 'pending' THEN next_attempt_at END, created_at, delivered_at
+		FROM webhook_deliveries
+		WHERE webhook_id = $1 AND ($2::bigint = 0 OR id < $2)
+		ORDER BY id DESC
+		LIMIT $3
+	`
+
+	db := dbtx.From(ctx, r.db.pool)
+	rows, err := db.Query(ctx, query, webhookID, beforeID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get webhook deliveries: %w", err)
+	}
+
+	deliveries, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (model.WebhookDelivery, error) {
+		delivery := model.WebhookDelivery{History: []model.WebhookAttempt{}}
+		err := row.Scan(
+			&delivery.ID, &delivery.WebhookID, &delivery.Event, &delivery.Payload, &delivery.Status,
+			&delivery.Attempts, &delivery.NextAttemptAt, &delivery.CreatedAt, &delivery.DeliveredAt,
+		)
+		return delivery, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to scan webhook delivery: %w", err)
+	}
+	if len(deliveries) == 0 {
+		return deliveries, nil
+	}
+
+	ids := make([]int64, len(deliveries))
+	byID := make(map[int64]*model.WebhookDelivery, len(deliveries))
+	for i := range deliveries {
+		ids[i] = deliveries[i].ID
+		byID[deliveries[i].ID] = &deliveries[i]
+	}
+
+	rows, err = db.Query(ctx, `
+		SELECT delivery_id, attempted_at, status_code, COALESCE(error, ''), duration_ms
+		FROM webhook_attempts
+		WHERE delivery_id = ANY($1)
+		ORDER BY id ASC
+	`, ids)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get webhook attempts: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			deliveryID int64
+			attempt    model.WebhookAttempt
+		)
+		err := rows.Scan(&deliveryID, &attempt.AttemptedAt, &attempt.StatusCode, &attempt.Error, &attempt.DurationMS)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to scan webhook attempt: %w", err)
+		}
+
+		delivery := byID[deliveryID]
+		delivery.History = append(delivery.History, attempt)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("Failed to read webhook attempts: %w", err)
+	}
+
+	return deliveries, nil
+}
+
+func (r *webhookRepository) ClaimDeliveries(ctx context.Context, limit int, lease time.Duration) ([]model.OutgoingDelivery, error) {
+	query := `
+		UPDATE webhook_deliveries d
+		SET next_attempt_at = NOW() + $2::interval
+		FROM webhooks w
+		WHERE w.id = d.webhook_id AND d.id IN (
+			SELECT id
+			FROM webhook_deliveries
+			WHERE status = 'pending' AND next_attempt_at <= NOW()
+			ORDER BY next_attempt_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING d.id, d.webhook_id, d.event, d.payload, d.attempts, d.created_at, w.url, w.secret
+	`
+
+	rows, err := dbtx.From(ctx, r.db.pool).Query(ctx, query, limit, lease)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to claim webhook deliveries: %w", err)
+	}
+
+	deliveries, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (model.OutgoingDelivery, error) {
+		var delivery model.OutgoingDelivery
+		err := row.Scan(
+			&delivery.ID, &delivery.WebhookID, &delivery.Event, &delivery.Payload, &delivery.Attempts,
+			&delivery.CreatedAt, &delivery.URL, &delivery.Secret,
+		)
+		return delivery, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to scan webhook delivery: %w", err)
+	}
+
+	return deliveries, nil
+}
+
+func (r *webhookRepository) RecordAttempt(ctx context.Context, deliveryID int64, attempt *model.WebhookAttempt, status string, nextAttemptAt time.Time) error {
+	return r.db.InTx(ctx, func(ctx context.Context) error {
+		db := dbtx.From(ctx, r.db.pool)
+
+		_, err := db.Exec(ctx, `
+			INSERT INTO webhook_attempts (delivery_id, attempted_at, status_code, error, duration_ms)
+			VALUES ($1, $2, $3, NULLIF($4, ''), $5)
+		`, deliveryID, attempt.AttemptedAt, attempt.StatusCode, attempt.Error, attempt.DurationMS)
+		if err != nil {
+			return fmt.Errorf("Failed to record webhook attempt: %w", err)
+		}
+
+		_, err = db.Exec(ctx, `
+			UPDATE webhook_deliveries
+			SET status = $2, attempts = attempts + 1, next_attempt_at = $3,
+				delivered_at = CASE WHEN $2 = 'delivered' THEN NOW() END
+			WHERE id = $1
+		`, deliveryID, status, nextAttemptAt)
+		if err != nil {
+			return fmt.Errorf("Failed to update webhook delivery: %w", err)
+		}
+
+		return nil
+	})
+}
@@ -9,23 +9,50 @@ import (
 	"net/url"
 	"time"
 
+	"github.com/KEPTANy/plag-check/analysis-service/internal/metrics"
 	"github.com/KEPTANy/plag-check/analysis-service/internal/model"
 	"github.com/KEPTANy/plag-check/analysis-service/internal/repository"
 	"github.com/KEPTANy/plag-check/analysis-service/internal/storage"
+	"github.com/KEPTANy/plag-check/shared/apperror"
+	"github.com/KEPTANy/plag-check/shared/dbtx"
+	"github.com/KEPTANy/plag-check/shared/events"
+	"github.com/KEPTANy/plag-check/shared/tracing"
 )
 
+// errRenderer is returned when QuickChart fails, the request itself was fine
+var errRenderer = apperror.New(apperror.CodeBadGateway, "word cloud renderer is unavailable")
+
+// exactMatchSimilarity is the similarity of files with the same hash, the
+// only kind of match found so far
+const exactMatchSimilarity = 1.0
+
 type AnalysisService interface {
 	CheckPlagiarism(ctx context.Context) ([]model.PlagiarismResult, error)
 	GetWordCloud(ctx context.Context, fileID int) ([]byte, error)
+	HandleFileUploaded(ctx context.Context, event *events.Event) error
+}
+
+// Publisher is implemented by events.Publisher.
+type Publisher interface {
+	Publish(ctx context.Context, topic string, payload any) error
 }
 
 type analysisService struct {
-	db      repository.FileRepository
-	storage storage.Storage
+	db        repository.FileRepository
+	matches   repository.MatchRepository
+	storage   storage.Storage
+	tx        dbtx.Transactor
+	publisher Publisher
 }
 
-func NewAnalysisService(db repository.FileRepository, storage storage.Storage) AnalysisService {
-	return &analysisService{db: db, storage: storage}
+func NewAnalysisService(
+	db repository.FileRepository,
+	matches repository.MatchRepository,
+	storage storage.Storage,
+	tx dbtx.Transactor,
+	publisher Publisher,
+) AnalysisService {
+	return &analysisService{db: db, matches: matches, storage: storage, tx: tx, publisher: publisher}
 }
 
 func (s *analysisService) CheckPlagiarism(ctx context.Context) ([]model.PlagiarismResult, error) {
@@ -34,9 +61,61 @@ func (s *analysisService) CheckPlagiarism(ctx context.Context) ([]model.Plagiari
 		return nil, fmt.Errorf("Failed to get plagiarism groups: %w", err)
 	}
 
+	metrics.PlagiarismChecks.Inc()
+	metrics.PlagiarismGroups.Set(float64(len(results)))
+
 	return results, nil
 }
 
+// HandleFileUploaded compares a new file with the earlier files of other
+// students and publishes analysis.completed. A redelivered event finds the
+// file already analyzed and does nothing.
+func (s *analysisService) HandleFileUploaded(ctx context.Context, event *events.Event) error {
+	var uploaded events.FileUploaded
+	if err := event.Decode(&uploaded); err != nil {
+		return err
+	}
+
+	return s.tx.InTx(ctx, func(ctx context.Context) error {
+		first, err := s.matches.MarkAnalyzed(ctx, uploaded.FileID)
+		if err != nil {
+			return err
+		}
+		if !first {
+			return nil
+		}
+
+		files, err := s.matches.FindMatches(ctx, uploaded.FileID, uploaded.StudentID, uploaded.FileHash)
+		if err != nil {
+			return err
+		}
+		if err := s.matches.AddMatches(ctx, uploaded.FileID, files); err != nil {
+			return err
+		}
+
+		completed := events.AnalysisCompleted{
+			FileID:    uploaded.FileID,
+			StudentID: uploaded.StudentID,
+			Course:    uploaded.Course,
+			Matches:   make([]events.Match, 0, len(files)),
+		}
+		for _, file := range files {
+			completed.Matches = append(completed.Matches, events.Match{
+				FileID:     file.ID,
+				StudentID:  file.StudentID,
+				Similarity: exactMatchSimilarity,
+			})
+		}
+
+		if err := s.publisher.Publish(ctx, events.TopicAnalysisCompleted, completed); err != nil {
+			return err
+		}
+
+		metrics.UploadMatches.Add(float64(len(files)))
+		return nil
+	})
+}
+
 func (s *analysisService) GetWordCloud(ctx context.Context, fileID int) ([]byte, error) {
 	file, err := s.db.GetFileByID(ctx, fileID)
 	if err != nil {
@@ -71,24 +150,37 @@ func (s *analysisService) GetWordCloud(ctx context.Context, fileID int) ([]byte,
 	apiURL := fmt.Sprintf("https://quickchart.io/wordcloud?text=%s", url.QueryEscape(string(configJSON)))
 
 	client := &http.Client{
-		Timeout: 30 * time.Second,
+		Timeout:   30 * time.Second,
+		Transport: tracing.Transport(nil),
+	}
+
+	start := time.Now()
+	outcome := "error"
+	defer func() {
+		metrics.RenderDuration.WithLabelValues(outcome).Observe(time.Since(start).Seconds())
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, apiURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create quickchart.io request: %w", err)
 	}
 
-	resp, err := client.Get(apiURL)
+	resp, err := client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("Failed to call quickchart.io API: %w", err)
+		return nil, errRenderer.Wrap(fmt.Errorf("Failed to call quickchart.io API: %w", err))
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("QuickChart API returned error: %d, body: %s", resp.StatusCode, string(body))
+		return nil, errRenderer.Wrap(fmt.Errorf("QuickChart API returned error: %d, body: %s", resp.StatusCode, string(body)))
 	}
 
 	imageData, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("Failed to read image data: %w", err)
+		return nil, errRenderer.Wrap(fmt.Errorf("Failed to read image data: %w", err))
 	}
+	outcome = "ok"
 
 	return imageData, nil
 }
@@ -0,0 +1,146 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"maps"
+	"slices"
+	"testing"
+
+	"github.com/KEPTANy/plag-check/analysis-service/internal/model"
+	"github.com/KEPTANy/plag-check/shared/events"
+	"github.com/gofrs/uuid/v5"
+)
+
+// fakeDB keeps what the analysis writes in memory. A transaction that fails
+// is rolled back, published events included, as they would be with the
+// outbox in Postgres.
+type fakeDB struct {
+	files     []model.File
+	analyzed  map[int]bool
+	matches   map[int][]int
+	published []events.AnalysisCompleted
+
+	// failPublish makes the next Publish fail
+	failPublish bool
+}
+
+func newFakeDB(files ...model.File) *fakeDB {
+	return &fakeDB{files: files, analyzed: make(map[int]bool), matches: make(map[int][]int)}
+}
+
+func (db *fakeDB) InTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	analyzed, matches, published := maps.Clone(db.analyzed), maps.Clone(db.matches), slices.Clone(db.published)
+
+	if err := fn(ctx); err != nil {
+		db.analyzed, db.matches, db.published = analyzed, matches, published
+		return err
+	}
+	return nil
+}
+
+func (db *fakeDB) MarkAnalyzed(ctx context.Context, fileID int) (bool, error) {
+	if db.analyzed[fileID] {
+		return false, nil
+	}
+	db.analyzed[fileID] = true
+	return true, nil
+}
+
+func (db *fakeDB) FindMatches(ctx context.Context, fileID int, studentID uuid.UUID, hash string) ([]model.File, error) {
+	var found []model.File
+	for _, file := range db.files {
+		if file.FileHash == hash && file.StudentID != studentID && file.ID < fileID {
+			found = append(found, file)
+		}
+	}
+	return found, nil
+}
+
+func (db *fakeDB) AddMatches(ctx context.Context, fileID int, matches []model.File) error {
+	for _, match := range matches {
+		if !slices.Contains(db.matches[fileID], match.ID) {
+			db.matches[fileID] = append(db.matches[fileID], match.ID)
+		}
+	}
+	return nil
+}
+
+func (db *fakeDB) Publish(ctx context.Context, topic string, payload any) error {
+	if db.failPublish {
+		db.failPublish = false
+		return errors.New("connection reset")
+	}
+	db.published = append(db.published, payload.(events.AnalysisCompleted))
+	return nil
+}
+
+func uploadedEvent(t *testing.T, id int64, uploaded events.FileUploaded) *events.Event {
+	t.Helper()
+
+	payload, err := json.Marshal(uploaded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &events.Event{ID: id, Topic: events.TopicFileUploaded, Producer: "file-storage-service", Payload: payload}
+}
+
+func TestHandleFileUploadedRedelivery(t *testing.T) {
+	alice, bob := uuid.Must(uuid.NewV4()), uuid.Must(uuid.NewV4())
+	original := model.File{ID: 1, StudentID: alice, FileHash: "abc"}
+	copied := model.File{ID: 2, StudentID: bob, FileHash: "abc"}
+
+	event := func(t *testing.T) *events.Event {
+		return uploadedEvent(t, 7, events.FileUploaded{FileID: copied.ID, StudentID: bob, FileHash: "abc", Course: "cs101"})
+	}
+
+	check := func(t *testing.T, db *fakeDB) {
+		t.Helper()
+
+		if len(db.published) != 1 {
+			t.Fatalf("published %d analysis.completed events, want 1", len(db.published))
+		}
+		completed := db.published[0]
+		if completed.FileID != copied.ID || len(completed.Matches) != 1 || completed.Matches[0].FileID != original.ID {
+			t.Errorf("published %+v, want file 2 matching file 1", completed)
+		}
+		if got := db.matches[copied.ID]; !slices.Equal(got, []int{original.ID}) {
+			t.Errorf("matches of file 2 = %v, want [1]", got)
+		}
+	}
+
+	t.Run("delivered again", func(t *testing.T) {
+		db := newFakeDB(original, copied)
+		s := NewAnalysisService(nil, db, nil, db, db)
+
+		for i := range 3 {
+			if err := s.HandleFileUploaded(context.Background(), event(t)); err != nil {
+				t.Fatalf("delivery %d: %v", i, err)
+			}
+		}
+		check(t, db)
+	})
+
+	t.Run("redelivered after a failure", func(t *testing.T) {
+		db := newFakeDB(original, copied)
+		db.failPublish = true
+		s := NewAnalysisService(nil, db, nil, db, db)
+
+		if err := s.HandleFileUploaded(context.Background(), event(t)); err == nil {
+			t.Fatal("first delivery succeeded, want the publish error")
+		}
+		// the failed attempt must not mark the file as analyzed, or the
+		// retry would skip it and analysis.completed would never be sent
+		if db.analyzed[copied.ID] || len(db.published) != 0 {
+			t.Fatalf("failed delivery left state behind: analyzed %v, published %v", db.analyzed, db.published)
+		}
+
+		for i := range 2 {
+			if err := s.HandleFileUploaded(context.Background(), event(t)); err != nil {
+				t.Fatalf("redelivery %d: %v", i, err)
+			}
+		}
+		check(t, db)
+	})
+}
@@ -0,0 +1,164 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/KEPTANy/plag-check/analysis-service/internal/model"
+	"github.com/KEPTANy/plag-check/analysis-service/internal/repository"
+	"github.com/KEPTANy/plag-check/shared/apperror"
+	"github.com/KEPTANy/plag-check/shared/events"
+	"github.com/gofrs/uuid/v5"
+)
+
+var ErrWebhookNotFound = apperror.NotFound("webhook not found")
+
+type WebhookService interface {
+	CreateWebhook(ctx context.Context, teacherID uuid.UUID, req *model.CreateWebhookRequest) (*model.Webhook, error)
+	ListWebhooks(ctx context.Context, teacherID uuid.UUID, course string) ([]model.Webhook, error)
+	DeleteWebhook(ctx context.Context, teacherID uuid.UUID, id int) error
+	ListDeliveries(ctx context.Context, teacherID uuid.UUID, id int, beforeID int64, limit int) ([]model.WebhookDelivery, error)
+	Ping(ctx context.Context, teacherID uuid.UUID, id int) error
+	HandleAnalysisCompleted(ctx context.Context, event *events.Event) error
+}
+
+type webhookService struct {
+	db repository.WebhookRepository
+}
+
+func NewWebhookService(db repository.WebhookRepository) WebhookService {
+	return &webhookService{db: db}
+}
+
+func (s *webhookService) CreateWebhook(ctx context.Context, teacherID uuid.UUID, req *model.CreateWebhookRequest) (*model.Webhook, error) {
+	secret, err := generateSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	webhook := &model.Webhook{
+		TeacherID: teacherID,
+		Course:    req.Course,
+		URL:       req.URL,
+		Secret:    secret,
+		Threshold: exactMatchSimilarity,
+	}
+	if req.Threshold != nil {
+		webhook.Threshold = *req.Threshold
+	}
+
+	if err := s.db.CreateWebhook(ctx, webhook); err != nil {
+		return nil, err
+	}
+
+	return webhook, nil
+}
+
+func (s *webhookService) ListWebhooks(ctx context.Context, teacherID uuid.UUID, course string) ([]model.Webhook, error) {
+	return s.db.ListWebhooks(ctx, teacherID, course)
+}
+
+// ownWebhook returns a webhook of the teacher, webhooks of others are not
+// found rather than forbidden so their ids are not revealed.
+func (s *webhookService) ownWebhook(ctx context.Context, teacherID uuid.UUID, id int) (*model.Webhook, error) {
+	webhook, err := s.db.GetWebhook(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if webhook.TeacherID != teacherID {
+		return nil, ErrWebhookNotFound
+	}
+
+	return webhook, nil
+}
+
+func (s *webhookService) DeleteWebhook(ctx context.Context, teacherID uuid.UUID, id int) error {
+	if _, err := s.ownWebhook(ctx, teacherID, id); err != nil {
+		return err
+	}
+
+	return s.db.DeleteWebhook(ctx, id)
+}
+
+func (s *webhookService) ListDeliveries(ctx context.Context, teacherID uuid.UUID, id int, beforeID int64, limit int) ([]model.WebhookDelivery, error) {
+	if _, err := s.ownWebhook(ctx, teacherID, id); err != nil {
+		return nil, err
+	}
+
+	return s.db.ListDeliveries(ctx, id, beforeID, limit)
+}
+
+// Ping queues a webhook.ping delivery to check the receiver and the
+// signature.
+func (s *webhookService) Ping(ctx context.Context, teacherID uuid.UUID, id int) error {
+	webhook, err := s.ownWebhook(ctx, teacherID, id)
+	if err != nil {
+		return err
+	}
+
+	key, err := uuid.NewV4()
+	if err != nil {
+		return fmt.Errorf("Failed to generate ping id: %w", err)
+	}
+
+	_, err = s.db.EnqueueDelivery(ctx, webhook.ID, model.WebhookEventPing, "ping:"+key.String(), map[string]any{
+		"webhook_id": webhook.ID,
+		"course":     webhook.Course,
+	})
+	return err
+}
+
+// HandleAnalysisCompleted queues a plagiarism.suspicious_pair delivery for
+// every match at or above the threshold of every webhook of the course. The
+// pair is the deduplication key, so a redelivered event changes nothing.
+func (s *webhookService) HandleAnalysisCompleted(ctx context.Context, event *events.Event) error {
+	var completed events.AnalysisCompleted
+	if err := event.Decode(&completed); err != nil {
+		return err
+	}
+
+	if completed.Course == "" || len(completed.Matches) == 0 {
+		return nil
+	}
+
+	webhooks, err := s.db.ListCourseWebhooks(ctx, completed.Course)
+	if err != nil {
+		return err
+	}
+
+	for _, webhook := range webhooks {
+		for _, match := range completed.Matches {
+			if match.Similarity < webhook.Threshold {
+				continue
+			}
+
+			pair := model.SuspiciousPair{
+				Course:           completed.Course,
+				FileID:           completed.FileID,
+				StudentID:        completed.StudentID,
+				MatchedFileID:    match.FileID,
+				MatchedStudentID: match.StudentID,
+				Similarity:       match.Similarity,
+			}
+			key := fmt.Sprintf("pair:%d:%d", completed.FileID, match.FileID)
+
+			_, err := s.db.EnqueueDelivery(ctx, webhook.ID, model.WebhookEventSuspiciousPair, key, pair)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func generateSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("Failed to generate webhook secret: %w", err)
+	}
+
+	return "whsec_" + hex.EncodeToString(secret), nil
+}
@@ -6,10 +6,18 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+
+	"github.com/KEPTANy/plag-check/shared/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+var tracer = otel.Tracer("github.com/KEPTANy/plag-check/analysis-service/internal/storage")
+
 type Storage interface {
 	GetFile(ctx context.Context, storagePath string) (rc io.ReadCloser, size int64, err error)
+	CheckReadable(ctx context.Context) error
 }
 
 type storage struct {
@@ -23,7 +31,11 @@ func NewStorage(root string) (Storage, error) {
 	return &storage{root: root}, nil
 }
 
+// GetFile only opens the file, the span does not cover reading it.
 func (s *storage) GetFile(ctx context.Context, storagePath string) (rc io.ReadCloser, size int64, err error) {
+	_, span := tracer.Start(ctx, "storage.GetFile", trace.WithAttributes(attribute.String("storage.path", storagePath)))
+	defer func() { tracing.End(span, err) }()
+
 	fullPath := filepath.Join(s.root, storagePath)
 
 	fileInfo, err := os.Stat(fullPath)
@@ -38,3 +50,18 @@ func (s *storage) GetFile(ctx context.Context, storagePath string) (rc io.ReadCl
 
 	return file, fileInfo.Size(), nil
 }
+
+// CheckReadable verifies that the shared storage volume is mounted. The
+// service only reads files, so unlike file storage it does not need to write.
+func (s *storage) CheckReadable(ctx context.Context) error {
+	dir, err := os.Open(s.root)
+	if err != nil {
+		return fmt.Errorf("Storage root is not readable: %w", err)
+	}
+	defer dir.Close()
+
+	if _, err := dir.Readdirnames(1); err != nil && err != io.EOF {
+		return fmt.Errorf("Storage root is not readable: %w", err)
+	}
+	return nil
+}
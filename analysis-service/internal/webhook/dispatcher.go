@@ -0,0 +1,206 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/KEPTANy/plag-check/analysis-service/internal/metrics"
+	"github.com/KEPTANy/plag-check/analysis-service/internal/model"
+	"github.com/KEPTANy/plag-check/analysis-service/internal/repository"
+	"github.com/KEPTANy/plag-check/shared/tracing"
+)
+
+// maxRetryDelay caps the exponential backoff between attempts
+const maxRetryDelay = time.Hour
+
+// Dispatcher sends pending deliveries until they succeed or run out of
+// attempts. Instances of the service share the work through
+// WebhookRepository.ClaimDeliveries.
+type Dispatcher struct {
+	repo   repository.WebhookRepository
+	client *http.Client
+
+	PollInterval time.Duration
+	BatchSize    int
+	// MaxAttempts is how often a delivery is sent before it is marked failed
+	MaxAttempts int
+	// RetryDelay is the delay after the first failed attempt, it doubles
+	// with every further one
+	RetryDelay time.Duration
+}
+
+func NewDispatcher(repo repository.WebhookRepository, timeout time.Duration, guard *Guard) *Dispatcher {
+	return &Dispatcher{
+		repo: repo,
+		client: &http.Client{
+			Timeout:   timeout,
+			Transport: tracing.Transport(guard.transport()),
+			// a redirect counts as a failure, receivers are given by URL
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		PollInterval: 5 * time.Second,
+		BatchSize:    20,
+		MaxAttempts:  8,
+		RetryDelay:   30 * time.Second,
+	}
+}
+
+// Run sends deliveries until ctx is done, it is meant for bootstrap.App.Go.
+func (d *Dispatcher) Run(ctx context.Context) error {
+	for {
+		n, err := d.dispatchBatch(ctx)
+		if err != nil && ctx.Err() == nil {
+			slog.ErrorContext(ctx, "Failed to dispatch webhooks", "error", err)
+		}
+
+		if err == nil && n == d.BatchSize {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(d.PollInterval):
+		}
+	}
+}
+
+func (d *Dispatcher) dispatchBatch(ctx context.Context) (int, error) {
+	// the lease outlasts a request, the batch is sent in parallel
+	deliveries, err := d.repo.ClaimDeliveries(ctx, d.BatchSize, d.client.Timeout+time.Minute)
+	if err != nil {
+		return 0, err
+	}
+
+	var wg sync.WaitGroup
+	for i := range deliveries {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d.deliver(ctx, &deliveries[i])
+		}()
+	}
+	wg.Wait()
+
+	return len(deliveries), nil
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, delivery *model.OutgoingDelivery) {
+	attempt := d.send(ctx, delivery)
+	if ctx.Err() != nil {
+		// shutting down, the delivery is sent again after its lease
+		return
+	}
+
+	attempts := delivery.Attempts + 1
+	status := model.DeliveryStatusDelivered
+	nextAttemptAt := time.Now()
+	outcome := "ok"
+
+	if attempt.Error != "" {
+		switch {
+		case attempts >= d.MaxAttempts:
+			status = model.DeliveryStatusFailed
+			outcome = "failed"
+			slog.WarnContext(ctx, "Giving up on webhook delivery", "delivery_id", delivery.ID,
+				"webhook_id", delivery.WebhookID, "attempts", attempts, "error", attempt.Error)
+		default:
+			status = model.DeliveryStatusPending
+			nextAttemptAt = nextAttemptAt.Add(d.backoff(attempts))
+			outcome = "retry"
+		}
+	}
+	metrics.WebhookDeliveries.WithLabelValues(outcome).Inc()
+
+	if err := d.repo.RecordAttempt(ctx, delivery.ID, attempt, status, nextAttemptAt); err != nil {
+		slog.ErrorContext(ctx, "Failed to record webhook attempt", "delivery_id", delivery.ID, "error", err)
+	}
+}
+
+// send posts the delivery, any response other than 2xx is a failure.
+func (d *Dispatcher) send(ctx context.Context, delivery *model.OutgoingDelivery) *model.WebhookAttempt {
+	attempt := &model.WebhookAttempt{AttemptedAt: time.Now()}
+	defer func() {
+		attempt.DurationMS = int(time.Since(attempt.AttemptedAt).Milliseconds())
+	}()
+
+	body, err := json.Marshal(map[string]any{
+		"id":         delivery.ID,
+		"event":      delivery.Event,
+		"created_at": delivery.CreatedAt,
+		"data":       delivery.Payload,
+	})
+	if err != nil {
+		attempt.Error = fmt.Sprintf("Failed to encode delivery: %v", err)
+		return attempt
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(body))
+	if err != nil {
+		attempt.Error = "Invalid receiver URL"
+		return attempt
+	}
+
+	timestamp := attempt.AttemptedAt.Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "plag-check-webhooks")
+	req.Header.Set(HeaderEvent, delivery.Event)
+	req.Header.Set(HeaderDelivery, strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(delivery.Secret, timestamp, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		attempt.Error = attemptError(err)
+		slog.WarnContext(ctx, "Failed to send webhook", "delivery_id", delivery.ID,
+			"webhook_id", delivery.WebhookID, "error", err)
+		return attempt
+	}
+	defer resp.Body.Close()
+	// drained so the connection is reused
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	attempt.StatusCode = &resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		attempt.Error = fmt.Sprintf("Receiver responded with %s", resp.Status)
+	}
+
+	return attempt
+}
+
+// attemptError is what the attempt history shows for a failed request. The
+// history is shown to teachers, so it names the kind of failure only, the
+// error with resolved addresses and network details goes to the log.
+func attemptError(err error) string {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, ErrForbiddenAddress):
+		return ErrForbiddenAddress.Error()
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return "Request timed out"
+	default:
+		return "Failed to connect to receiver"
+	}
+}
+
+// backoff is RetryDelay doubled for every attempt after the first, up to an
+// hour.
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	delay := d.RetryDelay
+	for i := 1; i < attempts && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxRetryDelay)
+}
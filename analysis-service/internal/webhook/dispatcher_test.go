@@ -0,0 +1,258 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/KEPTANy/plag-check/analysis-service/internal/model"
+	"github.com/KEPTANy/plag-check/analysis-service/internal/repository"
+)
+
+const testSecret = "whsec_test"
+
+// recordingRepo keeps the attempts the dispatcher records, the other
+// repository methods are not used by deliver.
+type recordingRepo struct {
+	repository.WebhookRepository
+
+	mu       sync.Mutex
+	attempts []recordedAttempt
+}
+
+type recordedAttempt struct {
+	attempt       model.WebhookAttempt
+	status        string
+	nextAttemptAt time.Time
+}
+
+func (r *recordingRepo) RecordAttempt(ctx context.Context, deliveryID int64, attempt *model.WebhookAttempt, status string, nextAttemptAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.attempts = append(r.attempts, recordedAttempt{attempt: *attempt, status: status, nextAttemptAt: nextAttemptAt})
+	return nil
+}
+
+func (r *recordingRepo) last() recordedAttempt {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.attempts[len(r.attempts)-1]
+}
+
+// receiver answers with statuses in turn, the last one from then on, and
+// checks the signature of every request.
+type receiver struct {
+	*httptest.Server
+	hits atomic.Int32
+}
+
+func newReceiver(t *testing.T, statuses ...int) *receiver {
+	t.Helper()
+
+	rc := &receiver{}
+	rc.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hit := int(rc.hits.Add(1))
+
+		body, _ := io.ReadAll(r.Body)
+		timestamp, _ := strconv.ParseInt(r.Header.Get(HeaderTimestamp), 10, 64)
+		if !Verify(testSecret, timestamp, body, r.Header.Get(HeaderSignature), time.Minute) {
+			t.Errorf("Request %d has an invalid signature", hit)
+		}
+		if got := r.Header.Get(HeaderDelivery); got != "42" {
+			t.Errorf("%s = %q, want 42", HeaderDelivery, got)
+		}
+		if got := r.Header.Get(HeaderEvent); got != "plagiarism.suspicious_pair" {
+			t.Errorf("%s = %q", HeaderEvent, got)
+		}
+
+		var payload struct {
+			ID   int64           `json:"id"`
+			Data json.RawMessage `json:"data"`
+		}
+		if err := json.Unmarshal(body, &payload); err != nil || payload.ID != 42 || string(payload.Data) != `{"file_id":12}` {
+			t.Errorf("Request %d body = %s", hit, body)
+		}
+
+		w.WriteHeader(statuses[min(hit, len(statuses))-1])
+	}))
+	t.Cleanup(rc.Close)
+
+	return rc
+}
+
+func newTestDispatcher(timeout time.Duration) (*Dispatcher, *recordingRepo) {
+	repo := &recordingRepo{}
+	loopback := []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8"), netip.MustParsePrefix("::1/128")}
+
+	d := NewDispatcher(repo, timeout, NewGuard(loopback))
+	d.MaxAttempts = 4
+	d.RetryDelay = 30 * time.Second
+	return d, repo
+}
+
+func delivery(url string) *model.OutgoingDelivery {
+	return &model.OutgoingDelivery{
+		WebhookDelivery: model.WebhookDelivery{
+			ID:        42,
+			WebhookID: 7,
+			Event:     "plagiarism.suspicious_pair",
+			Payload:   json.RawMessage(`{"file_id":12}`),
+			Status:    model.DeliveryStatusPending,
+		},
+		URL:    url,
+		Secret: testSecret,
+	}
+}
+
+// deliverUntilDone sends the delivery again after every failure, as the
+// repository would hand it out once it is due, and returns the recorded
+// attempts.
+func deliverUntilDone(t *testing.T, d *Dispatcher, repo *recordingRepo, outgoing *model.OutgoingDelivery) []recordedAttempt {
+	t.Helper()
+
+	for range d.MaxAttempts + 1 {
+		d.deliver(context.Background(), outgoing)
+		outgoing.Attempts++
+
+		if repo.last().status != model.DeliveryStatusPending {
+			return repo.attempts
+		}
+	}
+
+	t.Fatalf("Delivery still pending after %d attempts", outgoing.Attempts)
+	return nil
+}
+
+func TestDeliverRetries(t *testing.T) {
+	rc := newReceiver(t, http.StatusInternalServerError, http.StatusServiceUnavailable, http.StatusNoContent)
+	d, repo := newTestDispatcher(time.Second)
+
+	start := time.Now()
+	attempts := deliverUntilDone(t, d, repo, delivery(rc.URL))
+
+	if len(attempts) != 3 || rc.hits.Load() != 3 {
+		t.Fatalf("%d attempts recorded, %d requests, want 3 of each", len(attempts), rc.hits.Load())
+	}
+
+	// 30s after the first failure, doubled after the second
+	for i, wantDelay := range []time.Duration{30 * time.Second, time.Minute} {
+		a := attempts[i]
+		if a.status != model.DeliveryStatusPending || a.attempt.Error == "" {
+			t.Errorf("attempt %d = %s %q, want pending with an error", i+1, a.status, a.attempt.Error)
+		}
+		if delay := a.nextAttemptAt.Sub(start); delay < wantDelay || delay > wantDelay+5*time.Second {
+			t.Errorf("attempt %d retried after %s, want %s", i+1, delay, wantDelay)
+		}
+	}
+	if got := *attempts[0].attempt.StatusCode; got != http.StatusInternalServerError {
+		t.Errorf("status code of attempt 1 = %d", got)
+	}
+
+	last := attempts[2]
+	if last.status != model.DeliveryStatusDelivered || last.attempt.Error != "" || *last.attempt.StatusCode != http.StatusNoContent {
+		t.Errorf("last attempt = %s %+v, want delivered with 204", last.status, last.attempt)
+	}
+}
+
+func TestDeliverGivesUp(t *testing.T) {
+	rc := newReceiver(t, http.StatusInternalServerError)
+	d, repo := newTestDispatcher(time.Second)
+
+	attempts := deliverUntilDone(t, d, repo, delivery(rc.URL))
+
+	if len(attempts) != d.MaxAttempts || int(rc.hits.Load()) != d.MaxAttempts {
+		t.Fatalf("%d attempts recorded, %d requests, want %d of each", len(attempts), rc.hits.Load(), d.MaxAttempts)
+	}
+	for i, a := range attempts[:len(attempts)-1] {
+		if a.status != model.DeliveryStatusPending {
+			t.Errorf("attempt %d status = %s, want pending", i+1, a.status)
+		}
+	}
+	if last := attempts[len(attempts)-1]; last.status != model.DeliveryStatusFailed {
+		t.Errorf("last attempt status = %s, want failed", last.status)
+	}
+}
+
+func TestDeliverFailures(t *testing.T) {
+	redirect := httptest.NewServer(http.RedirectHandler("http://127.0.0.1:1/", http.StatusFound))
+	defer redirect.Close()
+
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(300 * time.Millisecond):
+		}
+	}))
+	defer slow.Close()
+
+	closed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	closed.Close()
+
+	tests := []struct {
+		name       string
+		url        string
+		wantError  string
+		wantStatus int
+	}{
+		{"redirect is not followed", redirect.URL, "Receiver responded with 302 Found", http.StatusFound},
+		{"timeout", slow.URL, "Request timed out", 0},
+		{"connection refused", closed.URL, "Failed to connect to receiver", 0},
+		{"internal address", "http://10.0.0.1:5432/", "Receiver address is not allowed", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, repo := newTestDispatcher(100 * time.Millisecond)
+			d.deliver(context.Background(), delivery(tt.url))
+
+			a := repo.last()
+			if a.status != model.DeliveryStatusPending || a.attempt.Error != tt.wantError {
+				t.Errorf("attempt = %s %q, want pending with %q", a.status, a.attempt.Error, tt.wantError)
+			}
+			if tt.wantStatus != 0 && (a.attempt.StatusCode == nil || *a.attempt.StatusCode != tt.wantStatus) {
+				t.Errorf("status code = %v, want %d", a.attempt.StatusCode, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestDeliverShuttingDown(t *testing.T) {
+	rc := newReceiver(t, http.StatusNoContent)
+	d, repo := newTestDispatcher(time.Second)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	d.deliver(ctx, delivery(rc.URL))
+
+	// the delivery is left to its lease instead of counting as a failure
+	if len(repo.attempts) != 0 {
+		t.Errorf("recorded %+v while shutting down", repo.attempts)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	d := &Dispatcher{RetryDelay: 30 * time.Second}
+
+	for attempts, want := range map[int]time.Duration{
+		1:   30 * time.Second,
+		2:   time.Minute,
+		3:   2 * time.Minute,
+		7:   32 * time.Minute,
+		8:   time.Hour,
+		100: time.Hour,
+	} {
+		if got := d.backoff(attempts); got != want {
+			t.Errorf("backoff(%d) = %s, want %s", attempts, got, want)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+// ErrForbiddenAddress is returned for receivers on addresses webhooks must
+// not reach.
+var ErrForbiddenAddress = errors.New("Receiver address is not allowed")
+
+// Guard keeps webhooks away from the internal network. Receiver URLs come
+// from teachers, without it a webhook could reach the database or the admin
+// ports of the services. Allowed networks are exempt, e.g. the docker host
+// running cmd/webhook-receiver in development.
+type Guard struct {
+	allowed []netip.Prefix
+}
+
+func NewGuard(allowed []netip.Prefix) *Guard {
+	return &Guard{allowed: allowed}
+}
+
+// Allows reports whether webhooks may be sent to addr: loopback, private,
+// link-local and unspecified addresses are refused unless allowed.
+func (g *Guard) Allows(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range g.allowed {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	return !addr.IsLoopback() && !addr.IsPrivate() && !addr.IsLinkLocalUnicast() &&
+		!addr.IsLinkLocalMulticast() && !addr.IsUnspecified()
+}
+
+// control is a net.Dialer.Control. It sees the address actually dialed,
+// after DNS resolution, so names resolving to internal addresses are caught
+// as well as redirects of the name to one after the URL was checked.
+func (g *Guard) control(network, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil || !g.Allows(addrPort.Addr()) {
+		return fmt.Errorf("%w: %s", ErrForbiddenAddress, address)
+	}
+	return nil
+}
+
+// transport is http.DefaultTransport dialing through the guard.
+func (g *Guard) transport() *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   g.control,
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	// a proxy would connect on our behalf, past the guard
+	transport.Proxy = nil
+	return transport
+}
@@ -0,0 +1,89 @@
+package webhook
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+func TestGuardAllows(t *testing.T) {
+	guard := NewGuard([]netip.Prefix{netip.MustParsePrefix("172.17.0.1/32")})
+
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"127.1.2.3", false},
+		{"::1", false},
+		{"10.0.0.5", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"fd00::1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"0.0.0.0", false},
+		{"::", false},
+		// IPv4 written as IPv6
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:10.0.0.5", false},
+		// allowed explicitly
+		{"172.17.0.1", true},
+		{"::ffff:172.17.0.1", true},
+		{"172.17.0.2", false},
+	}
+
+	for _, tt := range tests {
+		if got := guard.Allows(netip.MustParseAddr(tt.addr)); got != tt.want {
+			t.Errorf("Allows(%s) = %v, want %v", tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestGuardTransport(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	// the name is resolved before the guard sees the address
+	byName := strings.Replace(receiver.URL, "127.0.0.1", "localhost", 1)
+
+	t.Run("refused", func(t *testing.T) {
+		client := &http.Client{Transport: NewGuard(nil).transport()}
+
+		for _, url := range []string{receiver.URL, byName} {
+			resp, err := client.Get(url)
+			if err == nil {
+				resp.Body.Close()
+			}
+			if !errors.Is(err, ErrForbiddenAddress) {
+				t.Errorf("GET %s error = %v, want %v", url, err, ErrForbiddenAddress)
+			}
+			if got := attemptError(err); got != "Receiver address is not allowed" {
+				t.Errorf("attempt error = %q", got)
+			}
+		}
+	})
+
+	t.Run("allowed", func(t *testing.T) {
+		loopback := []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8"), netip.MustParsePrefix("::1/128")}
+		client := &http.Client{Transport: NewGuard(loopback).transport()}
+
+		for _, url := range []string{receiver.URL, byName} {
+			resp, err := client.Get(url)
+			if err != nil {
+				t.Fatalf("GET %s: %v", url, err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusNoContent {
+				t.Errorf("GET %s status = %d", url, resp.StatusCode)
+			}
+		}
+	})
+}
@@ -0,0 +1,41 @@
+// Package webhook sends the deliveries of teachers' webhooks. Every request is
+// signed with the secret of its webhook, see Sign.
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"time"
+)
+
+const (
+	HeaderEvent     = "X-Plagcheck-Event"
+	HeaderDelivery  = "X-Plagcheck-Delivery"
+	HeaderTimestamp = "X-Plagcheck-Timestamp"
+	HeaderSignature = "X-Plagcheck-Signature"
+)
+
+// Sign returns the signature header of body sent at timestamp (Unix
+// seconds): "sha256=" and the hex HMAC-SHA256 of "<timestamp>.<body>" keyed
+// with secret. The timestamp is signed so a captured request cannot be
+// replayed later.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks a signature made by Sign and that timestamp is at most
+// tolerance away from now, as a receiver would.
+func Verify(secret string, timestamp int64, body []byte, signature string, tolerance time.Duration) bool {
+	age := time.Since(time.Unix(timestamp, 0))
+	if age > tolerance || age < -tolerance {
+		return false
+	}
+
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
@@ -0,0 +1,49 @@
+package webhook
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSignVerify(t *testing.T) {
+	const secret = "whsec_test"
+	body := []byte(`{"id":42,"event":"plagiarism.suspicious_pair","data":{"file_id":12}}`)
+	now := time.Now().Unix()
+	signature := Sign(secret, now, body)
+
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp int64
+		body      []byte
+		signature string
+		want      bool
+	}{
+		{"valid", secret, now, body, signature, true},
+		{"within tolerance", secret, now - 240, body, Sign(secret, now-240, body), true},
+		{"other secret", "whsec_other", now, body, signature, false},
+		{"changed body", secret, now, []byte(`{"id":43}`), signature, false},
+		{"changed timestamp", secret, now + 1, body, signature, false},
+		{"stale", secret, now - 600, body, Sign(secret, now-600, body), false},
+		{"from the future", secret, now + 600, body, Sign(secret, now+600, body), false},
+		{"without prefix", secret, now, body, signature[len("sha256="):], false},
+		{"empty", secret, now, body, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Verify(tt.secret, tt.timestamp, tt.body, tt.signature, 5*time.Minute); got != tt.want {
+				t.Errorf("Verify() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSignKnownAnswer(t *testing.T) {
+	// HMAC-SHA256 of "1700000000.{}" keyed with "secret", as a receiver in
+	// any other language computes it
+	const want = "sha256=b8569b78799ff9e3cbff0fc2d63a33a2b57f3282abd07c37ae5e8e7d79a5f163"
+	if got := Sign("secret", 1_700_000_000, []byte("{}")); got != want {
+		t.Errorf("Sign() = %q, want %q", got, want)
+	}
+}
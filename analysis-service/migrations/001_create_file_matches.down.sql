@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS file_matches;
+DROP TABLE IF EXISTS analysis_runs;
@@ -0,0 +1,16 @@
+-- files that were checked after a file.uploaded event, makes redelivered
+-- events a no-op
+CREATE TABLE IF NOT EXISTS analysis_runs (
+    file_id INTEGER PRIMARY KEY,
+    completed_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- an uploaded file and an earlier file of another student with the same content
+CREATE TABLE IF NOT EXISTS file_matches (
+    file_id INTEGER NOT NULL,
+    matched_file_id INTEGER NOT NULL,
+    detected_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (file_id, matched_file_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_file_matches_matched_file_id ON file_matches (matched_file_id);
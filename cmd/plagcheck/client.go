@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxRetries is how often a GET answered with 429 is repeated
+const maxRetries = 3
+
+// APIError is an error answered by the API in the envelope of
+// shared/apperror, or a reply that is not in it.
+type APIError struct {
+	Status    int
+	Code      string          `json:"code"`
+	Message   string          `json:"message"`
+	Details   json.RawMessage `json:"details"`
+	RequestID string          `json:"request_id"`
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("%s (%d %s)", e.Message, e.Status, e.Code)
+	if len(e.Details) > 0 && string(e.Details) != "null" {
+		msg += ": " + string(e.Details)
+	}
+	if e.RequestID != "" {
+		msg += ", request " + e.RequestID
+	}
+	return msg
+}
+
+// decodeError reads the error envelope of resp, falling back to the status
+// and the start of the body.
+func decodeError(resp *http.Response) error {
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+
+	var envelope struct {
+		Error *APIError `json:"error"`
+	}
+	if json.Unmarshal(data, &envelope) == nil && envelope.Error != nil && envelope.Error.Code != "" {
+		envelope.Error.Status = resp.StatusCode
+		return envelope.Error
+	}
+
+	message := strings.TrimSpace(string(data))
+	if len(message) > 200 {
+		message = message[:200] + "..."
+	}
+	if message == "" {
+		message = http.StatusText(resp.StatusCode)
+	}
+	return &APIError{Status: resp.StatusCode, Code: "unknown", Message: message}
+}
+
+type Client struct {
+	Server string
+	Token  string
+	HTTP   *http.Client
+}
+
+func NewClient(server, token string) *Client {
+	return &Client{
+		Server: strings.TrimRight(server, "/"),
+		Token:  token,
+		HTTP:   &http.Client{},
+	}
+}
+
+// do sends a request and returns the response if its status is 2xx. A GET
+// answered with 429 is repeated after Retry-After, so bulk scripts get
+// through the rate limits of the gateway.
+func (c *Client) do(ctx context.Context, method, path string, body io.Reader, contentType string) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, method, c.Server+path, body)
+		if err != nil {
+			return nil, err
+		}
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		if c.Token != "" {
+			req.Header.Set("Authorization", "Bearer "+c.Token)
+		}
+
+		resp, err := c.HTTP.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+			return resp, nil
+		}
+
+		if resp.StatusCode == http.StatusTooManyRequests && method == http.MethodGet && attempt < maxRetries {
+			resp.Body.Close()
+			wait := retryAfter(resp)
+			fmt.Fprintf(os.Stderr, "Rate limited, retrying in %s\n", wait)
+
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(wait):
+			}
+			continue
+		}
+
+		defer resp.Body.Close()
+		return nil, decodeError(resp)
+	}
+}
+
+func retryAfter(resp *http.Response) time.Duration {
+	seconds, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || seconds <= 0 {
+		return time.Second
+	}
+	return min(time.Duration(seconds)*time.Second, time.Minute)
+}
+
+// getJSON decodes the response of a GET into v.
+func (c *Client) getJSON(ctx context.Context, path string, v any) error {
+	resp, err := c.do(ctx, http.MethodGet, path, nil, "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("Failed to decode response of %s: %w", path, err)
+	}
+	return nil
+}
+
+type User struct {
+	ID                 string `json:"id"`
+	Username           string `json:"username"`
+	Role               string `json:"role"`
+	DisplayName        string `json:"display_name"`
+	Email              string `json:"email"`
+	MustChangePassword bool   `json:"must_change_password"`
+}
+
+type File struct {
+	ID        int    `json:"id"`
+	StudentID string `json:"student_id"`
+	Filename  string `json:"filename"`
+	FileSize  int64  `json:"file_size"`
+	FileHash  string `json:"file_hash"`
+	Course    string `json:"course,omitempty"`
+}
+
+type PlagiarismResult struct {
+	Hash  string `json:"hash"`
+	Count int    `json:"count"`
+	Files []File `json:"files"`
+}
+
+type LoginResponse struct {
+	Token              string `json:"token"`
+	MustChangePassword bool   `json:"must_change_password"`
+}
+
+func (c *Client) Login(ctx context.Context, username, password string) (*LoginResponse, error) {
+	body, err := json.Marshal(map[string]string{"username": username, "password": password})
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.do(ctx, http.MethodPost, "/auth/login", strings.NewReader(string(body)), "application/json")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var login LoginResponse
+	if err := json.NewDecoder(resp.Body).Decode(&login); err != nil {
+		return nil, fmt.Errorf("Failed to decode login response: %w", err)
+	}
+	return &login, nil
+}
+
+func (c *Client) Me(ctx context.Context) (*User, error) {
+	var user User
+	if err := c.getJSON(ctx, "/users/me", &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// Upload streams a file to the gateway without reading it into memory.
+func (c *Client) Upload(ctx context.Context, path, course string) (*File, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	pr, pw := io.Pipe()
+	form := multipart.NewWriter(pw)
+	go func() {
+		err := func() error {
+			if course != "" {
+				if err := form.WriteField("course", course); err != nil {
+					return err
+				}
+			}
+			part, err := form.CreateFormFile("file", filepath.Base(path))
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(part, file); err != nil {
+				return err
+			}
+			return form.Close()
+		}()
+		pw.CloseWithError(err)
+	}()
+
+	resp, err := c.do(ctx, http.MethodPost, "/files/upload", pr, form.FormDataContentType())
+	// unblocks the writer if the request failed before reading the body
+	pr.Close()
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		FileInfo File `json:"file_info"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("Failed to decode upload response: %w", err)
+	}
+	return &result.FileInfo, nil
+}
+
+func (c *Client) FilesByUser(ctx context.Context, userID string) ([]File, error) {
+	var result struct {
+		Files []File `json:"files"`
+	}
+	err := c.getJSON(ctx, "/files/user/"+url.PathEscape(userID), &result)
+	return result.Files, err
+}
+
+func (c *Client) FilesByHash(ctx context.Context, hash string) ([]File, error) {
+	var result struct {
+		Files []File `json:"files"`
+	}
+	err := c.getJSON(ctx, "/files/hash/"+url.PathEscape(hash), &result)
+	return result.Files, err
+}
+
+// Download returns the content of a file and its name from
+// Content-Disposition. The caller closes the reader.
+func (c *Client) Download(ctx context.Context, id int) (io.ReadCloser, string, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/files/download/"+strconv.Itoa(id), nil, "")
+	if err != nil {
+		return nil, "", err
+	}
+
+	name := strconv.Itoa(id)
+	if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition")); err == nil && params["filename"] != "" {
+		name = params["filename"]
+	}
+	return resp.Body, name, nil
+}
+
+func (c *Client) Plagiarism(ctx context.Context) ([]PlagiarismResult, error) {
+	var result struct {
+		Results []PlagiarismResult `json:"plagiarism_results"`
+	}
+	err := c.getJSON(ctx, "/analysis/plagiarism", &result)
+	return result.Results, err
+}
@@ -0,0 +1,423 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"golang.org/x/term"
+)
+
+func runLogin(ctx context.Context, a *app, fs *flag.FlagSet, args []string) error {
+	username := fs.String("u", "", "username")
+	passwordStdin := fs.Bool("password-stdin", false, "read the password from the first line of stdin")
+	fs.Parse(args)
+
+	if *username == "" || fs.NArg() > 0 {
+		return errUsage
+	}
+
+	password, err := readPassword(*passwordStdin)
+	if err != nil {
+		return err
+	}
+
+	login, err := NewClient(a.server, "").Login(ctx, *username, password)
+	if err != nil {
+		return err
+	}
+
+	session, err := parseToken(login.Token)
+	if err != nil {
+		return err
+	}
+
+	a.creds.Current = a.server
+	a.creds.Servers[a.server] = session
+	if err := a.creds.save(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Logged in to %s as %s (%s) until %s\n", a.server, session.Username, session.Role,
+		session.ExpiresAt.Local().Format(time.DateTime))
+	if login.MustChangePassword {
+		fmt.Fprintln(os.Stderr, "The password is one-time, change it with PATCH /users/me/password before it is used again")
+	}
+	return nil
+}
+
+// readPassword takes the password from PLAGCHECK_PASSWORD, stdin or a prompt
+// without echo, in that order.
+func readPassword(fromStdin bool) (string, error) {
+	if password := os.Getenv("PLAGCHECK_PASSWORD"); password != "" && !fromStdin {
+		return password, nil
+	}
+
+	if !fromStdin && term.IsTerminal(int(os.Stdin.Fd())) {
+		fmt.Fprint(os.Stderr, "Password: ")
+		password, err := term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", fmt.Errorf("Failed to read password: %w", err)
+		}
+		return string(password), nil
+	}
+
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", fmt.Errorf("Failed to read password: %w", err)
+	}
+	password := strings.TrimRight(line, "\r\n")
+	if password == "" {
+		return "", errors.New("No password given, use -password-stdin, PLAGCHECK_PASSWORD or a terminal")
+	}
+	return password, nil
+}
+
+func runLogout(ctx context.Context, a *app, fs *flag.FlagSet, args []string) error {
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		return errUsage
+	}
+
+	delete(a.creds.Servers, a.server)
+	if a.creds.Current == a.server {
+		a.creds.Current = ""
+	}
+	if err := a.creds.save(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Logged out of %s\n", a.server)
+	return nil
+}
+
+func runWhoami(ctx context.Context, a *app, fs *flag.FlagSet, args []string) error {
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		return errUsage
+	}
+
+	client, _, err := a.client()
+	if err != nil {
+		return err
+	}
+
+	user, err := client.Me(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Server:\t%s\n", a.server)
+	fmt.Fprintf(w, "ID:\t%s\n", user.ID)
+	fmt.Fprintf(w, "Username:\t%s\n", user.Username)
+	fmt.Fprintf(w, "Role:\t%s\n", user.Role)
+	if user.DisplayName != "" {
+		fmt.Fprintf(w, "Name:\t%s\n", user.DisplayName)
+	}
+	if user.Email != "" {
+		fmt.Fprintf(w, "Email:\t%s\n", user.Email)
+	}
+	return w.Flush()
+}
+
+func runUpload(ctx context.Context, a *app, fs *flag.FlagSet, args []string) error {
+	course := fs.String("course", "", "course code, webhooks of the course are notified about matches")
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		return errUsage
+	}
+
+	client, _, err := a.client()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tSIZE\tHASH\tFILENAME")
+
+	failed := 0
+	for _, path := range fs.Args() {
+		file, err := client.Upload(ctx, path, *course)
+		if err != nil {
+			// the rest is still uploaded, the exit status tells about it
+			fmt.Fprintf(os.Stderr, "plagcheck: %s: %v\n", path, err)
+			failed++
+			continue
+		}
+		fmt.Fprintf(w, "%d\t%d\t%s\t%s\n", file.ID, file.FileSize, file.FileHash, file.Filename)
+	}
+	w.Flush()
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d uploads failed", failed, fs.NArg())
+	}
+	return nil
+}
+
+// selectFiles lists the files of -user or -hash, the own files of the user
+// if both are empty.
+func selectFiles(ctx context.Context, client *Client, session *Session, userID, hash string) ([]File, error) {
+	switch {
+	case userID != "" && hash != "":
+		return nil, errUsage
+	case hash != "":
+		return client.FilesByHash(ctx, hash)
+	case userID != "":
+		return client.FilesByUser(ctx, userID)
+	default:
+		return client.FilesByUser(ctx, session.UserID)
+	}
+}
+
+func runFiles(ctx context.Context, a *app, fs *flag.FlagSet, args []string) error {
+	userID := fs.String("user", "", "ID of the user, yourself by default")
+	hash := fs.String("hash", "", "SHA-256 of the content (teachers)")
+	asJSON := fs.Bool("json", false, "print JSON")
+	fs.Parse(args)
+
+	if fs.NArg() > 0 {
+		return errUsage
+	}
+
+	client, session, err := a.client()
+	if err != nil {
+		return err
+	}
+
+	files, err := selectFiles(ctx, client, session, *userID, *hash)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		return printJSON(files)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tSTUDENT\tSIZE\tCOURSE\tHASH\tFILENAME")
+	for _, f := range files {
+		fmt.Fprintf(w, "%d\t%s\t%d\t%s\t%s\t%s\n", f.ID, f.StudentID, f.FileSize, f.Course, f.FileHash, f.Filename)
+	}
+	return w.Flush()
+}
+
+func runDownload(ctx context.Context, a *app, fs *flag.FlagSet, args []string) error {
+	dir := fs.String("o", ".", "directory to save the files in")
+	parallel := fs.Int("parallel", 4, "number of downloads at a time")
+	userID := fs.String("user", "", "download all files of this user")
+	hash := fs.String("hash", "", "download all files with this hash (teachers)")
+	fs.Parse(args)
+
+	bySelection := *userID != "" || *hash != ""
+	if bySelection == (fs.NArg() > 0) || *parallel <= 0 {
+		return errUsage
+	}
+
+	client, session, err := a.client()
+	if err != nil {
+		return err
+	}
+
+	var ids []int
+	if bySelection {
+		files, err := selectFiles(ctx, client, session, *userID, *hash)
+		if err != nil {
+			return err
+		}
+		for _, f := range files {
+			ids = append(ids, f.ID)
+		}
+	} else {
+		for _, arg := range fs.Args() {
+			id, err := strconv.Atoi(arg)
+			if err != nil {
+				return fmt.Errorf("Invalid file ID %q", arg)
+			}
+			ids = append(ids, id)
+		}
+	}
+
+	if err := os.MkdirAll(*dir, 0o755); err != nil {
+		return fmt.Errorf("Failed to create %s: %w", *dir, err)
+	}
+
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		failed int
+		slots  = make(chan struct{}, *parallel)
+	)
+	for _, id := range ids {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			path, err := download(ctx, client, id, *dir)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "plagcheck: file %d: %v\n", id, err)
+				failed++
+				return
+			}
+			fmt.Println(path)
+		}()
+	}
+	wg.Wait()
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d downloads failed", failed, len(ids))
+	}
+	return nil
+}
+
+// download saves a file as "<id>_<filename>" in dir, the id keeps files of
+// different students with the same name apart. The file only appears once it
+// is complete.
+func download(ctx context.Context, client *Client, id int, dir string) (string, error) {
+	body, name, err := client.Download(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+
+	// the name comes from the server and must not leave dir
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	if name == "." || name == ".." || name == "/" {
+		name = "file"
+	}
+	path := filepath.Join(dir, fmt.Sprintf("%d_%s", id, name))
+
+	tmp, err := os.CreateTemp(dir, ".download-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, body); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("Failed to download: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+func runCheck(ctx context.Context, a *app, fs *flag.FlagSet, args []string) error {
+	asJSON := fs.Bool("json", false, "print JSON")
+	fs.Parse(args)
+
+	if fs.NArg() > 0 {
+		return errUsage
+	}
+
+	client, _, err := a.client()
+	if err != nil {
+		return err
+	}
+
+	results, err := client.Plagiarism(ctx)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		return printJSON(results)
+	}
+
+	if len(results) == 0 {
+		fmt.Println("No files are shared between students")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for i, group := range results {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "%s\t%d students\n", group.Hash, group.Count)
+		for _, f := range group.Files {
+			fmt.Fprintf(w, "  %d\t%s\t%s\n", f.ID, f.StudentID, f.Filename)
+		}
+	}
+	return w.Flush()
+}
+
+func runReport(ctx context.Context, a *app, fs *flag.FlagSet, args []string) error {
+	format := fs.String("format", "csv", "csv or json")
+	output := fs.String("o", "", "file to write, stdout by default")
+	fs.Parse(args)
+
+	if fs.NArg() > 0 || (*format != "csv" && *format != "json") {
+		return errUsage
+	}
+
+	client, _, err := a.client()
+	if err != nil {
+		return err
+	}
+
+	results, err := client.Plagiarism(ctx)
+	if err != nil {
+		return err
+	}
+
+	out := os.Stdout
+	if *output != "" {
+		out, err = os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+	}
+
+	report := &Report{
+		GeneratedAt: time.Now().UTC(),
+		Server:      a.server,
+		Groups:      results,
+	}
+	if *format == "json" {
+		err = report.WriteJSON(out)
+	} else {
+		err = report.WriteCSV(out)
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to write report: %w", err)
+	}
+
+	if *output != "" {
+		if err := out.Close(); err != nil {
+			return fmt.Errorf("Failed to write report: %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "Wrote %d groups to %s\n", len(results), *output)
+	}
+	return nil
+}
+
+func printJSON(v any) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
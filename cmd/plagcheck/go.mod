@@ -0,0 +1,7 @@
+module github.com/KEPTANy/plag-check/cmd/plagcheck
+
+go 1.25.5
+
+require golang.org/x/term v0.43.0
+
+require golang.org/x/sys v0.44.0 // indirect
@@ -0,0 +1,153 @@
+// Command plagcheck is a command-line client of the plagiarism check API for
+// scripting uploads, bulk downloads and plagiarism reports. It talks to
+// gateway-api only and keeps the token of the last login per server:
+//
+//	plagcheck login -u teacher
+//	plagcheck files -hash 9f86d0...
+//	plagcheck download -user 0b5c... -o ./solutions
+//	plagcheck report -format csv -o report.csv
+//
+// Run plagcheck help for all commands.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const defaultServer = "http://localhost:8080"
+
+// errUsage makes main print the usage of the command
+var errUsage = errors.New("invalid usage")
+
+type command struct {
+	name    string
+	args    string
+	summary string
+	run     func(ctx context.Context, a *app, fs *flag.FlagSet, args []string) error
+}
+
+var commands = []*command{
+	{"login", "-u USERNAME [-password-stdin]", "Log in and cache the token", runLogin},
+	{"logout", "", "Forget the cached token of the server", runLogout},
+	{"whoami", "", "Show the logged in user", runWhoami},
+	{"upload", "[-course CODE] FILE...", "Upload solutions (students)", runUpload},
+	{"files", "[-user ID | -hash HASH] [-json]", "List files of a user, yourself by default, or with a hash", runFiles},
+	{"download", "[-o DIR] [-parallel N] (-user ID | -hash HASH | FILE_ID...)", "Download files", runDownload},
+	{"check", "[-json]", "Run a plagiarism check and show groups of identical files (teachers)", runCheck},
+	{"report", "[-format csv|json] [-o FILE]", "Export the plagiarism report (teachers)", runReport},
+}
+
+type app struct {
+	// server is the gateway URL from -server, PLAGCHECK_SERVER, the last
+	// login or defaultServer, in that order
+	server string
+	creds  *Credentials
+}
+
+// client returns a client with the cached token of the server, or with
+// PLAGCHECK_TOKEN if set, e.g. in CI.
+func (a *app) client() (*Client, *Session, error) {
+	if token := os.Getenv("PLAGCHECK_TOKEN"); token != "" {
+		session, err := parseToken(token)
+		if err != nil {
+			return nil, nil, fmt.Errorf("PLAGCHECK_TOKEN: %w", err)
+		}
+		return NewClient(a.server, token), session, nil
+	}
+
+	session := a.creds.Servers[a.server]
+	if session == nil {
+		return nil, nil, fmt.Errorf("Not logged in to %s, run plagcheck login", a.server)
+	}
+	if time.Now().After(session.ExpiresAt) {
+		return nil, nil, fmt.Errorf("Session of %s expired at %s, run plagcheck login",
+			session.Username, session.ExpiresAt.Format(time.RFC3339))
+	}
+
+	return NewClient(a.server, session.Token), session, nil
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: plagcheck [-server URL] COMMAND [FLAGS]\n\nCommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-9s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun plagcheck COMMAND -h for the flags of a command.\n")
+	fmt.Fprintf(os.Stderr, "The server defaults to $PLAGCHECK_SERVER, the server of the last login or %s.\n", defaultServer)
+}
+
+func main() {
+	global := flag.NewFlagSet("plagcheck", flag.ExitOnError)
+	global.Usage = usage
+	server := global.String("server", "", "URL of gateway-api")
+	global.Parse(os.Args[1:])
+
+	args := global.Args()
+	if len(args) == 0 || args[0] == "help" {
+		usage()
+		os.Exit(2)
+	}
+
+	var cmd *command
+	for _, c := range commands {
+		if c.name == args[0] {
+			cmd = c
+		}
+	}
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "plagcheck: unknown command %q\n\n", args[0])
+		usage()
+		os.Exit(2)
+	}
+
+	creds, err := loadCredentials()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "plagcheck: %v\n", err)
+		os.Exit(1)
+	}
+
+	a := &app{server: *server, creds: creds}
+	if a.server == "" {
+		a.server = os.Getenv("PLAGCHECK_SERVER")
+	}
+	if a.server == "" {
+		a.server = creds.Current
+	}
+	if a.server == "" {
+		a.server = defaultServer
+	}
+	a.server = strings.TrimRight(a.server, "/")
+
+	fs := flag.NewFlagSet("plagcheck "+cmd.name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: plagcheck %s %s\n\n%s\n", cmd.name, cmd.args, cmd.summary)
+		fs.PrintDefaults()
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	err = cmd.run(ctx, a, fs, args[1:])
+	if errors.Is(err, errUsage) {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "plagcheck: %v\n", err)
+
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && apiErr.Status == http.StatusUnauthorized && cmd.name != "login" {
+			fmt.Fprintf(os.Stderr, "Run plagcheck login to log in again\n")
+		}
+		os.Exit(1)
+	}
+}
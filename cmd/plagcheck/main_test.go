@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func fakeToken(t *testing.T, claims map[string]any) string {
+	t.Helper()
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return "eyJhbGciOiJIUzI1NiJ9." + base64.RawURLEncoding.EncodeToString(payload) + ".signature"
+}
+
+func TestLoginCachesToken(t *testing.T) {
+	expires := time.Now().Add(time.Hour).Truncate(time.Second)
+	token := fakeToken(t, map[string]any{
+		"user_id": "0b5c", "username": "alice", "role": "teacher", "exp": expires.Unix(),
+	})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /auth/login", func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]string
+		json.NewDecoder(r.Body).Decode(&req)
+		if req["username"] != "alice" || req["password"] != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":{"code":"unauthorized","message":"invalid credentials"}}`))
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"token": token})
+	})
+	mux.HandleFunc("GET /users/me", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+token {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"id": "0b5c", "username": "alice", "role": "teacher"})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	t.Setenv("PLAGCHECK_CREDENTIALS", filepath.Join(t.TempDir(), "plagcheck", "credentials.json"))
+	t.Setenv("PLAGCHECK_PASSWORD", "secret")
+	t.Setenv("PLAGCHECK_TOKEN", "")
+
+	creds, err := loadCredentials()
+	if err != nil {
+		t.Fatalf("loadCredentials() error = %v", err)
+	}
+	a := &app{server: server.URL, creds: creds}
+	if err := runLogin(context.Background(), a, flag.NewFlagSet("login", flag.ContinueOnError), []string{"-u", "alice"}); err != nil {
+		t.Fatalf("runLogin() error = %v", err)
+	}
+
+	// a later run reads the session from disk
+	creds, err = loadCredentials()
+	if err != nil {
+		t.Fatalf("loadCredentials() error = %v", err)
+	}
+	if creds.Current != server.URL {
+		t.Errorf("current server = %q, want %q", creds.Current, server.URL)
+	}
+
+	client, session, err := (&app{server: server.URL, creds: creds}).client()
+	if err != nil {
+		t.Fatalf("client() error = %v", err)
+	}
+	if session.Username != "alice" || session.Role != "teacher" || !session.ExpiresAt.Equal(expires) {
+		t.Errorf("session = %+v, want alice as teacher until %s", session, expires)
+	}
+
+	user, err := client.Me(context.Background())
+	if err != nil {
+		t.Fatalf("Me() with the cached token error = %v", err)
+	}
+	if user.Username != "alice" {
+		t.Errorf("Me() = %+v, want alice", user)
+	}
+
+	path, _ := credentialsPath()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode&0o077 != 0 {
+		t.Errorf("credentials mode = %v, want readable by the user only", mode)
+	}
+}
+
+func TestParseToken(t *testing.T) {
+	session, err := parseToken(fakeToken(t, map[string]any{
+		"user_id": "0b5c", "username": "alice", "role": "student", "exp": 1700000000,
+	}))
+	if err != nil {
+		t.Fatalf("parseToken() error = %v", err)
+	}
+	if session.UserID != "0b5c" || session.Username != "alice" || session.Role != "student" ||
+		!session.ExpiresAt.Equal(time.Unix(1700000000, 0)) {
+		t.Errorf("parseToken() = %+v", session)
+	}
+
+	for _, token := range []string{
+		"",
+		"not-a-jwt",
+		"a.b",
+		"a.!!!.c",
+		"a." + base64.RawURLEncoding.EncodeToString([]byte("not json")) + ".c",
+	} {
+		if _, err := parseToken(token); err == nil {
+			t.Errorf("parseToken(%q) succeeded", token)
+		}
+	}
+}
+
+func TestDownloadSanitizesFilename(t *testing.T) {
+	tests := []struct {
+		disposition string
+		want        string
+	}{
+		{`attachment; filename="report.txt"`, "7_report.txt"},
+		{`attachment; filename="../x"`, "7_x"},
+		{`attachment; filename*=UTF-8''a%5Cb`, "7_b"},
+		{`attachment; filename=".."`, "7_file"},
+		{``, "7_7"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.disposition, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/files/download/7" {
+					http.NotFound(w, r)
+					return
+				}
+				if tt.disposition != "" {
+					w.Header().Set("Content-Disposition", tt.disposition)
+				}
+				w.Write([]byte("content"))
+			}))
+			defer server.Close()
+
+			dir := t.TempDir()
+			path, err := download(context.Background(), NewClient(server.URL, "token"), 7, dir)
+			if err != nil {
+				t.Fatalf("download() error = %v", err)
+			}
+
+			if want := filepath.Join(dir, tt.want); path != want {
+				t.Errorf("download() = %q, want %q", path, want)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil || string(data) != "content" {
+				t.Errorf("saved %q, %v, want the content", data, err)
+			}
+
+			entries, _ := os.ReadDir(dir)
+			if len(entries) != 1 {
+				t.Errorf("%d files in the directory, want only the download", len(entries))
+			}
+		})
+	}
+}
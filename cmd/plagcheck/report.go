@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"time"
+)
+
+var reportCSVHeader = []string{
+	"hash", "students", "file_id", "student_id", "filename", "file_size", "course",
+}
+
+// Report is an exported plagiarism check: groups of identical files uploaded
+// by more than one student.
+type Report struct {
+	GeneratedAt time.Time          `json:"generated_at"`
+	Server      string             `json:"server"`
+	Groups      []PlagiarismResult `json:"groups"`
+}
+
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteCSV writes a row per file, files of a group share the hash.
+func (r *Report) WriteCSV(w io.Writer) error {
+	out := csv.NewWriter(w)
+	out.Write(reportCSVHeader)
+
+	for _, group := range r.Groups {
+		for _, f := range group.Files {
+			out.Write([]string{
+				group.Hash, strconv.Itoa(group.Count), strconv.Itoa(f.ID), f.StudentID,
+				f.Filename, strconv.FormatInt(f.FileSize, 10), f.Course,
+			})
+		}
+	}
+
+	out.Flush()
+	return out.Error()
+}
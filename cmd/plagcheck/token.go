@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Session is a cached login, the claims are read from the token without
+// verifying it, only the gateway can do that.
+type Session struct {
+	Token     string    `json:"token"`
+	UserID    string    `json:"user_id"`
+	Username  string    `json:"username"`
+	Role      string    `json:"role"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Credentials are kept per server, Current is the server of the last login
+// and the default for later commands.
+type Credentials struct {
+	Current string              `json:"current"`
+	Servers map[string]*Session `json:"servers"`
+}
+
+// credentialsPath is $PLAGCHECK_CREDENTIALS or credentials.json in the user
+// config directory, e.g. ~/.config/plagcheck on Linux.
+func credentialsPath() (string, error) {
+	if path := os.Getenv("PLAGCHECK_CREDENTIALS"); path != "" {
+		return path, nil
+	}
+
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("Failed to find config directory: %w", err)
+	}
+	return filepath.Join(dir, "plagcheck", "credentials.json"), nil
+}
+
+func loadCredentials() (*Credentials, error) {
+	creds := &Credentials{Servers: make(map[string]*Session)}
+
+	path, err := credentialsPath()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return creds, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read credentials: %w", err)
+	}
+
+	if err := json.Unmarshal(data, creds); err != nil {
+		return nil, fmt.Errorf("Failed to parse %s: %w", path, err)
+	}
+	if creds.Servers == nil {
+		creds.Servers = make(map[string]*Session)
+	}
+	return creds, nil
+}
+
+// save writes the credentials readable by the user only, through a
+// temporary file so a crash does not leave them half written.
+func (c *Credentials) save() error {
+	path, err := credentialsPath()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("Failed to create config directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".credentials-*")
+	if err != nil {
+		return fmt.Errorf("Failed to save credentials: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("Failed to save credentials: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("Failed to save credentials: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("Failed to save credentials: %w", err)
+	}
+	return nil
+}
+
+// parseToken reads the claims of a JWT issued by user-service.
+func parseToken(token string) (*Session, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("Token is not a JWT")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("Failed to decode token: %w", err)
+	}
+
+	var claims struct {
+		UserID   string `json:"user_id"`
+		Username string `json:"username"`
+		Role     string `json:"role"`
+		Exp      int64  `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("Failed to decode token claims: %w", err)
+	}
+
+	return &Session{
+		Token:     token,
+		UserID:    claims.UserID,
+		Username:  claims.Username,
+		Role:      claims.Role,
+		ExpiresAt: time.Unix(claims.Exp, 0),
+	}, nil
+}
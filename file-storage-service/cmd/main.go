@@ -5,8 +5,6 @@ import (
 	"log"
 	"net/http"
 	"os"
-	"os/signal"
-	"syscall"
 	"time"
 
 	"github.com/KEPTANy/plag-check/file-storage-service/internal/config"
@@ -15,43 +13,85 @@ import (
 	"github.com/KEPTANy/plag-check/file-storage-service/internal/repository"
 	"github.com/KEPTANy/plag-check/file-storage-service/internal/service"
 	"github.com/KEPTANy/plag-check/file-storage-service/internal/storage"
+	"github.com/KEPTANy/plag-check/file-storage-service/migrations"
+	"github.com/KEPTANy/plag-check/shared/audit"
+	auditMigrations "github.com/KEPTANy/plag-check/shared/audit/migrations"
+	"github.com/KEPTANy/plag-check/shared/bootstrap"
+	"github.com/KEPTANy/plag-check/shared/events"
+	eventsMigrations "github.com/KEPTANy/plag-check/shared/events/migrations"
+	"github.com/KEPTANy/plag-check/shared/health"
+	"github.com/KEPTANy/plag-check/shared/logging"
 	"github.com/KEPTANy/plag-check/shared/middleware"
-	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/KEPTANy/plag-check/shared/migrate"
+	"github.com/KEPTANy/plag-check/shared/tracing"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 func main() {
+	logging.Setup("file-storage-service")
+
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := bootstrap.MigrateCommand("file-storage-service", migrations.FS, os.Args[2:]); err != nil {
+			log.Fatalf("Failed to migrate: %v", err)
+		}
+		return
+	}
+
+	shutdownTracing, err := tracing.Setup(context.Background(), "file-storage-service")
+	if err != nil {
+		log.Fatalf("Failed to set up tracing: %v", err)
+	}
+
 	var cfg config.Config
-	err := cfg.Load()
+	err = cfg.Load()
 	if err != nil {
 		log.Fatalf("Failed to load config: %v", err)
 	}
 
-	db, err := repository.NewPgRepository(cfg.DatabaseURL)
+	app := bootstrap.New(cfg.Lifecycle)
+	app.OnShutdown(shutdownTracing)
+
+	db, err := repository.NewPgRepository(context.Background(), cfg.Database)
 	if err != nil {
 		log.Fatalf("Failed to connect to db: %v", err)
 	}
-	defer db.Close()
+	app.OnShutdown(func(context.Context) error {
+		db.Close()
+		return nil
+	})
 
-	if err := runMigrations(db.GetPool()); err != nil {
-		log.Printf("WARNING! Failed to run migrations: %v", err)
+	if err := migrate.Up(context.Background(), db.GetPool(), "file-storage-service", migrations.FS); err != nil {
+		log.Fatalf("Failed to run migrations: %v", err)
+	}
+	if err := migrate.Up(context.Background(), db.GetPool(), "audit", auditMigrations.FS); err != nil {
+		log.Fatalf("Failed to run audit log migrations: %v", err)
+	}
+	auditLog := audit.New(db.GetPool(), "file-storage-service")
+	if err := migrate.Up(context.Background(), db.GetPool(), "events", eventsMigrations.FS); err != nil {
+		log.Fatalf("Failed to run event outbox migrations: %v", err)
 	}
+	publisher := events.NewPublisher(db.GetPool(), "file-storage-service")
 
 	fileRepo := repository.NewFileRepository(db)
 	fileStorage, err := storage.NewStorage(cfg.StorageRoot, cfg.MaxFileSize)
 	if err != nil {
 		log.Fatalf("Failed to init storage: %v", err)
 	}
-	fileService := service.NewFileStorageService(fileRepo, fileStorage)
+	fileService := service.NewFileStorageService(fileRepo, fileStorage, db, publisher)
 
-	healthHandler := handler.NewHealthHandler()
-	fileHandler := handler.NewFileStorageHandler(fileService)
+	healthHandler := health.NewHandler(map[string]health.Check{
+		"serving":  app.CheckReady,
+		"postgres": db.GetPool().Ping,
+		"storage":  fileStorage.CheckWritable,
+	})
+	fileHandler := handler.NewFileStorageHandler(fileService, auditLog)
 
 	mux := http.NewServeMux()
 
-	mux.Handle("GET /health", http.HandlerFunc(healthHandler.Health))
+	mux.Handle("GET /health", healthHandler)
 
 	baseChain := middleware.Chain(
-		intMiddleware.AuthMiddleware(cfg.JWTSecret),
+		intMiddleware.AuthMiddleware(cfg.JWTSecret, cfg.IdentitySecret),
 	)
 
 	studentChain := middleware.Chain(
@@ -80,9 +120,13 @@ func main() {
 		teacherChain(http.HandlerFunc(fileHandler.ListFilesByHash)))
 
 	handler := middleware.Chain(
+		middleware.RequestIDMiddleware,
+		middleware.ClientIP(cfg.TrustedProxies),
+		middleware.TracingMiddleware,
 		middleware.RecoveringMiddleware,
 		middleware.LoggingMiddleware,
-	)(mux)
+		middleware.MetricsMiddleware,
+	)(middleware.PatternMiddleware(mux))
 
 	server := &http.Server{
 		Addr:         ":" + cfg.Port,
@@ -92,59 +136,24 @@ func main() {
 		IdleTimeout:  60 * time.Second,
 	}
 
-	go func() {
-		log.Printf("User service starting on port: %v", cfg.Port)
-		if err := server.ListenAndServe(); err != nil {
-			log.Fatalf("Failed to start server: %v", err)
-		}
-	}()
-
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
-	log.Println("Shutting down server...")
-
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	if err := server.Shutdown(ctx); err != nil {
-		log.Fatal("Server forced to shutdown:", err)
-	}
-
-	log.Println("Server exited properly")
-}
-
-func runMigrations(pool *pgxpool.Pool) error {
-	ctx := context.Background()
-
-	var tableExists bool
-	err := pool.QueryRow(ctx, `
-        SELECT EXISTS (
-            SELECT FROM information_schema.tables 
-            WHERE table_schema = 'public' 
-            AND table_name = 'files'
-        )
-    `).Scan(&tableExists)
-
-	if err != nil {
-		return err
+	adminMux := http.NewServeMux()
+	adminMux.Handle("GET /metrics", promhttp.Handler())
+
+	adminServer := &http.Server{
+		Addr: ":" + cfg.AdminPort,
+		Handler: middleware.Chain(
+			middleware.RequestIDMiddleware,
+			middleware.RecoveringMiddleware,
+			middleware.LoggingMiddleware,
+		)(adminMux),
+		ReadHeaderTimeout: 10 * time.Second,
 	}
 
-	if !tableExists {
-		log.Println("Running database migrations...")
-
-		migrationSQL, err := os.ReadFile("migrations/001_create_files_table.up.sql")
-		if err != nil {
-			return err
-		}
-
-		_, err = pool.Exec(ctx, string(migrationSQL))
-		if err != nil {
-			return err
-		}
+	app.Serve(server)
+	app.Serve(adminServer)
 
-		log.Println("Database migrations completed")
+	log.Printf("File storage service starting on port: %v, admin API on port: %v", cfg.Port, cfg.AdminPort)
+	if err := app.Run(); err != nil {
+		log.Fatalf("Service stopped: %v", err)
 	}
-
-	return nil
 }
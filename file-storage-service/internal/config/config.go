@@ -1,77 +1,45 @@
 package config
 
 import (
-	"errors"
-	"fmt"
-	"os"
-	"strconv"
+	"net/netip"
+
+	"github.com/KEPTANy/plag-check/shared/bootstrap"
 )
 
 type Config struct {
 	Port        string
-	DatabaseURL string
+	AdminPort   string
+	Database    bootstrap.Database
+	Lifecycle   bootstrap.Lifecycle
 	StorageRoot string
 	MaxFileSize int64
 	JWTSecret   string
-}
-
-func getDatabaseURL() (string, error) {
-	host, ok := os.LookupEnv("DB_HOST")
-	if !ok {
-		return "", errors.New("Failed to load DB_HOST variable")
-	}
-
-	port, ok := os.LookupEnv("DB_PORT")
-	if !ok {
-		return "", errors.New("Failed to load DB_PORT variable")
-	}
 
-	user, ok := os.LookupEnv("DB_USER")
-	if !ok {
-		return "", errors.New("Failed to load DB_USER variable")
-	}
+	// IdentitySecret verifies the identity header signed by the gateway
+	IdentitySecret string
 
-	password, ok := os.LookupEnv("DB_PASSWORD")
-	if !ok {
-		return "", errors.New("Failed to load DB_PASSWORD variable")
-	}
-
-	name, ok := os.LookupEnv("DB_NAME")
-	if !ok {
-		return "", errors.New("Failed to load DB_NAME variable")
-	}
-
-	return fmt.Sprintf("postgresql://%s:%s@%s:%s/%s", user, password, host, port, name), nil
+	// TrustedProxies may set X-Forwarded-For, see middleware.ClientIP
+	TrustedProxies []netip.Prefix
 }
 
 func (c *Config) Load() error {
-	var ok bool
-
-	c.Port, ok = os.LookupEnv("PORT")
-	if !ok {
-		return errors.New("Failed to load PORT variable")
-	}
+	var env bootstrap.Env
 
-	var err error
-	c.DatabaseURL, err = getDatabaseURL()
-	if err != nil {
-		return err
-	}
+	c.Port = env.Required("PORT")
+	// metrics are not behind authentication and must not be published
+	c.AdminPort = env.String("ADMIN_PORT", "9092")
+	c.Database = bootstrap.LoadDatabase(&env)
+	c.Lifecycle = bootstrap.LoadLifecycle(&env)
 
-	c.StorageRoot, ok = os.LookupEnv("STORAGE_ROOT")
-	if !ok {
-		return errors.New("Failed to load STORAGE_ROOT variable")
-	}
+	// the gateway, whose X-Forwarded-For names the client
+	c.TrustedProxies = env.Networks("TRUSTED_PROXIES", nil)
 
-	c.MaxFileSize, err = strconv.ParseInt(os.Getenv("MAX_FILE_SIZE"), 10, 64)
-	if err != nil {
-		return errors.New("Failed to load MAX_FILE_SIZE variable")
-	}
+	c.StorageRoot = env.Required("STORAGE_ROOT")
+	c.MaxFileSize = env.Int64("MAX_FILE_SIZE", 64<<20)
+	env.Positive("MAX_FILE_SIZE", c.MaxFileSize)
 
-	c.JWTSecret, ok = os.LookupEnv("JWT_SECRET")
-	if !ok {
-		return errors.New("Failed to load JWT_SECRET variable")
-	}
+	c.JWTSecret = env.Required("JWT_SECRET")
+	c.IdentitySecret = env.String("INTERNAL_IDENTITY_SECRET", "")
 
-	return nil
+	return env.Err()
 }
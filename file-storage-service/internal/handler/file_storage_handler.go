@@ -5,54 +5,67 @@ import (
 	"io"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/KEPTANy/plag-check/file-storage-service/internal/middleware"
 	"github.com/KEPTANy/plag-check/file-storage-service/internal/service"
+	"github.com/KEPTANy/plag-check/shared/apperror"
+	"github.com/KEPTANy/plag-check/shared/audit"
 	"github.com/gofrs/uuid/v5"
 )
 
+// maxCourseLength matches the course column of the files table
+const maxCourseLength = 100
+
 type FileStorageHandler struct {
 	FileStorageService service.FileStorageService
+	Audit              *audit.Log
 	MaxFileSize        int64
 }
 
-func NewFileStorageHandler(service service.FileStorageService) *FileStorageHandler {
-	return &FileStorageHandler{FileStorageService: service}
+func NewFileStorageHandler(service service.FileStorageService, auditLog *audit.Log) *FileStorageHandler {
+	return &FileStorageHandler{FileStorageService: service, Audit: auditLog}
 }
 
 func (h *FileStorageHandler) Upload(w http.ResponseWriter, r *http.Request) {
 	userID, ok := middleware.GetUserIDFromContext(r.Context())
 	if !ok {
-		http.Error(w, `{"error": "unauthorized"}`, http.StatusUnauthorized)
+		apperror.Write(w, r, apperror.Unauthorized("unauthorized"))
 		return
 	}
 
 	role, ok := middleware.GetRoleFromContext(r.Context())
 	if !ok {
-		http.Error(w, `{"error": "unauthorized"}`, http.StatusUnauthorized)
+		apperror.Write(w, r, apperror.Unauthorized("unauthorized"))
 		return
 	}
 
 	if role != "student" {
-		http.Error(w, `{"error": "only students can upload solutions"}`, http.StatusForbidden)
+		apperror.Write(w, r, apperror.Forbidden("only students can upload solutions"))
 		return
 	}
 
 	if err := r.ParseMultipartForm(h.MaxFileSize); err != nil {
-		http.Error(w, `{"error": "failed to parse form"}`, http.StatusBadRequest)
+		apperror.Write(w, r, apperror.Validation("failed to parse form").Wrap(err))
+		return
+	}
+
+	course := strings.TrimSpace(r.FormValue("course"))
+	if len(course) > maxCourseLength {
+		apperror.Write(w, r, apperror.Validation("course must be at most 100 characters"))
 		return
 	}
 
 	file, header, err := r.FormFile("file")
 	if err != nil {
-		http.Error(w, `{"error": "file is required"}`, http.StatusBadRequest)
+		apperror.Write(w, r, apperror.Validation("file is required").Wrap(err))
 		return
 	}
 	defer file.Close()
 
-	fileData, err := h.FileStorageService.UploadFile(r.Context(), userID, file, header)
+	fileData, err := h.FileStorageService.UploadFile(r.Context(), userID, course, file, header)
 	if err != nil {
-		http.Error(w, `{"error": "failed to upload file"}`, http.StatusBadRequest)
+		apperror.Write(w, r, err)
 		return
 	}
 
@@ -65,31 +78,53 @@ func (h *FileStorageHandler) Download(w http.ResponseWriter, r *http.Request) {
 	fileIDStr := r.PathValue("id")
 	fileID, err := strconv.Atoi(fileIDStr)
 	if err != nil {
-		http.Error(w, `{"error": "invalid solution ID"}`, http.StatusBadRequest)
+		apperror.Write(w, r, apperror.Validation("invalid solution ID"))
 		return
 	}
 
 	userID, ok := middleware.GetUserIDFromContext(r.Context())
 	if !ok {
-		http.Error(w, `{"error": "unauthorized"}`, http.StatusUnauthorized)
+		apperror.Write(w, r, apperror.Unauthorized("unauthorized"))
 		return
 	}
 
 	role, ok := middleware.GetRoleFromContext(r.Context())
 	if !ok {
-		http.Error(w, `{"error": "unauthorized"}`, http.StatusUnauthorized)
+		apperror.Write(w, r, apperror.Unauthorized("unauthorized"))
 		return
 	}
 
 	fileInfo, file, err := h.FileStorageService.DownloadFile(r.Context(), fileID)
 	if err != nil {
-		http.Error(w, `{"error": "forbiden access"}`, http.StatusForbidden)
+		apperror.Write(w, r, err)
 		return
 	}
 	defer file.Close()
 
+	event := audit.Event{
+		ActorID:      userID,
+		ActorRole:    role,
+		Action:       audit.ActionFileDownload,
+		ResourceType: "file",
+		ResourceID:   strconv.Itoa(fileInfo.ID),
+		Outcome:      audit.OutcomeSuccess,
+		Details: map[string]any{
+			"student_id": fileInfo.StudentID,
+			"filename":   fileInfo.Filename,
+		},
+	}
+
 	if role != "teacher" && userID != fileInfo.StudentID {
-		http.Error(w, `{"error": "forbiden access"}`, http.StatusForbidden)
+		event.Outcome = audit.OutcomeDenied
+		h.Audit.Record(r.Context(), event)
+
+		apperror.Write(w, r, apperror.Forbidden("the file belongs to another student"))
+		return
+	}
+
+	// a download that cannot be recorded is refused
+	if err := h.Audit.Record(r.Context(), event); err != nil {
+		apperror.Write(w, r, apperror.Internal(err))
 		return
 	}
 
@@ -102,30 +137,30 @@ func (h *FileStorageHandler) Download(w http.ResponseWriter, r *http.Request) {
 func (h *FileStorageHandler) ListUserFiles(w http.ResponseWriter, r *http.Request) {
 	userID, ok := middleware.GetUserIDFromContext(r.Context())
 	if !ok {
-		http.Error(w, `{"error": "unauthorized"}`, http.StatusUnauthorized)
+		apperror.Write(w, r, apperror.Unauthorized("unauthorized"))
 		return
 	}
 
 	role, ok := middleware.GetRoleFromContext(r.Context())
 	if !ok {
-		http.Error(w, `{"error": "unauthorized"}`, http.StatusUnauthorized)
+		apperror.Write(w, r, apperror.Unauthorized("unauthorized"))
 		return
 	}
 
 	reqUserID, err := uuid.FromString((r.PathValue("userid")))
 	if err != nil {
-		http.Error(w, `{"error": "bad user id"}`, http.StatusBadRequest)
+		apperror.Write(w, r, apperror.Validation("bad user id"))
 		return
 	}
 
 	if role != "teacher" && userID != reqUserID {
-		http.Error(w, `{"error": "forbiden access"}`, http.StatusForbidden)
+		apperror.Write(w, r, apperror.Forbidden("students can only list their own files"))
 		return
 	}
 
 	files, err := h.FileStorageService.ListFilesByUser(r.Context(), reqUserID)
 	if err != nil {
-		http.Error(w, `{"error": "internal error"}`, http.StatusInternalServerError)
+		apperror.Write(w, r, err)
 		return
 	}
 
@@ -137,26 +172,26 @@ func (h *FileStorageHandler) ListUserFiles(w http.ResponseWriter, r *http.Reques
 func (h *FileStorageHandler) ListFilesByHash(w http.ResponseWriter, r *http.Request) {
 	_, ok := middleware.GetUserIDFromContext(r.Context())
 	if !ok {
-		http.Error(w, `{"error": "unauthorized"}`, http.StatusUnauthorized)
+		apperror.Write(w, r, apperror.Unauthorized("unauthorized"))
 		return
 	}
 
 	role, ok := middleware.GetRoleFromContext(r.Context())
 	if !ok {
-		http.Error(w, `{"error": "unauthorized"}`, http.StatusUnauthorized)
+		apperror.Write(w, r, apperror.Unauthorized("unauthorized"))
 		return
 	}
 
 	hash := r.PathValue("hash")
 
 	if role != "teacher" {
-		http.Error(w, `{"error": "forbiden access"}`, http.StatusForbidden)
+		apperror.Write(w, r, apperror.Forbidden("only teachers can search files by hash"))
 		return
 	}
 
 	files, err := h.FileStorageService.ListFilesByHash(r.Context(), hash)
 	if err != nil {
-		http.Error(w, `{"error": "internal error"}`, http.StatusInternalServerError)
+		apperror.Write(w, r, err)
 		return
 	}
 
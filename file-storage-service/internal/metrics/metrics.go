@@ -0,0 +1,28 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	// FilesUploaded counts uploads by whether the content was new or already
+	// stored under the same hash
+	FilesUploaded = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "files_uploaded_total",
+		Help: "Uploaded files by result: new or duplicate content.",
+	}, []string{"result"})
+
+	UploadSize = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "file_upload_size_bytes",
+		Help:    "Size of uploaded files.",
+		Buckets: prometheus.ExponentialBuckets(1024, 4, 10),
+	})
+
+	// BytesStored grows only when new content is written, duplicates share
+	// the stored file
+	BytesStored = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "storage_bytes_written_total",
+		Help: "Bytes written to the file storage.",
+	})
+)
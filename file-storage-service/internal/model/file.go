@@ -3,10 +3,12 @@ package model
 import "github.com/gofrs/uuid/v5"
 
 type File struct {
-	ID          int       `json:"id"`
-	StudentID   uuid.UUID `json:"student_id"`
-	Filename    string    `json:"filename"`
-	FileSize    int64     `json:"file_size"`
-	FileHash    string    `json:"file_hash"`
-	StoragePath string    `json:"-"`
+	ID        int       `json:"id"`
+	StudentID uuid.UUID `json:"student_id"`
+	Filename  string    `json:"filename"`
+	FileSize  int64     `json:"file_size"`
+	FileHash  string    `json:"file_hash"`
+	// Course is the optional course code given on upload
+	Course      string `json:"course,omitempty"`
+	StoragePath string `json:"-"`
 }
@@ -2,10 +2,14 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
 	"github.com/KEPTANy/plag-check/file-storage-service/internal/model"
+	"github.com/KEPTANy/plag-check/shared/apperror"
+	"github.com/KEPTANy/plag-check/shared/dbtx"
 	"github.com/gofrs/uuid/v5"
+	"github.com/jackc/pgx/v5"
 )
 
 type FileRepository interface {
@@ -26,13 +30,13 @@ func NewFileRepository(db *PgRepository) FileRepository {
 func (r *fileRepository) AddFile(ctx context.Context, file *model.File) (int, error) {
 	query := `
 		INSERT INTO files (
-			student_id, file_hash, file_size, storage_path, original_filename
-		) VALUES ($1, $2, $3, $4, $5)
+			student_id, file_hash, file_size, storage_path, original_filename, course
+		) VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''))
 		RETURNING id
 	`
 
-	err := r.db.pool.QueryRow(
-		ctx, query, file.StudentID, file.FileHash, file.FileSize, file.StoragePath, file.Filename,
+	err := dbtx.From(ctx, r.db.pool).QueryRow(
+		ctx, query, file.StudentID, file.FileHash, file.FileSize, file.StoragePath, file.Filename, file.Course,
 	).Scan(&file.ID)
 
 	if err != nil {
@@ -44,16 +48,19 @@ func (r *fileRepository) AddFile(ctx context.Context, file *model.File) (int, er
 
 func (r *fileRepository) GetFileByID(ctx context.Context, id int) (*model.File, error) {
 	query := `
-		SELECT id, student_id, file_hash, file_size, storage_path, original_filename
+		SELECT id, student_id, file_hash, file_size, storage_path, original_filename, COALESCE(course, '')
 		FROM files
 		WHERE id = $1
 	`
 
 	var file model.File
-	err := r.db.pool.QueryRow(ctx, query, id).Scan(
-		&file.ID, &file.StudentID, &file.FileHash, &file.FileSize, &file.StoragePath, &file.Filename,
+	err := dbtx.From(ctx, r.db.pool).QueryRow(ctx, query, id).Scan(
+		&file.ID, &file.StudentID, &file.FileHash, &file.FileSize, &file.StoragePath, &file.Filename, &file.Course,
 	)
 
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, apperror.NotFound("file not found").Wrap(err)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("Failed to get file info: %w", err)
 	}
@@ -63,13 +70,13 @@ func (r *fileRepository) GetFileByID(ctx context.Context, id int) (*model.File,
 
 func (r *fileRepository) GetFilesByStudent(ctx context.Context, studentID uuid.UUID) ([]model.File, error) {
 	query := `
-		SELECT id, student_id, file_hash, file_size, storage_path, original_filename
+		SELECT id, student_id, file_hash, file_size, storage_path, original_filename, COALESCE(course, '')
 		FROM files
 		WHERE student_id = $1
 		ORDER BY id ASC
 	`
 
-	rows, err := r.db.pool.Query(ctx, query, studentID)
+	rows, err := dbtx.From(ctx, r.db.pool).Query(ctx, query, studentID)
 	if err != nil {
 		return nil, fmt.Errorf("Failed to get files' info by student_id: %w", err)
 	}
@@ -79,7 +86,7 @@ func (r *fileRepository) GetFilesByStudent(ctx context.Context, studentID uuid.U
 	for rows.Next() {
 		var file model.File
 		err := rows.Scan(
-			&file.ID, &file.StudentID, &file.FileHash, &file.FileSize, &file.StoragePath, &file.Filename,
+			&file.ID, &file.StudentID, &file.FileHash, &file.FileSize, &file.StoragePath, &file.Filename, &file.Course,
 		)
 
 		if err != nil {
@@ -94,13 +101,13 @@ func (r *fileRepository) GetFilesByStudent(ctx context.Context, studentID uuid.U
 
 func (r *fileRepository) GetFilesByHash(ctx context.Context, hash string) ([]model.File, error) {
 	query := `
-		SELECT id, student_id, file_hash, file_size, storage_path, original_filename
+		SELECT id, student_id, file_hash, file_size, storage_path, original_filename, COALESCE(course, '')
 		FROM files
 		WHERE file_hash = $1
 		ORDER BY id ASC
 	`
 
-	rows, err := r.db.pool.Query(ctx, query, hash)
+	rows, err := dbtx.From(ctx, r.db.pool).Query(ctx, query, hash)
 	if err != nil {
 		return nil, fmt.Errorf("Failed to get files' info by hash: %w", err)
 	}
@@ -110,7 +117,7 @@ func (r *fileRepository) GetFilesByHash(ctx context.Context, hash string) ([]mod
 	for rows.Next() {
 		var file model.File
 		err := rows.Scan(
-			&file.ID, &file.StudentID, &file.FileHash, &file.FileSize, &file.StoragePath, &file.Filename,
+			&file.ID, &file.StudentID, &file.FileHash, &file.FileSize, &file.StoragePath, &file.Filename, &file.Course,
 		)
 
 		if err != nil {
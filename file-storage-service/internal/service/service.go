@@ -9,26 +9,30 @@ import (
 	"github.com/KEPTANy/plag-check/file-storage-service/internal/model"
 	"github.com/KEPTANy/plag-check/file-storage-service/internal/repository"
 	"github.com/KEPTANy/plag-check/file-storage-service/internal/storage"
+	"github.com/KEPTANy/plag-check/shared/dbtx"
+	"github.com/KEPTANy/plag-check/shared/events"
 	"github.com/gofrs/uuid/v5"
 )
 
 type FileStorageService interface {
-	UploadFile(ctx context.Context, studentID uuid.UUID, file multipart.File, header *multipart.FileHeader) (*model.File, error)
+	UploadFile(ctx context.Context, studentID uuid.UUID, course string, file multipart.File, header *multipart.FileHeader) (*model.File, error)
 	DownloadFile(ctx context.Context, fileID int) (*model.File, io.ReadCloser, error)
 	ListFilesByUser(ctx context.Context, studentID uuid.UUID) ([]model.File, error)
 	ListFilesByHash(ctx context.Context, hash string) ([]model.File, error)
 }
 
 type fileStorageService struct {
-	db      repository.FileRepository
-	storage storage.Storage
+	db        repository.FileRepository
+	storage   storage.Storage
+	tx        dbtx.Transactor
+	publisher *events.Publisher
 }
 
-func NewFileStorageService(db repository.FileRepository, storage storage.Storage) FileStorageService {
-	return &fileStorageService{db: db, storage: storage}
+func NewFileStorageService(db repository.FileRepository, storage storage.Storage, tx dbtx.Transactor, publisher *events.Publisher) FileStorageService {
+	return &fileStorageService{db: db, storage: storage, tx: tx, publisher: publisher}
 }
 
-func (s *fileStorageService) UploadFile(ctx context.Context, studentID uuid.UUID, file multipart.File, header *multipart.FileHeader) (*model.File, error) {
+func (s *fileStorageService) UploadFile(ctx context.Context, studentID uuid.UUID, course string, file multipart.File, header *multipart.FileHeader) (*model.File, error) {
 	hash, storagePath, size, err := s.storage.SaveFile(ctx, file, header)
 	if err != nil {
 		return nil, fmt.Errorf("Failed to save file to storage: %w", err)
@@ -41,10 +45,27 @@ func (s *fileStorageService) UploadFile(ctx context.Context, studentID uuid.UUID
 		FileSize:    size,
 		FileHash:    hash,
 		StoragePath: storagePath,
+		Course:      course,
 	}
-	fileData.ID, err = s.db.AddFile(ctx, fileData)
+	// the file.uploaded event is only stored if the file row is
+	err = s.tx.InTx(ctx, func(ctx context.Context) error {
+		id, err := s.db.AddFile(ctx, fileData)
+		if err != nil {
+			return fmt.Errorf("Failed to add file to db: %w", err)
+		}
+		fileData.ID = id
+
+		return s.publisher.Publish(ctx, events.TopicFileUploaded, events.FileUploaded{
+			FileID:    fileData.ID,
+			StudentID: fileData.StudentID,
+			FileHash:  fileData.FileHash,
+			FileSize:  fileData.FileSize,
+			Filename:  fileData.Filename,
+			Course:    fileData.Course,
+		})
+	})
 	if err != nil {
-		return nil, fmt.Errorf("Failed to add file to db: %w", err)
+		return nil, err
 	}
 
 	return fileData, nil
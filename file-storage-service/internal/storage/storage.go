@@ -4,18 +4,27 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
-	"errors"
 	"fmt"
 	"io"
 	"mime/multipart"
 	"os"
 	"path/filepath"
+
+	"github.com/KEPTANy/plag-check/file-storage-service/internal/metrics"
+	"github.com/KEPTANy/plag-check/shared/apperror"
+	"github.com/KEPTANy/plag-check/shared/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+var tracer = otel.Tracer("github.com/KEPTANy/plag-check/file-storage-service/internal/storage")
+
 type Storage interface {
 	SaveFile(ctx context.Context, file multipart.File, header *multipart.FileHeader) (hash, storagePath string, size int64, err error)
 	GetFile(ctx context.Context, storagePath string) (rc io.ReadCloser, size int64, err error)
 	FileExists(ctx context.Context, storagePath string) bool
+	CheckWritable(ctx context.Context) error
 }
 
 type storage struct {
@@ -38,8 +47,14 @@ func storagePathFromHash(hash string) string {
 }
 
 func (s *storage) SaveFile(ctx context.Context, file multipart.File, header *multipart.FileHeader) (hash, storagePath string, size int64, err error) {
+	ctx, span := tracer.Start(ctx, "storage.SaveFile")
+	defer func() {
+		span.SetAttributes(attribute.String("storage.path", storagePath), attribute.Int64("storage.size", size))
+		tracing.End(span, err)
+	}()
+
 	if header.Size > s.maxFileSize {
-		return "", "", 0, errors.New("File size excedes max file size")
+		return "", "", 0, apperror.New(apperror.CodeTooLarge, "file exceeds max file size")
 	}
 
 	tempFile, err := os.CreateTemp("", "upload-*")
@@ -61,7 +76,10 @@ func (s *storage) SaveFile(ctx context.Context, file multipart.File, header *mul
 	storagePath = storagePathFromHash(hash)
 	fullPath := filepath.Join(s.root, storagePath)
 
+	metrics.UploadSize.Observe(float64(written))
+
 	if exists := s.FileExists(ctx, storagePath); exists {
+		metrics.FilesUploaded.WithLabelValues("duplicate").Inc()
 		return hash, storagePath, written, nil
 	}
 
@@ -87,10 +105,17 @@ func (s *storage) SaveFile(ctx context.Context, file multipart.File, header *mul
 		return "", "", 0, fmt.Errorf("File size mismatch")
 	}
 
+	metrics.FilesUploaded.WithLabelValues("new").Inc()
+	metrics.BytesStored.Add(float64(written))
+
 	return hash, storagePath, written, nil
 }
 
+// GetFile only opens the file, the span does not cover reading it.
 func (s *storage) GetFile(ctx context.Context, storagePath string) (rc io.ReadCloser, size int64, err error) {
+	_, span := tracer.Start(ctx, "storage.GetFile", trace.WithAttributes(attribute.String("storage.path", storagePath)))
+	defer func() { tracing.End(span, err) }()
+
 	fullPath := filepath.Join(s.root, storagePath)
 
 	fileInfo, err := os.Stat(fullPath)
@@ -111,3 +136,18 @@ func (s *storage) FileExists(ctx context.Context, storagePath string) bool {
 	_, err := os.Stat(fullPath)
 	return err == nil
 }
+
+// CheckWritable creates and removes a file in the root, so a read-only or
+// full volume is reported before an upload fails on it.
+func (s *storage) CheckWritable(ctx context.Context) error {
+	file, err := os.CreateTemp(s.root, ".health-*")
+	if err != nil {
+		return fmt.Errorf("Storage root is not writable: %w", err)
+	}
+	file.Close()
+
+	if err := os.Remove(file.Name()); err != nil {
+		return fmt.Errorf("Failed to remove health check file: %w", err)
+	}
+	return nil
+}
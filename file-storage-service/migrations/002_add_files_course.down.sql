@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_files_course;
+
+ALTER TABLE files DROP COLUMN IF EXISTS course;
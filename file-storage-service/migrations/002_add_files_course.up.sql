@@ -0,0 +1,3 @@
+ALTER TABLE files ADD COLUMN IF NOT EXISTS course VARCHAR(100);
+
+CREATE INDEX IF NOT EXISTS idx_files_course ON files (course);
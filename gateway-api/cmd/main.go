@@ -10,69 +10,157 @@ import (
 	"time"
 
 	"github.com/KEPTANy/plag-check/gateway-api/internal/config"
+	"github.com/KEPTANy/plag-check/gateway-api/internal/docs"
 	"github.com/KEPTANy/plag-check/gateway-api/internal/handler"
+	intMiddleware "github.com/KEPTANy/plag-check/gateway-api/internal/middleware"
 	"github.com/KEPTANy/plag-check/gateway-api/internal/proxy"
+	"github.com/KEPTANy/plag-check/gateway-api/internal/router"
+	"github.com/KEPTANy/plag-check/shared/audit"
+	auditMigrations "github.com/KEPTANy/plag-check/shared/audit/migrations"
+	"github.com/KEPTANy/plag-check/shared/bootstrap"
+	"github.com/KEPTANy/plag-check/shared/logging"
 	"github.com/KEPTANy/plag-check/shared/middleware"
+	"github.com/KEPTANy/plag-check/shared/migrate"
+	"github.com/KEPTANy/plag-check/shared/tracing"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 func main() {
+	logging.Setup("gateway-api")
+
+	shutdownTracing, err := tracing.Setup(context.Background(), "gateway-api")
+	if err != nil {
+		log.Fatalf("Failed to set up tracing: %v", err)
+	}
+
 	var cfg config.Config
-	err := cfg.Load()
+	err = cfg.Load()
 	if err != nil {
 		log.Fatalf("Failed to load config: %v", err)
 	}
 
-	reverseProxy := proxy.NewReverseProxy(
-		cfg.UserServiceURL,
-		cfg.FileStorageServiceURL,
-		cfg.AnalysisServiceURL,
-	)
+	app := bootstrap.New(cfg.Lifecycle)
+	app.OnShutdown(shutdownTracing)
+
+	pool, err := bootstrap.NewPool(context.Background(), cfg.Database)
+	if err != nil {
+		log.Fatalf("Failed to connect to db: %v", err)
+	}
+	app.OnShutdown(func(context.Context) error {
+		pool.Close()
+		return nil
+	})
+
+	if err := migrate.Up(context.Background(), pool, "audit", auditMigrations.FS); err != nil {
+		log.Fatalf("Failed to run audit log migrations: %v", err)
+	}
+	auditLog := audit.New(pool, "gateway-api")
 
-	healthHandler := handler.NewHealthHandler()
+	routes, err := router.Load(cfg.RoutesFile)
+	if err != nil {
+		log.Fatalf("Failed to load routes: %v", err)
+	}
+
+	reverseProxy, err := proxy.NewReverseProxy(routes, cfg.CacheSize, auditLog)
+	if err != nil {
+		log.Fatalf("Failed to create reverse proxy: %v", err)
+	}
+	app.OnShutdown(func(context.Context) error {
+		reverseProxy.Stop()
+		return nil
+	})
+
+	app.Go("routes-reload", func(ctx context.Context) error {
+		reloadOnSighup(ctx, cfg.RoutesFile, reverseProxy)
+		return nil
+	})
+
+	healthHandler := handler.NewHealthHandler(reverseProxy, app.Ready)
+	adminHandler := handler.NewAdminHandler(reverseProxy)
 
 	mux := http.NewServeMux()
 
 	mux.Handle("GET /health", http.HandlerFunc(healthHandler.Health))
+	mux.Handle("GET /health/ready", http.HandlerFunc(healthHandler.Ready))
 
-	mux.Handle("POST /auth/", http.HandlerFunc(reverseProxy.ProxyRequest))
-	mux.Handle("GET /auth/", http.HandlerFunc(reverseProxy.ProxyRequest))
+	mux.Handle("GET /docs/", docs.Handler("/docs/"))
 
-	mux.Handle("POST /files/", http.HandlerFunc(reverseProxy.ProxyRequest))
-	mux.Handle("GET /files/", http.HandlerFunc(reverseProxy.ProxyRequest))
-
-	mux.Handle("GET /analysis/", http.HandlerFunc(reverseProxy.ProxyRequest))
+	// everything else is matched against the route table
+	mux.Handle("/", reverseProxy)
 
 	handler := middleware.Chain(
+		middleware.RequestIDMiddleware,
+		middleware.ClientIP(cfg.TrustedProxies),
+		middleware.TracingMiddleware,
 		middleware.RecoveringMiddleware,
 		middleware.LoggingMiddleware,
-	)(mux)
-
+		middleware.MetricsMiddleware,
+		// before authentication, preflight requests carry no token and
+		// rejected requests still need CORS headers to be readable
+		middleware.CORS(cfg.CORS),
+		middleware.SecurityHeadersMiddleware,
+		intMiddleware.Authenticate(cfg.JWTSecret, cfg.IdentitySecret),
+	)(middleware.PatternMiddleware(mux))
+
+	// no read or write timeout: uploads and downloads are streamed and may
+	// take long, upstream calls are bounded by per-route timeouts instead
 	server := &http.Server{
-		Addr:         ":" + cfg.Port,
-		Handler:      handler,
-		ReadTimeout:  10 * time.Second,
-		WriteTimeout: 30 * time.Second,
-		IdleTimeout:  60 * time.Second,
+		Addr:              ":" + cfg.Port,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+		IdleTimeout:       60 * time.Second,
 	}
 
-	go func() {
-		log.Printf("Gateway API starting on port: %v", cfg.Port)
-		if err := server.ListenAndServe(); err != nil {
-			log.Fatalf("Failed to start server: %v", err)
+	adminMux := http.NewServeMux()
+	adminMux.Handle("GET /admin/upstreams", http.HandlerFunc(adminHandler.Upstreams))
+	adminMux.Handle("GET /admin/cache", http.HandlerFunc(adminHandler.Cache))
+	adminMux.Handle("GET /metrics", promhttp.Handler())
+
+	adminServer := &http.Server{
+		Addr: ":" + cfg.AdminPort,
+		Handler: middleware.Chain(
+			middleware.RequestIDMiddleware,
+			middleware.RecoveringMiddleware,
+			middleware.LoggingMiddleware,
+		)(adminMux),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	app.Serve(server)
+	app.Serve(adminServer)
+
+	log.Printf("Gateway API starting on port: %v, admin API on port: %v", cfg.Port, cfg.AdminPort)
+	if err := app.Run(); err != nil {
+		log.Fatalf("Service stopped: %v", err)
+	}
+}
+
+// reloadOnSighup re-reads the routes file on every SIGHUP until ctx is done.
+// A file that fails to load is reported and the current table stays in
+// effect.
+func reloadOnSighup(ctx context.Context, path string, reverseProxy *proxy.ReverseProxy) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
 		}
-	}()
 
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
-	log.Println("Shutting down server...")
+		routes, err := router.Load(path)
+		if err != nil {
+			log.Printf("Failed to reload routes, keeping the current ones: %v", err)
+			continue
+		}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+		if err := reverseProxy.Reload(routes); err != nil {
+			log.Printf("Failed to reload routes, keeping the current ones: %v", err)
+			continue
+		}
 
-	if err := server.Shutdown(ctx); err != nil {
-		log.Fatal("Server forced to shutdown:", err)
+		log.Printf("Reloaded %d routes from %s", len(routes.Routes), path)
 	}
-
-	log.Println("Server exited properly")
 }
@@ -0,0 +1,214 @@
+package balancer
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/KEPTANy/plag-check/gateway-api/internal/breaker"
+	"github.com/KEPTANy/plag-check/gateway-api/internal/router"
+)
+
+// Instance is a single backend of an upstream.
+type Instance struct {
+	URL     *url.URL
+	Handler http.Handler
+
+	healthy   atomic.Bool
+	active    atomic.Int64
+	successes int
+	failures  int
+}
+
+func (i *Instance) Healthy() bool {
+	return i.healthy.Load()
+}
+
+// ServeHTTP forwards the request to the instance and tracks it as an active
+// connection for the least connections strategy.
+func (i *Instance) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	i.active.Add(1)
+	defer i.active.Add(-1)
+
+	i.Handler.ServeHTTP(w, r)
+}
+
+// Pool balances requests over the healthy instances of one upstream and
+// probes every instance in the background.
+type Pool struct {
+	Name      string
+	Instances []*Instance
+	Breaker   *breaker.Breaker
+	Retry     router.Retry
+
+	strategy string
+	check    router.HealthCheck
+	client   *http.Client
+	next     atomic.Uint64
+
+	cancel context.CancelFunc
+	done   sync.WaitGroup
+}
+
+// NewPool creates a pool whose instances are all considered healthy until the
+// first probe says otherwise.
+func NewPool(name string, upstream router.Upstream, instances []*Instance, transport http.RoundTripper) *Pool {
+	for _, instance := range instances {
+		instance.healthy.Store(true)
+	}
+
+	return &Pool{
+		Name:      name,
+		Instances: instances,
+		Breaker: breaker.New(breaker.Config{
+			FailureThreshold: upstream.CircuitBreaker.FailureThreshold,
+			OpenTimeout:      time.Duration(upstream.CircuitBreaker.OpenTimeout),
+			HalfOpenRequests: upstream.CircuitBreaker.HalfOpenRequests,
+		}),
+		Retry:    upstream.Retry,
+		strategy: upstream.Balancer,
+		check:    upstream.HealthCheck,
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   time.Duration(upstream.HealthCheck.Timeout),
+		},
+	}
+}
+
+// Adopt takes over the health of the instances of prev with the same URL, so
+// an ejected instance stays ejected across a reload. The health checker of
+// prev has to be stopped already.
+func (p *Pool) Adopt(prev *Pool) {
+	for _, instance := range p.Instances {
+		for _, old := range prev.Instances {
+			if old.URL.String() != instance.URL.String() {
+				continue
+			}
+			instance.healthy.Store(old.Healthy())
+			instance.successes = old.successes
+			instance.failures = old.failures
+			break
+		}
+	}
+}
+
+// Next picks a healthy instance, or returns nil if all of them are ejected.
+func (p *Pool) Next() *Instance {
+	if p.strategy == router.BalancerLeastConnections {
+		var best *Instance
+		for _, instance := range p.Instances {
+			if !instance.Healthy() {
+				continue
+			}
+			if best == nil || instance.active.Load() < best.active.Load() {
+				best = instance
+			}
+		}
+		return best
+	}
+
+	n := uint64(len(p.Instances))
+	start := p.next.Add(1)
+	for i := range n {
+		instance := p.Instances[(start+i)%n]
+		if instance.Healthy() {
+			return instance
+		}
+	}
+	return nil
+}
+
+// Start launches the health checker, Stop terminates it.
+func (p *Pool) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	p.cancel = cancel
+
+	p.done.Add(1)
+	go func() {
+		defer p.done.Done()
+
+		ticker := time.NewTicker(time.Duration(p.check.Interval))
+		defer ticker.Stop()
+
+		for {
+			p.probeAll(ctx)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (p *Pool) Stop() {
+	if p.cancel != nil {
+		p.cancel()
+		p.done.Wait()
+	}
+}
+
+func (p *Pool) probeAll(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, instance := range p.Instances {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := p.probe(ctx, instance)
+			if ctx.Err() == nil {
+				p.record(instance, err == nil)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// probe requests the health check path of an instance once.
+func (p *Pool) probe(ctx context.Context, instance *Instance) error {
+	probeURL := instance.URL.JoinPath(p.check.Path)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, probeURL.String(), nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("health check returned %s", resp.Status)
+	}
+	return nil
+}
+
+// record updates the consecutive probe counters of an instance. Counters are
+// only touched by the health checker goroutine of the pool.
+func (p *Pool) record(instance *Instance, ok bool) {
+	if ok {
+		instance.failures = 0
+		instance.successes++
+		if !instance.Healthy() && instance.successes >= p.check.HealthyThreshold {
+			instance.healthy.Store(true)
+			slog.Info("Upstream instance is healthy again, readmitted",
+				"upstream", p.Name, "instance", instance.URL.String())
+		}
+		return
+	}
+
+	instance.successes = 0
+	instance.failures++
+	if instance.Healthy() && instance.failures >= p.check.UnhealthyThreshold {
+		instance.healthy.Store(false)
+		slog.Warn("Upstream instance failed health checks, ejected",
+			"upstream", p.Name, "instance", instance.URL.String(), "failures", instance.failures)
+	}
+}
@@ -0,0 +1,158 @@
+package breaker
+
+import (
+	"sync"
+	"time"
+)
+
+type State string
+
+const (
+	StateClosed   State = "closed"
+	StateOpen     State = "open"
+	StateHalfOpen State = "half_open"
+)
+
+type Config struct {
+	// consecutive failures that open the breaker
+	FailureThreshold int
+	// how long the breaker stays open before letting trial requests through
+	OpenTimeout time.Duration
+	// concurrent trial requests allowed while half-open, one successful
+	// trial closes the breaker and one failed trial opens it again
+	HalfOpenRequests int
+}
+
+// Breaker stops sending requests to an upstream that keeps failing, so
+// clients get an immediate error instead of waiting for each one to time out.
+type Breaker struct {
+	mu       sync.Mutex
+	config   Config
+	state    State
+	failures int
+	openedAt time.Time
+	trials   int
+	// generation counts the half-open periods, so a trial that outlives its
+	// period does not free a slot of the next one
+	generation uint64
+
+	now func() time.Time
+}
+
+// Ticket is handed out by Allow and tells the breaker how the request was
+// admitted when it ends.
+type Ticket struct {
+	trial      bool
+	generation uint64
+}
+
+func New(config Config) *Breaker {
+	return &Breaker{config: config, state: StateClosed, now: time.Now}
+}
+
+// Allow reports whether a request may be sent. Every allowed request must be
+// followed by exactly one call to Record or Release with its ticket.
+func (b *Breaker) Allow() (Ticket, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == StateOpen && b.now().Sub(b.openedAt) >= b.config.OpenTimeout {
+		b.state = StateHalfOpen
+		b.trials = 0
+		b.generation++
+	}
+
+	switch b.state {
+	case StateOpen:
+		return Ticket{}, false
+	case StateHalfOpen:
+		if b.trials >= b.config.HalfOpenRequests {
+			return Ticket{}, false
+		}
+		b.trials++
+		return Ticket{trial: true, generation: b.generation}, true
+	default:
+		return Ticket{}, true
+	}
+}
+
+// isTrial reports whether t belongs to a trial of the current half-open
+// period.
+func (b *Breaker) isTrial(t Ticket) bool {
+	return b.state == StateHalfOpen && t.trial && t.generation == b.generation
+}
+
+func (b *Breaker) Record(t Ticket, success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case StateHalfOpen:
+		// requests admitted before the breaker opened finish late, only
+		// trials decide whether the upstream recovered
+		if !b.isTrial(t) {
+			return
+		}
+		b.trials--
+		if success {
+			b.state = StateClosed
+			b.failures = 0
+		} else {
+			b.open()
+		}
+	case StateClosed:
+		if success {
+			b.failures = 0
+			return
+		}
+		b.failures++
+		if b.failures >= b.config.FailureThreshold {
+			b.open()
+		}
+	}
+}
+
+// Release ends a request that says nothing about the upstream, e.g. one the
+// client cancelled, without counting it either way.
+func (b *Breaker) Release(t Ticket) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.isTrial(t) {
+		b.trials--
+	}
+}
+
+func (b *Breaker) open() {
+	b.state = StateOpen
+	b.openedAt = b.now()
+	b.failures = 0
+}
+
+// RetryAfter is how long until an open breaker lets trial requests through.
+func (b *Breaker) RetryAfter() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state != StateOpen {
+		return 0
+	}
+	return max(b.config.OpenTimeout-b.now().Sub(b.openedAt), 0)
+}
+
+type Status struct {
+	State               State     `json:"state"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	OpenedAt            time.Time `json:"opened_at,omitzero"`
+}
+
+func (b *Breaker) Status() Status {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	status := Status{State: b.state, ConsecutiveFailures: b.failures}
+	if b.state != StateClosed {
+		status.OpenedAt = b.openedAt
+	}
+	return status
+}
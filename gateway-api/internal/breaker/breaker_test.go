@@ -0,0 +1,183 @@
+package breaker
+
+import (
+	"testing"
+	"time"
+)
+
+// step is one call on the breaker: "allow" and "deny" call Allow and expect
+// true or false, "ok" and "fail" call Record and "release" calls Release with
+// the ticket of the latest allowed request, "wait" advances the clock by the
+// open timeout.
+type step struct {
+	op   string
+	want State
+}
+
+func TestBreakerTransitions(t *testing.T) {
+	config := Config{FailureThreshold: 3, OpenTimeout: time.Minute, HalfOpenRequests: 1}
+
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "failures below the threshold keep it closed",
+			steps: []step{
+				{"allow", StateClosed}, {"fail", StateClosed},
+				{"allow", StateClosed}, {"fail", StateClosed},
+				{"allow", StateClosed}, {"ok", StateClosed},
+				{"allow", StateClosed}, {"fail", StateClosed},
+				{"allow", StateClosed}, {"fail", StateClosed},
+			},
+		},
+		{
+			name: "consecutive failures open it",
+			steps: []step{
+				{"allow", StateClosed}, {"fail", StateClosed},
+				{"allow", StateClosed}, {"fail", StateClosed},
+				{"allow", StateClosed}, {"fail", StateOpen},
+				{"deny", StateOpen},
+			},
+		},
+		{
+			name: "successful trial closes it",
+			steps: []step{
+				{"allow", StateClosed}, {"fail", StateClosed},
+				{"allow", StateClosed}, {"fail", StateClosed},
+				{"allow", StateClosed}, {"fail", StateOpen},
+				{"wait", StateOpen},
+				{"allow", StateHalfOpen},
+				// only HalfOpenRequests trials at a time
+				{"deny", StateHalfOpen},
+				{"ok", StateClosed},
+				{"allow", StateClosed},
+			},
+		},
+		{
+			name: "failed trial opens it again",
+			steps: []step{
+				{"allow", StateClosed}, {"fail", StateClosed},
+				{"allow", StateClosed}, {"fail", StateClosed},
+				{"allow", StateClosed}, {"fail", StateOpen},
+				{"wait", StateOpen},
+				{"allow", StateHalfOpen}, {"fail", StateOpen},
+				{"deny", StateOpen},
+				{"wait", StateOpen},
+				{"allow", StateHalfOpen}, {"ok", StateClosed},
+			},
+		},
+		{
+			name: "released trial frees its slot",
+			steps: []step{
+				{"allow", StateClosed}, {"fail", StateClosed},
+				{"allow", StateClosed}, {"fail", StateClosed},
+				{"allow", StateClosed}, {"fail", StateOpen},
+				{"wait", StateOpen},
+				{"allow", StateHalfOpen}, {"deny", StateHalfOpen},
+				{"release", StateHalfOpen},
+				{"allow", StateHalfOpen}, {"ok", StateClosed},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Unix(1_700_000_000, 0)
+			b := New(config)
+			b.now = func() time.Time { return now }
+			var tickets []Ticket
+			last := func() Ticket {
+				ticket := tickets[len(tickets)-1]
+				tickets = tickets[:len(tickets)-1]
+				return ticket
+			}
+
+			for i, s := range tt.steps {
+				switch s.op {
+				case "allow", "deny":
+					ticket, ok := b.Allow()
+					if ok != (s.op == "allow") {
+						t.Fatalf("step %d: Allow() = %v, want %v", i, ok, s.op == "allow")
+					}
+					if ok {
+						tickets = append(tickets, ticket)
+					}
+				case "ok", "fail":
+					b.Record(last(), s.op == "ok")
+				case "release":
+					b.Release(last())
+				case "wait":
+					now = now.Add(config.OpenTimeout)
+				default:
+					t.Fatalf("step %d: unknown op %q", i, s.op)
+				}
+
+				if got := b.Status().State; got != s.want {
+					t.Fatalf("step %d (%s): state = %s, want %s", i, s.op, got, s.want)
+				}
+			}
+		})
+	}
+}
+
+func TestBreakerRetryAfter(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	b := New(Config{FailureThreshold: 1, OpenTimeout: time.Minute, HalfOpenRequests: 1})
+	b.now = func() time.Time { return now }
+
+	if got := b.RetryAfter(); got != 0 {
+		t.Errorf("RetryAfter() closed = %s, want 0", got)
+	}
+
+	ticket, _ := b.Allow()
+	b.Record(ticket, false)
+	now = now.Add(20 * time.Second)
+
+	if got := b.RetryAfter(); got != 40*time.Second {
+		t.Errorf("RetryAfter() = %s, want 40s", got)
+	}
+
+	status := b.Status()
+	if status.State != StateOpen || !status.OpenedAt.Equal(now.Add(-20*time.Second)) {
+		t.Errorf("Status() = %+v, want open since the failure", status)
+	}
+}
+
+func TestBreakerLateCompletions(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	b := New(Config{FailureThreshold: 1, OpenTimeout: time.Minute, HalfOpenRequests: 1})
+	b.now = func() time.Time { return now }
+
+	// slow is admitted while closed and outlives the breaker opening
+	slow, _ := b.Allow()
+	failed, _ := b.Allow()
+	b.Record(failed, false)
+	now = now.Add(time.Minute)
+
+	trial, ok := b.Allow()
+	if !ok {
+		t.Fatal("Allow() = false, want a trial after the open timeout")
+	}
+
+	b.Record(slow, true)
+	if got := b.Status().State; got != StateHalfOpen {
+		t.Fatalf("state = %s after a late completion, want %s", got, StateHalfOpen)
+	}
+	if _, ok := b.Allow(); ok {
+		t.Fatal("Allow() = true, a late completion freed the slot of the trial")
+	}
+
+	// the trial fails and a new half-open period starts
+	b.Record(trial, false)
+	now = now.Add(time.Minute)
+	if _, ok := b.Allow(); !ok {
+		t.Fatal("Allow() = false, want a trial of the next period")
+	}
+
+	// the trial of the previous period is stale as well
+	b.Release(trial)
+	if _, ok := b.Allow(); ok {
+		t.Error("Allow() = true, a stale trial freed the slot of the next period")
+	}
+}
@@ -0,0 +1,138 @@
+// Package cache is an in-memory LRU cache of upstream responses.
+package cache
+
+import (
+	"container/list"
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/KEPTANy/plag-check/shared/audit"
+)
+
+// entry is never modified once stored, revalidation stores a new one, so
+// entries can be served without holding the lock.
+type entry struct {
+	key     string
+	path    string
+	header  http.Header
+	body    []byte
+	etag    string
+	stored  time.Time
+	expires time.Time
+	// replay is the audit event of a view of the response, see
+	// audit.SetReplay
+	replay *audit.Event
+}
+
+func (e *entry) size() int {
+	size := len(e.key) + len(e.body)
+	for name, values := range e.header {
+		size += len(name)
+		for _, value := range values {
+			size += len(value)
+		}
+	}
+	return size
+}
+
+// Auditor records the views of audited responses the cache answers in place
+// of the upstream.
+type Auditor interface {
+	Record(ctx context.Context, event audit.Event) error
+}
+
+// Cache keeps the most recently used responses up to a total size in bytes.
+type Cache struct {
+	auditor  Auditor
+	mu       sync.Mutex
+	maxBytes int
+	bytes    int
+	order    *list.List // front is the most recently used
+	entries  map[string]*list.Element
+}
+
+// New returns a cache of maxBytes. Without an auditor, responses whose views
+// are audited are not cached.
+func New(maxBytes int, auditor Auditor) *Cache {
+	return &Cache{
+		auditor:  auditor,
+		maxBytes: maxBytes,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+// maxEntrySize keeps a single large response from flushing the whole cache.
+func (c *Cache) maxEntrySize() int {
+	return c.maxBytes / 16
+}
+
+// get returns the entry of key, also when it is expired, so it can still be
+// revalidated with its ETag.
+func (c *Cache) get(key string) *entry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+
+	c.order.MoveToFront(element)
+	return element.Value.(*entry)
+}
+
+func (c *Cache) set(e *entry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[e.key]; ok {
+		c.removeElement(element)
+	}
+
+	size := e.size()
+	if size > c.maxEntrySize() {
+		return
+	}
+
+	c.entries[e.key] = c.order.PushFront(e)
+	c.bytes += size
+
+	for c.bytes > c.maxBytes {
+		c.removeElement(c.order.Back())
+	}
+}
+
+// Invalidate drops the entries of every user whose path starts with prefix.
+func (c *Cache) Invalidate(prefix string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, element := range c.entries {
+		if strings.HasPrefix(element.Value.(*entry).path, prefix) {
+			c.removeElement(element)
+		}
+	}
+}
+
+func (c *Cache) removeElement(element *list.Element) {
+	e := c.order.Remove(element).(*entry)
+	delete(c.entries, e.key)
+	c.bytes -= e.size()
+}
+
+type Stats struct {
+	Entries  int `json:"entries"`
+	Bytes    int `json:"bytes"`
+	MaxBytes int `json:"max_bytes"`
+}
+
+func (c *Cache) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return Stats{Entries: len(c.entries), Bytes: c.bytes, MaxBytes: c.maxBytes}
+}
@@ -0,0 +1,89 @@
+package cache
+
+import (
+	"strings"
+	"testing"
+)
+
+// sized returns an entry of key that takes exactly size bytes.
+func sized(key, path string, size int) *entry {
+	return &entry{key: key, path: path, body: []byte(strings.Repeat("x", size-len(key)))}
+}
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	// room for 16 entries of 100 bytes, the largest one allowed
+	c := New(1600, nil)
+
+	keys := "abcdefghijklmnop"
+	for _, key := range keys {
+		c.set(sized(string(key), "/"+string(key), 100))
+	}
+	if stats := c.Stats(); stats.Entries != 16 || stats.Bytes != 1600 {
+		t.Fatalf("Stats() = %+v, want 16 entries of 1600 bytes", stats)
+	}
+
+	// "a" is used again, so "b" is now the least recently used
+	c.get("a")
+	c.set(sized("q", "/q", 100))
+
+	if c.get("b") != nil {
+		t.Error("least recently used entry was not evicted")
+	}
+	for _, key := range []string{"a", "c", "q"} {
+		if c.get(key) == nil {
+			t.Errorf("entry %q was evicted", key)
+		}
+	}
+	if stats := c.Stats(); stats.Entries != 16 || stats.Bytes != 1600 {
+		t.Errorf("Stats() = %+v, want 16 entries of 1600 bytes", stats)
+	}
+
+	// replacing an entry frees its old size
+	c.set(sized("a", "/a", 50))
+	if stats := c.Stats(); stats.Entries != 16 || stats.Bytes != 1550 {
+		t.Errorf("Stats() after replacing = %+v, want 16 entries of 1550 bytes", stats)
+	}
+}
+
+func TestCacheSkipsLargeEntries(t *testing.T) {
+	c := New(1600, nil)
+	c.set(sized("small", "/small", 100))
+
+	// larger than a sixteenth of the cache
+	c.set(sized("large", "/large", 101))
+
+	if c.get("large") != nil {
+		t.Error("entry larger than the limit was stored")
+	}
+	if c.get("small") == nil {
+		t.Error("large entry evicted a small one")
+	}
+}
+
+func TestCacheInvalidate(t *testing.T) {
+	c := New(1<<20, nil)
+	for _, e := range []*entry{
+		sized("alice /analysis/1?", "/analysis/1", 100),
+		sized("bob /analysis/2?", "/analysis/2", 100),
+		sized("alice /analysisx?", "/analysisx", 100),
+		sized("alice /files/1?", "/files/1", 100),
+	} {
+		c.set(e)
+	}
+
+	c.Invalidate("/analysis/")
+
+	for key, want := range map[string]bool{
+		"alice /analysis/1?": false,
+		"bob /analysis/2?":   false,
+		"alice /analysisx?":  true,
+		"alice /files/1?":    true,
+	} {
+		if got := c.get(key) != nil; got != want {
+			t.Errorf("entry %q cached = %v, want %v", key, got, want)
+		}
+	}
+	if stats := c.Stats(); stats.Entries != 2 || stats.Bytes != 200 {
+		t.Errorf("Stats() = %+v, want 2 entries of 200 bytes", stats)
+	}
+}
@@ -0,0 +1,309 @@
+package cache
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"maps"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/KEPTANy/plag-check/gateway-api/internal/middleware"
+	"github.com/KEPTANy/plag-check/shared/audit"
+)
+
+// Middleware caches successful GET responses of next for ttl. Responses are
+// cached per user, since backends answer differently depending on the
+// caller. Cache-Control of the upstream response takes precedence over ttl,
+// and every cached response gets an ETag, so clients can revalidate with
+// If-None-Match. Any other method may change what the route returns, so it
+// drops the entries of all users under prefix. Views of audited responses
+// the cache answers itself are recorded with the auditor of the cache.
+func (c *Cache) Middleware(prefix string, ttl time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet && r.Method != http.MethodHead {
+				next.ServeHTTP(w, r)
+				c.Invalidate(prefix)
+				return
+			}
+
+			requestDirectives := parseCacheControl(r.Header.Get("Cache-Control"))
+			if requestDirectives.noStore {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			key := cacheKey(r)
+			cached := c.get(key)
+			// a view that cannot be recorded is left to the upstream
+			if cached != nil && !requestDirectives.noCache && time.Now().Before(cached.expires) && c.record(r, cached) {
+				serve(w, r, cached, "HIT")
+				return
+			}
+
+			// a HEAD response has no body to cache
+			if r.Method == http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// conditional requests of the client are answered here, the
+			// upstream only sees the ones the cache makes itself
+			upstream := r.Clone(r.Context())
+			upstream.Header.Del("If-None-Match")
+			upstream.Header.Del("If-Modified-Since")
+			if cached != nil && cached.etag != "" {
+				upstream.Header.Set("If-None-Match", cached.etag)
+			}
+
+			rec := newRecorder(w, c.maxEntrySize())
+			next.ServeHTTP(rec, upstream)
+
+			if rec.passthrough || rec.status == 0 {
+				return
+			}
+
+			switch {
+			case rec.status == http.StatusNotModified && cached != nil:
+				revalidated := *cached
+				revalidated.stored = time.Now()
+				revalidated.expires = revalidated.stored.Add(freshness(rec.header, ttl))
+				c.set(&revalidated)
+				serve(w, r, &revalidated, "REVALIDATED")
+
+			case rec.status == http.StatusOK:
+				fetched := &entry{
+					key:    key,
+					path:   r.URL.Path,
+					header: rec.header.Clone(),
+					body:   rec.body.Bytes(),
+					etag:   rec.header.Get("ETag"),
+					stored: time.Now(),
+				}
+				if fetched.etag == "" {
+					sum := sha256.Sum256(fetched.body)
+					fetched.etag = `"` + hex.EncodeToString(sum[:16]) + `"`
+					fetched.header.Set("ETag", fetched.etag)
+				}
+				fetched.expires = fetched.stored.Add(freshness(rec.header, ttl))
+				if event, ok := audit.Replay(rec.header); ok {
+					fetched.replay = &event
+				}
+				fetched.header.Del(audit.ReplayHeader)
+
+				if storable(rec.header) && (fetched.replay == nil || c.auditor != nil) {
+					c.set(fetched)
+				}
+				serve(w, r, fetched, "MISS")
+
+			default:
+				rec.flush()
+			}
+		})
+	}
+}
+
+// record audits a view of e answered from the cache. The upstream records
+// the views it answers itself, revalidated ones included.
+func (c *Cache) record(r *http.Request, e *entry) bool {
+	if e.replay == nil {
+		return true
+	}
+
+	event := *e.replay
+	if claims, ok := middleware.GetClaimsFromContext(r.Context()); ok {
+		event.ActorID = claims.UserID
+		event.ActorRole = claims.Role
+	}
+	event.Details = maps.Clone(event.Details)
+	if event.Details == nil {
+		event.Details = make(map[string]any)
+	}
+	event.Details["cache"] = "HIT"
+
+	return c.auditor.Record(r.Context(), event) == nil
+}
+
+func cacheKey(r *http.Request) string {
+	user := "anonymous"
+	if claims, ok := middleware.GetClaimsFromContext(r.Context()); ok {
+		user = claims.UserID.String()
+	}
+
+	// Encode sorts the parameters, so ?a=1&b=2 and ?b=2&a=1 share an entry
+	return user + " " + r.URL.Path + "?" + r.URL.Query().Encode()
+}
+
+func serve(w http.ResponseWriter, r *http.Request, e *entry, status string) {
+	header := w.Header()
+	for name, values := range e.header {
+		header[name] = append([]string(nil), values...)
+	}
+	header.Set("Age", strconv.Itoa(int(time.Since(e.stored).Seconds())))
+	header.Set("X-Cache", status)
+
+	if etagMatches(r.Header.Get("If-None-Match"), e.etag) {
+		header.Del("Content-Length")
+		header.Del("Content-Type")
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	header.Set("Content-Length", strconv.Itoa(len(e.body)))
+	w.WriteHeader(http.StatusOK)
+	if r.Method != http.MethodHead {
+		w.Write(e.body)
+	}
+}
+
+// etagMatches implements the weak comparison If-None-Match asks for.
+func etagMatches(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" || etag == "" {
+		return false
+	}
+	if strings.TrimSpace(ifNoneMatch) == "*" {
+		return true
+	}
+
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(candidate), "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+type directives struct {
+	noStore bool
+	noCache bool
+	maxAge  time.Duration
+	hasAge  bool
+}
+
+func parseCacheControl(value string) directives {
+	var d directives
+	for _, part := range strings.Split(value, ",") {
+		name, arg, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch strings.ToLower(name) {
+		case "no-store":
+			d.noStore = true
+		case "no-cache":
+			d.noCache = true
+		case "max-age", "s-maxage":
+			seconds, err := strconv.Atoi(strings.Trim(arg, `"`))
+			if err != nil || seconds < 0 {
+				continue
+			}
+			// s-maxage is meant for shared caches and wins over max-age
+			if !d.hasAge || strings.EqualFold(name, "s-maxage") {
+				d.maxAge = time.Duration(seconds) * time.Second
+				d.hasAge = true
+			}
+		}
+	}
+	return d
+}
+
+// freshness is how long a response may be served without asking the
+// upstream. no-cache responses are stored, but revalidated every time.
+func freshness(header http.Header, ttl time.Duration) time.Duration {
+	d := parseCacheControl(header.Get("Cache-Control"))
+	switch {
+	case d.noCache:
+		return 0
+	case d.hasAge:
+		return d.maxAge
+	default:
+		return ttl
+	}
+}
+
+// storable rejects responses that must not be reused. "private" is fine,
+// entries are never shared between users.
+func storable(header http.Header) bool {
+	if parseCacheControl(header.Get("Cache-Control")).noStore {
+		return false
+	}
+	return header.Get("Set-Cookie") == "" && header.Get("Vary") == ""
+}
+
+// recorder buffers a 200 or 304 response so it can be stored. Any other
+// status, or a body larger than limit, is passed through to the client.
+type recorder struct {
+	w           http.ResponseWriter
+	header      http.Header
+	status      int
+	body        bytes.Buffer
+	limit       int
+	passthrough bool
+}
+
+func newRecorder(w http.ResponseWriter, limit int) *recorder {
+	return &recorder{w: w, header: make(http.Header), limit: limit}
+}
+
+func (rec *recorder) Header() http.Header {
+	if rec.passthrough {
+		return rec.w.Header()
+	}
+	return rec.header
+}
+
+func (rec *recorder) WriteHeader(status int) {
+	if rec.status != 0 {
+		return
+	}
+	rec.status = status
+
+	if status != http.StatusOK && status != http.StatusNotModified {
+		rec.flush()
+	}
+}
+
+func (rec *recorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.WriteHeader(http.StatusOK)
+	}
+	if rec.passthrough {
+		return rec.w.Write(b)
+	}
+
+	if rec.body.Len()+len(b) > rec.limit {
+		rec.flush()
+		return rec.w.Write(b)
+	}
+	return rec.body.Write(b)
+}
+
+// Flush only reaches the client once the response is passed through, a
+// buffered one is written as a whole at the end.
+func (rec *recorder) Flush() {
+	if rec.passthrough {
+		http.NewResponseController(rec.w).Flush()
+	}
+}
+
+// flush switches to passing the response through and writes what was
+// buffered so far.
+func (rec *recorder) flush() {
+	if rec.passthrough {
+		return
+	}
+	rec.passthrough = true
+
+	header := rec.w.Header()
+	for name, values := range rec.header {
+		header[name] = values
+	}
+	header.Set("X-Cache", "BYPASS")
+	header.Del(audit.ReplayHeader)
+
+	rec.w.WriteHeader(rec.status)
+	if rec.body.Len() > 0 {
+		rec.w.Write(rec.body.Bytes())
+	}
+}
@@ -0,0 +1,310 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/KEPTANy/plag-check/gateway-api/internal/middleware"
+	"github.com/KEPTANy/plag-check/shared/audit"
+	"github.com/KEPTANy/plag-check/shared/jwt"
+	"github.com/gofrs/uuid/v5"
+)
+
+// upstream answers GET with a body naming the caller and the path, and counts
+// the requests that reach it.
+type upstream struct {
+	hits         atomic.Int32
+	cacheControl string
+	etag         string
+	replay       *audit.Event
+}
+
+func (u *upstream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	u.hits.Add(1)
+
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if u.cacheControl != "" {
+		w.Header().Set("Cache-Control", u.cacheControl)
+	}
+	if u.replay != nil {
+		audit.SetReplay(w.Header(), *u.replay)
+	}
+	if u.etag != "" {
+		w.Header().Set("ETag", u.etag)
+		if r.Header.Get("If-None-Match") == u.etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
+	user := "anonymous"
+	if claims, ok := middleware.GetClaimsFromContext(r.Context()); ok {
+		user = claims.Username
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write([]byte(user + " " + r.URL.Path))
+}
+
+func newCached(u *upstream) http.Handler {
+	return New(1<<20, nil).Middleware("/analysis/", time.Minute)(u)
+}
+
+type auditor struct {
+	events []audit.Event
+	err    error
+}
+
+func (a *auditor) Record(_ context.Context, event audit.Event) error {
+	if a.err != nil {
+		return a.err
+	}
+	a.events = append(a.events, event)
+	return nil
+}
+
+func do(h http.Handler, r *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+	return rec
+}
+
+func asUser(r *http.Request, username string) *http.Request {
+	claims := &jwt.Claims{UserID: uuid.NewV5(uuid.NamespaceOID, username), Username: username, Role: "teacher"}
+	return r.WithContext(context.WithValue(r.Context(), middleware.ClaimsKey, claims))
+}
+
+func TestMiddlewareCaches(t *testing.T) {
+	u := &upstream{}
+	h := newCached(u)
+
+	first := do(h, httptest.NewRequest(http.MethodGet, "/analysis/1?a=1&b=2", nil))
+	second := do(h, httptest.NewRequest(http.MethodGet, "/analysis/1?b=2&a=1", nil))
+
+	if got := first.Header().Get("X-Cache"); got != "MISS" {
+		t.Errorf("first X-Cache = %q, want MISS", got)
+	}
+	if got := second.Header().Get("X-Cache"); got != "HIT" {
+		t.Errorf("second X-Cache = %q, want HIT", got)
+	}
+	if second.Body.String() != first.Body.String() {
+		t.Errorf("cached body = %q, want %q", second.Body, first.Body)
+	}
+	if got := u.hits.Load(); got != 1 {
+		t.Errorf("upstream hits = %d, want 1", got)
+	}
+}
+
+func TestMiddlewareNoStore(t *testing.T) {
+	t.Run("request", func(t *testing.T) {
+		u := &upstream{}
+		h := newCached(u)
+
+		do(h, httptest.NewRequest(http.MethodGet, "/analysis/1", nil))
+
+		r := httptest.NewRequest(http.MethodGet, "/analysis/1", nil)
+		r.Header.Set("Cache-Control", "no-store")
+		rec := do(h, r)
+
+		if got := rec.Header().Get("X-Cache"); got != "" {
+			t.Errorf("X-Cache = %q, want the response of the upstream", got)
+		}
+		if got := u.hits.Load(); got != 2 {
+			t.Errorf("upstream hits = %d, want 2", got)
+		}
+	})
+
+	t.Run("response", func(t *testing.T) {
+		u := &upstream{cacheControl: "no-store"}
+		h := newCached(u)
+
+		for range 2 {
+			rec := do(h, httptest.NewRequest(http.MethodGet, "/analysis/1", nil))
+			if rec.Code != http.StatusOK || rec.Body.String() != "anonymous /analysis/1" {
+				t.Fatalf("response = %d %q", rec.Code, rec.Body)
+			}
+		}
+		if got := u.hits.Load(); got != 2 {
+			t.Errorf("upstream hits = %d, want 2, the no-store response was cached", got)
+		}
+	})
+}
+
+func TestMiddlewareKeysByUser(t *testing.T) {
+	u := &upstream{}
+	h := newCached(u)
+
+	alice := do(h, asUser(httptest.NewRequest(http.MethodGet, "/analysis/1", nil), "alice"))
+	bob := do(h, asUser(httptest.NewRequest(http.MethodGet, "/analysis/1", nil), "bob"))
+	anonymous := do(h, httptest.NewRequest(http.MethodGet, "/analysis/1", nil))
+
+	for rec, want := range map[*httptest.ResponseRecorder]string{
+		alice:     "alice /analysis/1",
+		bob:       "bob /analysis/1",
+		anonymous: "anonymous /analysis/1",
+	} {
+		if rec.Body.String() != want || rec.Header().Get("X-Cache") != "MISS" {
+			t.Errorf("response = %q (%s), want %q from the upstream", rec.Body, rec.Header().Get("X-Cache"), want)
+		}
+	}
+
+	again := do(h, asUser(httptest.NewRequest(http.MethodGet, "/analysis/1", nil), "alice"))
+	if again.Body.String() != "alice /analysis/1" || again.Header().Get("X-Cache") != "HIT" {
+		t.Errorf("second response of alice = %q (%s), want her cached one", again.Body, again.Header().Get("X-Cache"))
+	}
+}
+
+func TestMiddlewareNotModified(t *testing.T) {
+	t.Run("generated ETag", func(t *testing.T) {
+		u := &upstream{}
+		h := newCached(u)
+
+		etag := do(h, httptest.NewRequest(http.MethodGet, "/analysis/1", nil)).Header().Get("ETag")
+		if etag == "" {
+			t.Fatal("cached response has no ETag")
+		}
+
+		for _, ifNoneMatch := range []string{etag, `"other", W/` + etag, "*"} {
+			r := httptest.NewRequest(http.MethodGet, "/analysis/1", nil)
+			r.Header.Set("If-None-Match", ifNoneMatch)
+			rec := do(h, r)
+
+			if rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+				t.Errorf("If-None-Match %s: response = %d %q, want an empty 304", ifNoneMatch, rec.Code, rec.Body)
+			}
+		}
+
+		r := httptest.NewRequest(http.MethodGet, "/analysis/1", nil)
+		r.Header.Set("If-None-Match", `"other"`)
+		if rec := do(h, r); rec.Code != http.StatusOK {
+			t.Errorf("If-None-Match of another ETag: status = %d, want 200", rec.Code)
+		}
+		if got := u.hits.Load(); got != 1 {
+			t.Errorf("upstream hits = %d, want 1", got)
+		}
+	})
+
+	t.Run("revalidation", func(t *testing.T) {
+		// max-age=0 makes every request revalidate with the upstream
+		u := &upstream{cacheControl: "max-age=0", etag: `"v1"`}
+		h := newCached(u)
+
+		do(h, httptest.NewRequest(http.MethodGet, "/analysis/1", nil))
+		rec := do(h, httptest.NewRequest(http.MethodGet, "/analysis/1", nil))
+
+		if rec.Code != http.StatusOK || rec.Header().Get("X-Cache") != "REVALIDATED" {
+			t.Fatalf("response = %d (%s), want 200 REVALIDATED", rec.Code, rec.Header().Get("X-Cache"))
+		}
+		if rec.Body.String() != "anonymous /analysis/1" {
+			t.Errorf("revalidated body = %q", rec.Body)
+		}
+
+		r := httptest.NewRequest(http.MethodGet, "/analysis/1", nil)
+		r.Header.Set("If-None-Match", `"v1"`)
+		if rec := do(h, r); rec.Code != http.StatusNotModified {
+			t.Errorf("client revalidation status = %d, want 304", rec.Code)
+		}
+		if got := u.hits.Load(); got != 3 {
+			t.Errorf("upstream hits = %d, want 3", got)
+		}
+	})
+}
+
+func TestMiddlewareInvalidatesOnUnsafeMethods(t *testing.T) {
+	for _, method := range []string{http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete} {
+		t.Run(method, func(t *testing.T) {
+			u := &upstream{}
+			h := newCached(u)
+
+			do(h, asUser(httptest.NewRequest(http.MethodGet, "/analysis/1", nil), "alice"))
+			do(h, asUser(httptest.NewRequest(http.MethodGet, "/analysis/2", nil), "bob"))
+
+			// a change by one user drops the entries of everyone
+			do(h, asUser(httptest.NewRequest(method, "/analysis/1", nil), "bob"))
+
+			for user, path := range map[string]string{"alice": "/analysis/1", "bob": "/analysis/2"} {
+				rec := do(h, asUser(httptest.NewRequest(http.MethodGet, path, nil), user))
+				if got := rec.Header().Get("X-Cache"); got != "MISS" {
+					t.Errorf("X-Cache of %s after %s = %q, want MISS", user, method, got)
+				}
+			}
+			if got := u.hits.Load(); got != 5 {
+				t.Errorf("upstream hits = %d, want 5", got)
+			}
+		})
+	}
+}
+
+func TestMiddlewareAuditsHits(t *testing.T) {
+	event := audit.Event{Action: audit.ActionWordCloud, ResourceType: "file", ResourceID: "7"}
+
+	t.Run("hit and not modified", func(t *testing.T) {
+		u := &upstream{replay: &event}
+		a := &auditor{}
+		h := New(1<<20, a).Middleware("/analysis/", time.Minute)(u)
+
+		first := do(h, asUser(httptest.NewRequest(http.MethodGet, "/analysis/wordcloud/7", nil), "alice"))
+		if got := first.Header().Get(audit.ReplayHeader); got != "" {
+			t.Errorf("%s = %q reached the client", audit.ReplayHeader, got)
+		}
+		if len(a.events) != 0 {
+			t.Fatalf("recorded %d events for a miss, the upstream records those", len(a.events))
+		}
+
+		do(h, asUser(httptest.NewRequest(http.MethodGet, "/analysis/wordcloud/7", nil), "alice"))
+		conditional := asUser(httptest.NewRequest(http.MethodGet, "/analysis/wordcloud/7", nil), "alice")
+		conditional.Header.Set("If-None-Match", first.Header().Get("ETag"))
+		if rec := do(h, conditional); rec.Code != http.StatusNotModified {
+			t.Fatalf("conditional status = %d, want 304", rec.Code)
+		}
+
+		if len(a.events) != 2 {
+			t.Fatalf("recorded %d events, want 2", len(a.events))
+		}
+		got := a.events[0]
+		if got.Action != event.Action || got.ResourceID != "7" || got.Outcome != audit.OutcomeSuccess {
+			t.Errorf("event = %+v, want a successful %s of file 7", got, event.Action)
+		}
+		if got.ActorID != uuid.NewV5(uuid.NamespaceOID, "alice") || got.ActorRole != "teacher" {
+			t.Errorf("actor = %s %q, want alice as teacher", got.ActorID, got.ActorRole)
+		}
+		if got.Details["cache"] != "HIT" {
+			t.Errorf("details = %v, want cache HIT", got.Details)
+		}
+		if hits := u.hits.Load(); hits != 1 {
+			t.Errorf("upstream hits = %d, want 1", hits)
+		}
+	})
+
+	t.Run("failing audit log", func(t *testing.T) {
+		u := &upstream{replay: &event}
+		h := New(1<<20, &auditor{err: errors.New("down")}).Middleware("/analysis/", time.Minute)(u)
+
+		do(h, asUser(httptest.NewRequest(http.MethodGet, "/analysis/wordcloud/7", nil), "alice"))
+		do(h, asUser(httptest.NewRequest(http.MethodGet, "/analysis/wordcloud/7", nil), "alice"))
+
+		if hits := u.hits.Load(); hits != 2 {
+			t.Errorf("upstream hits = %d, want 2, views that cannot be recorded go upstream", hits)
+		}
+	})
+
+	t.Run("no auditor", func(t *testing.T) {
+		u := &upstream{replay: &event}
+		h := newCached(u)
+
+		do(h, asUser(httptest.NewRequest(http.MethodGet, "/analysis/wordcloud/7", nil), "alice"))
+		do(h, asUser(httptest.NewRequest(http.MethodGet, "/analysis/wordcloud/7", nil), "alice"))
+
+		if hits := u.hits.Load(); hits != 2 {
+			t.Errorf("upstream hits = %d, want 2, audited responses are not cached", hits)
+		}
+	})
+}
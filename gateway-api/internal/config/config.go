@@ -1,39 +1,69 @@
 package config
 
 import (
-	"errors"
-	"os"
+	"net/netip"
+	"slices"
+	"time"
+
+	"github.com/KEPTANy/plag-check/shared/bootstrap"
+	"github.com/KEPTANy/plag-check/shared/middleware"
 )
 
 type Config struct {
-	Port                  string
-	UserServiceURL        string
-	FileStorageServiceURL string
-	AnalysisServiceURL    string
+	Port           string
+	AdminPort      string
+	Lifecycle      bootstrap.Lifecycle
+	Database       bootstrap.Database
+	CacheSize      int
+	CORS           middleware.CORSConfig
+	RoutesFile     string
+	JWTSecret      string
+	IdentitySecret string
+
+	// TrustedProxies may set X-Forwarded-For, see middleware.ClientIP
+	TrustedProxies []netip.Prefix
 }
 
 func (c *Config) Load() error {
-	var ok bool
+	var env bootstrap.Env
 
-	c.Port, ok = os.LookupEnv("PORT")
-	if !ok {
-		return errors.New("Failed to load PORT variable")
-	}
+	c.Port = env.Required("PORT")
 
-	c.UserServiceURL, ok = os.LookupEnv("USER_SERVICE_URL")
-	if !ok {
-		return errors.New("Failed to load USER_SERVICE_URL variable")
-	}
+	// the admin API is not behind authentication and must not be published
+	c.AdminPort = env.String("ADMIN_PORT", "9090")
 
-	c.FileStorageServiceURL, ok = os.LookupEnv("FILE_STORAGE_SERVICE_URL")
-	if !ok {
-		return errors.New("Failed to load FILE_STORAGE_SERVICE_URL variable")
-	}
+	c.Lifecycle = bootstrap.LoadLifecycle(&env)
 
-	c.AnalysisServiceURL, ok = os.LookupEnv("ANALYSIS_SERVICE_URL")
-	if !ok {
-		return errors.New("Failed to load ANALYSIS_SERVICE_URL variable")
+	// load balancers in front of the gateway, none by default: clients
+	// connect directly and their X-Forwarded-For is ignored
+	c.TrustedProxies = env.Networks("TRUSTED_PROXIES", nil)
+
+	// the audit log, for views of audited responses answered from the cache
+	c.Database = bootstrap.LoadDatabase(&env)
+
+	c.CacheSize = env.Int("CACHE_SIZE", 64<<20)
+	env.Positive("CACHE_SIZE", int64(c.CacheSize))
+
+	// upstream addresses (USER_SERVICE_URL etc.) are referenced from the
+	// routes file and expanded when it is loaded
+	c.RoutesFile = env.String("ROUTES_FILE", "routes.json")
+
+	// CORS stays disabled until allowed origins are configured
+	c.CORS.AllowedOrigins = env.List("CORS_ALLOWED_ORIGINS", nil)
+	c.CORS.AllowedMethods = env.List("CORS_ALLOWED_METHODS",
+		[]string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"})
+	c.CORS.AllowedHeaders = env.List("CORS_ALLOWED_HEADERS",
+		[]string{"Authorization", "Content-Type", "If-None-Match", "X-Request-ID"})
+	c.CORS.ExposedHeaders = env.List("CORS_EXPOSED_HEADERS",
+		[]string{"Content-Disposition", "ETag", "Retry-After", "X-Cache", "X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset", "X-Request-ID"})
+	c.CORS.AllowCredentials = env.Bool("CORS_ALLOW_CREDENTIALS", false)
+	if c.CORS.AllowCredentials && slices.Contains(c.CORS.AllowedOrigins, "*") {
+		env.Fail("CORS_ALLOW_CREDENTIALS", `cannot be combined with CORS_ALLOWED_ORIGINS="*"`)
 	}
+	c.CORS.MaxAge = env.Duration("CORS_MAX_AGE", 10*time.Minute)
+
+	c.JWTSecret = env.Required("JWT_SECRET")
+	c.IdentitySecret = env.Required("INTERNAL_IDENTITY_SECRET")
 
-	return nil
+	return env.Err()
 }
@@ -0,0 +1,54 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func setRequired(t *testing.T) {
+	for name, value := range map[string]string{
+		"PORT":                     "8080",
+		"DB_HOST":                  "localhost",
+		"DB_USER":                  "postgres",
+		"DB_PASSWORD":              "password",
+		"DB_NAME":                  "users",
+		"JWT_SECRET":               "secret",
+		"INTERNAL_IDENTITY_SECRET": "internal-secret",
+	} {
+		t.Setenv(name, value)
+	}
+}
+
+func TestLoadCORS(t *testing.T) {
+	tests := []struct {
+		origins     string
+		credentials string
+		wantErr     bool
+	}{
+		{"", "", false},
+		{"https://app.example.com,https://*.example.org", "true", false},
+		{"*", "false", false},
+		{"*", "true", true},
+		{"https://app.example.com,*", "true", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.origins+" "+tt.credentials, func(t *testing.T) {
+			setRequired(t)
+			t.Setenv("CORS_ALLOWED_ORIGINS", tt.origins)
+			t.Setenv("CORS_ALLOW_CREDENTIALS", tt.credentials)
+
+			var c Config
+			err := c.Load()
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "CORS_ALLOW_CREDENTIALS") {
+					t.Errorf("Load() error = %v, want one about CORS_ALLOW_CREDENTIALS", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("Load() error = %v, want nil", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,38 @@
+// Package docs serves the OpenAPI description of the public API together with
+// a bundled Swagger UI, so the documentation works without internet access.
+package docs
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+//go:embed openapi.json
+var Spec []byte
+
+//go:embed swagger-ui
+var swaggerUI embed.FS
+
+// Handler serves Swagger UI at prefix and the spec at prefix + "openapi.json".
+// prefix must end with a slash.
+func Handler(prefix string) http.Handler {
+	ui, err := fs.Sub(swaggerUI, "swagger-ui")
+	if err != nil {
+		panic(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /openapi.json", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(Spec)
+	}))
+	mux.Handle("GET /", http.FileServerFS(ui))
+
+	return http.StripPrefix(prefix[:len(prefix)-1], http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Swagger UI needs its own scripts, inline styles and data: icons
+		w.Header().Set("Content-Security-Policy",
+			"default-src 'self'; style-src 'self' 'unsafe-inline'; img-src 'self' data:; frame-ancestors 'none'")
+		mux.ServeHTTP(w, r)
+	}))
+}
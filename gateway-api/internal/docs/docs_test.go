@@ -0,0 +1,68 @@
+package docs
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// matches mux.Handle("GET /files/{id}", ...) and mux.HandleFunc(...)
+var handlePattern = regexp.MustCompile(`\.Handle(?:Func)?\(\s*"([A-Z]+) (/[^"]*)"`)
+
+// documentation itself and the admin API are not part of the public API
+var ignoredPrefixes = []string{"/docs/", "/admin/", "/metrics"}
+
+// TestSpecCoversRoutes compares the routes registered in the cmd/main.go of
+// every service with the OpenAPI document, so a route cannot be added or
+// removed without updating the spec.
+func TestSpecCoversRoutes(t *testing.T) {
+	var spec struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(Spec, &spec); err != nil {
+		t.Fatalf("Failed to parse OpenAPI spec: %v", err)
+	}
+
+	// the repository root, relative to gateway-api/internal/docs
+	files, err := filepath.Glob(filepath.Join("..", "..", "..", "*", "cmd", "main.go"))
+	if err != nil || len(files) == 0 {
+		t.Fatal("No services found")
+	}
+
+	registered := make(map[string]bool)
+	for _, file := range files {
+		source, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, match := range handlePattern.FindAllStringSubmatch(string(source), -1) {
+			method, path := match[1], match[2]
+			if slices.ContainsFunc(ignoredPrefixes, func(prefix string) bool {
+				return strings.HasPrefix(path, prefix)
+			}) {
+				continue
+			}
+
+			registered[method+" "+path] = true
+			if _, ok := spec.Paths[path][strings.ToLower(method)]; !ok {
+				t.Errorf("%s %s registered in %s is missing from the spec", method, path, file)
+			}
+		}
+	}
+
+	for path, operations := range spec.Paths {
+		for method := range operations {
+			if method == "parameters" {
+				continue
+			}
+			if !registered[strings.ToUpper(method)+" "+path] {
+				t.Errorf("%s %s is in the spec but no service registers it", strings.ToUpper(method), path)
+			}
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/KEPTANy/plag-check/gateway-api/internal/proxy"
+)
+
+type AdminHandler struct {
+	Proxy *proxy.ReverseProxy
+}
+
+func NewAdminHandler(proxy *proxy.ReverseProxy) *AdminHandler {
+	return &AdminHandler{Proxy: proxy}
+}
+
+// Upstreams reports the circuit breaker state and instance health of every
+// upstream of the current route table.
+func (h *AdminHandler) Upstreams(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"upstreams": h.Proxy.Status(),
+	})
+}
+
+func (h *AdminHandler) Cache(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.Proxy.CacheStats())
+}
@@ -1,15 +1,48 @@
 package handler
 
-import "net/http"
+import (
+	"net/http"
 
-type HealthHandler struct{}
+	"github.com/KEPTANy/plag-check/gateway-api/internal/proxy"
+)
 
-func NewHealthHandler() *HealthHandler {
-	return &HealthHandler{}
+type HealthHandler struct {
+	Proxy *proxy.ReverseProxy
+	// Serving reports whether the gateway itself accepts traffic, it does not
+	// while starting or shutting down
+	Serving func() bool
 }
 
+func NewHealthHandler(proxy *proxy.ReverseProxy, serving func() bool) *HealthHandler {
+	return &HealthHandler{Proxy: proxy, Serving: serving}
+}
+
+// Health only tells that the gateway process is alive.
 func (h *HealthHandler) Health(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, map[string]any{
 		"status": "OK",
 	})
 }
+
+// Ready reports the backends behind the gateway as the health checkers last
+// saw them. A gateway that is not serving is reported unavailable.
+func (h *HealthHandler) Ready(w http.ResponseWriter, r *http.Request) {
+	if !h.Serving() {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]any{
+			"status": "unavailable",
+		})
+		return
+	}
+
+	ready, services := h.Proxy.Ready()
+
+	status, code := "OK", http.StatusOK
+	if !ready {
+		status, code = "unavailable", http.StatusServiceUnavailable
+	}
+
+	writeJSON(w, code, map[string]any{
+		"status":   status,
+		"services": services,
+	})
+}
@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/KEPTANy/plag-check/shared/apperror"
+	"github.com/KEPTANy/plag-check/shared/identity"
+	"github.com/KEPTANy/plag-check/shared/jwt"
+	sharedMiddleware "github.com/KEPTANy/plag-check/shared/middleware"
+)
+
+const identityTTL = time.Minute
+
+type contextKey string
+
+const ClaimsKey contextKey = "claims"
+
+// Authenticate validates the bearer token once at the edge. Requests without
+// a token pass through untouched (backends decide whether a route is public),
+// requests with a bad token are rejected. Identity headers supplied by the
+// client are always dropped, so backends only see what the gateway signed.
+func Authenticate(jwtSecret, identitySecret string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Header.Del("X-User-ID")
+			r.Header.Del("X-User-Role")
+			r.Header.Del(identity.Header)
+
+			authHeader := r.Header.Get("Authorization")
+			if authHeader == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			parts := strings.Split(authHeader, " ")
+			if len(parts) != 2 || parts[0] != "Bearer" {
+				apperror.Write(w, r, apperror.Unauthorized("invalid authorization header format"))
+				return
+			}
+
+			claims, err := jwt.GetTokenClaims(parts[1], jwtSecret)
+			if err != nil {
+				apperror.Write(w, r, apperror.Unauthorized("invalid or expired token"))
+				return
+			}
+
+			signed, err := identity.Sign(identity.Identity{
+				UserID:   claims.UserID,
+				Username: claims.Username,
+				Role:     claims.Role,
+			}, identityTTL, identitySecret)
+			if err != nil {
+				apperror.Write(w, r, apperror.Internal(fmt.Errorf("Failed to sign identity: %w", err)))
+				return
+			}
+
+			r.Header.Set(identity.Header, signed)
+			r.Header.Set("X-User-ID", claims.UserID.String())
+			r.Header.Set("X-User-Role", claims.Role)
+
+			ctx := context.WithValue(r.Context(), ClaimsKey, claims)
+			sharedMiddleware.SetRequestUser(ctx, claims.UserID.String())
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func GetClaimsFromContext(ctx context.Context) (*jwt.Claims, bool) {
+	claims, ok := ctx.Value(ClaimsKey).(*jwt.Claims)
+	return claims, ok
+}
@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/KEPTANy/plag-check/shared/identity"
+	"github.com/KEPTANy/plag-check/shared/jwt"
+	"github.com/gofrs/uuid/v5"
+)
+
+func TestAuthenticate(t *testing.T) {
+	userID := uuid.Must(uuid.NewV4())
+	token, err := jwt.GenerateToken(time.Hour, userID, "alice", "student", "jwt-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherToken, err := jwt.GenerateToken(time.Hour, userID, "alice", "teacher", "other-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		authorization string
+		wantStatus    int
+		wantIdentity  bool
+	}{
+		{"no token", "", http.StatusOK, false},
+		{"valid token", "Bearer " + token, http.StatusOK, true},
+		{"not bearer", "Basic " + token, http.StatusUnauthorized, false},
+		{"foreign token", "Bearer " + otherToken, http.StatusUnauthorized, false},
+		{"garbage", "Bearer garbage", http.StatusUnauthorized, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var forwarded http.Header
+			h := Authenticate("jwt-secret", "identity-secret")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				forwarded = r.Header.Clone()
+			}))
+
+			r := httptest.NewRequest(http.MethodGet, "/files/user/1", nil)
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+			// a client trying to pass as a teacher
+			r.Header.Set(identity.Header, "forged")
+			r.Header.Set("X-User-Role", "teacher")
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, r)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if rec.Code != http.StatusOK {
+				if forwarded != nil {
+					t.Error("rejected request reached the upstream")
+				}
+				return
+			}
+
+			signed := forwarded.Get(identity.Header)
+			if !tt.wantIdentity {
+				if signed != "" || forwarded.Get("X-User-Role") != "" {
+					t.Errorf("identity headers of the client were forwarded: %q, %q", signed, forwarded.Get("X-User-Role"))
+				}
+				return
+			}
+
+			id, err := identity.Verify(signed, "identity-secret")
+			if err != nil {
+				t.Fatalf("forwarded identity does not verify: %v", err)
+			}
+			if id.UserID != userID || id.Username != "alice" || id.Role != "student" {
+				t.Errorf("identity = %+v, want alice as student", id)
+			}
+			if got := forwarded.Get("X-User-Role"); got != "student" {
+				t.Errorf("X-User-Role = %q, want student", got)
+			}
+		})
+	}
+}
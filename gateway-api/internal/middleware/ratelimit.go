@@ -0,0 +1,124 @@
+package middleware
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/KEPTANy/plag-check/gateway-api/internal/router"
+	"github.com/KEPTANy/plag-check/shared/apperror"
+)
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// RateLimiter keeps a token bucket per client. Authenticated clients are
+// keyed by user ID, so a user gets the same budget from every address, and
+// anonymous ones by IP.
+type RateLimiter struct {
+	mu      sync.Mutex
+	limit   router.RateLimit
+	rate    float64 // tokens per second
+	buckets map[string]*bucket
+
+	now func() time.Time
+}
+
+func NewRateLimiter(limit router.RateLimit) *RateLimiter {
+	return &RateLimiter{
+		limit:   limit,
+		rate:    float64(limit.Requests) / time.Duration(limit.Per).Seconds(),
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+// Limit is the configuration the limiter was created with.
+func (l *RateLimiter) Limit() router.RateLimit {
+	return l.limit
+}
+
+// take spends a token of key. It returns whether the request is allowed, the
+// tokens left and how long until the next token is available.
+func (l *RateLimiter) take(key string) (bool, int, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	burst := float64(l.limit.Burst)
+
+	// a bucket idle long enough to be full again is the same as no bucket,
+	// drop those so the map does not grow forever
+	if len(l.buckets) > 10000 {
+		for k, b := range l.buckets {
+			if b.tokens+now.Sub(b.updated).Seconds()*l.rate >= burst {
+				delete(l.buckets, k)
+			}
+		}
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: burst, updated: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = min(burst, b.tokens+now.Sub(b.updated).Seconds()*l.rate)
+	b.updated = now
+
+	if b.tokens < 1 {
+		return false, 0, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	}
+
+	b.tokens--
+	return true, int(b.tokens), 0
+}
+
+// refillIn is how long until the bucket of a client with remaining tokens is
+// full again.
+func (l *RateLimiter) refillIn(remaining int) time.Duration {
+	missing := float64(l.limit.Burst - remaining)
+	return time.Duration(missing / l.rate * float64(time.Second))
+}
+
+func (l *RateLimiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ok, remaining, retryAfter := l.take(clientKey(r))
+
+		w.Header().Set("X-RateLimit-Limit", strconv.Itoa(l.limit.Burst))
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+		w.Header().Set("X-RateLimit-Reset", strconv.Itoa(seconds(l.refillIn(remaining))))
+
+		if !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(max(seconds(retryAfter), 1)))
+			apperror.Write(w, r, apperror.New(apperror.CodeRateLimited, "rate limit exceeded, try again later"))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// clientKey identifies the client a request is counted against. The gateway
+// is the edge, so the peer address is used and X-Forwarded-For supplied by
+// clients is not trusted.
+func clientKey(r *http.Request) string {
+	if claims, ok := GetClaimsFromContext(r.Context()); ok {
+		return "user:" + claims.UserID.String()
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
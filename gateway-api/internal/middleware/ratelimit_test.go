@@ -0,0 +1,165 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/KEPTANy/plag-check/gateway-api/internal/router"
+	"github.com/KEPTANy/plag-check/shared/jwt"
+	"github.com/gofrs/uuid/v5"
+)
+
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	return c.now
+}
+
+func (c *clock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+// newTestLimiter allows requests per minute, with a burst of burst.
+func newTestLimiter(requests, burst int) (*RateLimiter, *clock) {
+	c := &clock{now: time.Unix(1_700_000_000, 0)}
+	limiter := NewRateLimiter(router.RateLimit{
+		Requests: requests,
+		Per:      router.Duration(time.Minute),
+		Burst:    burst,
+	})
+	limiter.now = c.Now
+	return limiter, c
+}
+
+func limited(limiter *RateLimiter, r *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	limiter.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})).ServeHTTP(rec, r)
+	return rec
+}
+
+func requestFrom(addr string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/files/1", nil)
+	r.RemoteAddr = addr
+	return r
+}
+
+func TestRateLimiterBurst(t *testing.T) {
+	limiter, _ := newTestLimiter(60, 3)
+
+	for i := range 3 {
+		if ok, remaining, _ := limiter.take("ip:1"); !ok || remaining != 2-i {
+			t.Fatalf("take %d = %v, %d remaining, want allowed with %d", i, ok, remaining, 2-i)
+		}
+	}
+
+	ok, remaining, retryAfter := limiter.take("ip:1")
+	if ok || remaining != 0 {
+		t.Fatalf("take after the burst = %v, %d remaining, want denied", ok, remaining)
+	}
+	// 60 per minute, the next token is a second away
+	if retryAfter != time.Second {
+		t.Errorf("retry after = %s, want 1s", retryAfter)
+	}
+
+	// clients have their own buckets
+	if ok, _, _ := limiter.take("ip:2"); !ok {
+		t.Error("another client is limited by the first one")
+	}
+}
+
+func TestRateLimiterRefill(t *testing.T) {
+	limiter, clock := newTestLimiter(60, 3)
+
+	for range 3 {
+		limiter.take("ip:1")
+	}
+
+	clock.Advance(500 * time.Millisecond)
+	if ok, _, retryAfter := limiter.take("ip:1"); ok || retryAfter != 500*time.Millisecond {
+		t.Fatalf("take after half a token = %v, retry after %s, want denied for 500ms", ok, retryAfter)
+	}
+
+	clock.Advance(500 * time.Millisecond)
+	if ok, remaining, _ := limiter.take("ip:1"); !ok || remaining != 0 {
+		t.Fatalf("take after a refill = %v, %d remaining, want allowed with 0", ok, remaining)
+	}
+
+	// an idle bucket fills up to the burst, not beyond
+	clock.Advance(time.Hour)
+	for i := range 3 {
+		if ok, _, _ := limiter.take("ip:1"); !ok {
+			t.Fatalf("take %d after idling denied", i)
+		}
+	}
+	if ok, _, _ := limiter.take("ip:1"); ok {
+		t.Fatal("idle bucket holds more than the burst")
+	}
+}
+
+func TestRateLimiterHeaders(t *testing.T) {
+	limiter, _ := newTestLimiter(60, 2)
+
+	rec := limited(limiter, requestFrom("10.0.0.1:1234"))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusNoContent)
+	}
+	for header, want := range map[string]string{
+		"X-RateLimit-Limit":     "2",
+		"X-RateLimit-Remaining": "1",
+		"X-RateLimit-Reset":     "1",
+	} {
+		if got := rec.Header().Get(header); got != want {
+			t.Errorf("%s = %q, want %q", header, got, want)
+		}
+	}
+	if got := rec.Header().Get("Retry-After"); got != "" {
+		t.Errorf("Retry-After = %q on an allowed request", got)
+	}
+
+	// another port of the same address is the same client
+	limited(limiter, requestFrom("10.0.0.1:5678"))
+
+	rec = limited(limiter, requestFrom("10.0.0.1:1234"))
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusTooManyRequests)
+	}
+	if got := rec.Header().Get("X-RateLimit-Remaining"); got != "0" {
+		t.Errorf("X-RateLimit-Remaining = %q, want 0", got)
+	}
+	if got := rec.Header().Get("X-RateLimit-Reset"); got != "2" {
+		t.Errorf("X-RateLimit-Reset = %q, want 2", got)
+	}
+	if got, err := strconv.Atoi(rec.Header().Get("Retry-After")); err != nil || got != 1 {
+		t.Errorf("Retry-After = %q, want 1", rec.Header().Get("Retry-After"))
+	}
+}
+
+func TestRateLimiterKeysUsersByID(t *testing.T) {
+	limiter, _ := newTestLimiter(60, 1)
+
+	claims := &jwt.Claims{UserID: uuid.Must(uuid.NewV4()), Username: "student", Role: "student"}
+	asUser := func(addr string) *http.Request {
+		r := requestFrom(addr)
+		return r.WithContext(context.WithValue(r.Context(), ClaimsKey, claims))
+	}
+
+	if rec := limited(limiter, asUser("10.0.0.1:1")); rec.Code != http.StatusNoContent {
+		t.Fatalf("first request status = %d", rec.Code)
+	}
+	// the user has one budget, whatever address it comes from
+	if rec := limited(limiter, asUser("10.0.0.2:1")); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("same user from another address status = %d, want %d", rec.Code, http.StatusTooManyRequests)
+	}
+	// and it is not shared with anonymous clients of the same address
+	if rec := limited(limiter, requestFrom("10.0.0.1:1")); rec.Code != http.StatusNoContent {
+		t.Errorf("anonymous request status = %d, want %d", rec.Code, http.StatusNoContent)
+	}
+}
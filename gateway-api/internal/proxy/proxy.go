@@ -1,95 +1,426 @@
 package proxy
 
 import (
-	"io"
-	"log"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"net"
 	"net/http"
+	"net/http/httputil"
 	"net/url"
+	"slices"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
+
+	"github.com/KEPTANy/plag-check/gateway-api/internal/balancer"
+	"github.com/KEPTANy/plag-check/gateway-api/internal/breaker"
+	"github.com/KEPTANy/plag-check/gateway-api/internal/cache"
+	"github.com/KEPTANy/plag-check/gateway-api/internal/middleware"
+	"github.com/KEPTANy/plag-check/gateway-api/internal/router"
+	"github.com/KEPTANy/plag-check/shared/apperror"
+	sharedMiddleware "github.com/KEPTANy/plag-check/shared/middleware"
+	"github.com/KEPTANy/plag-check/shared/tracing"
 )
 
+// state is an immutable snapshot of the route table together with the
+// instance pools of its upstreams. Reloading swaps the whole snapshot, so
+// in-flight requests finish on the table they started with.
+type state struct {
+	table    *router.Table
+	pools    map[string]*balancer.Pool
+	limiters map[string]*middleware.RateLimiter // by route prefix
+}
+
 type ReverseProxy struct {
-	userServiceURL        string
-	fileStorageServiceURL string
-	analysisServiceURL    string
+	transport *http.Transport
+	// the cache outlives reloads, entries are keyed by path, not route
+	cache *cache.Cache
+	state atomic.Pointer[state]
 }
 
-func NewReverseProxy(userServiceURL, fileStorageServiceURL, analysisServiceURL string) *ReverseProxy {
-	return &ReverseProxy{
-		userServiceURL:        userServiceURL,
-		fileStorageServiceURL: fileStorageServiceURL,
-		analysisServiceURL:    analysisServiceURL,
+// NewTransport returns the transport shared by all upstreams, so connections
+// to backends are pooled and reused between requests.
+func NewTransport() *http.Transport {
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   5 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          200,
+		MaxIdleConnsPerHost:   64,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   5 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
 	}
 }
 
-func (p *ReverseProxy) ProxyRequest(w http.ResponseWriter, r *http.Request) {
-	targetURL := p.getTargetURL(r.URL.Path)
-	if targetURL == "" {
-		http.Error(w, `{"error": "route not found"}`, http.StatusNotFound)
-		return
+func NewReverseProxy(table *router.Table, cacheSize int, auditor cache.Auditor) (*ReverseProxy, error) {
+	p := &ReverseProxy{
+		transport: NewTransport(),
+		cache:     cache.New(cacheSize, auditor),
 	}
+	if err := p.Reload(table); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
 
-	target, err := url.Parse(targetURL)
-	if err != nil {
-		log.Printf("Failed to parse target URL: %v", err)
-		http.Error(w, `{"error": "internal error"}`, http.StatusInternalServerError)
-		return
+// Reload replaces the route table. The transport and its idle connections
+// are kept, so reloading does not drop connections to backends.
+func (p *ReverseProxy) Reload(table *router.Table) error {
+	next := &state{
+		table:    table,
+		pools:    make(map[string]*balancer.Pool, len(table.Upstreams)),
+		limiters: make(map[string]*middleware.RateLimiter),
 	}
 
-	proxyURL := *target
-	proxyURL.Path = r.URL.Path
-	proxyURL.RawQuery = r.URL.RawQuery
+	for name, upstream := range table.Upstreams {
+		var instances []*balancer.Instance
+		for _, rawURL := range upstream.URLs {
+			target, err := url.Parse(rawURL)
+			if err != nil {
+				return fmt.Errorf("Failed to parse upstream URL for %s: %w", name, err)
+			}
 
-	req, err := http.NewRequest(r.Method, proxyURL.String(), r.Body)
-	if err != nil {
-		log.Printf("Failed to create proxy request: %v", err)
-		http.Error(w, `{"error": "internal error"}`, http.StatusInternalServerError)
-		return
+			// health probes share the transport untraced, they would start a
+			// trace every few seconds
+			instances = append(instances, &balancer.Instance{
+				URL:     target,
+				Handler: newSingleHostProxy(target, tracing.Transport(p.transport)),
+			})
+		}
+
+		next.pools[name] = balancer.NewPool(name, upstream, instances, p.transport)
 	}
 
-	for key, values := range r.Header {
-		if strings.ToLower(key) == "host" {
+	// keep the buckets of routes whose limit did not change, so a reload
+	// does not hand every client a fresh budget
+	prev := p.state.Load()
+	for _, route := range table.Routes {
+		if route.RateLimit == nil {
 			continue
 		}
-		for _, value := range values {
-			req.Header.Add(key, value)
+		if limiter, ok := prev.limiter(route.Prefix); ok && limiter.Limit() == *route.RateLimit {
+			next.limiters[route.Prefix] = limiter
+			continue
 		}
+		next.limiters[route.Prefix] = middleware.NewRateLimiter(*route.RateLimit)
 	}
 
-	client := &http.Client{
-		Timeout: 30 * time.Second,
+	// the old health checkers stop before their results are taken over,
+	// requests keep going to the old pools until the swap
+	if prev != nil {
+		prev.stop()
+	}
+	for name, pool := range next.pools {
+		if old, ok := prev.pool(name); ok {
+			pool.Adopt(old)
+		}
+		pool.Start()
+	}
+
+	p.state.Store(next)
+
+	return nil
+}
+
+// Stop terminates the health checkers of the current upstreams.
+func (p *ReverseProxy) Stop() {
+	if current := p.state.Load(); current != nil {
+		current.stop()
+	}
+}
+
+func (s *state) limiter(prefix string) (*middleware.RateLimiter, bool) {
+	if s == nil {
+		return nil, false
+	}
+	limiter, ok := s.limiters[prefix]
+	return limiter, ok
+}
+
+func (s *state) pool(name string) (*balancer.Pool, bool) {
+	if s == nil {
+		return nil, false
+	}
+	pool, ok := s.pools[name]
+	return pool, ok
+}
+
+func (s *state) stop() {
+	for _, pool := range s.pools {
+		pool.Stop()
 	}
-	resp, err := client.Do(req)
-	if err != nil {
-		log.Printf("Failed to proxy request: %v", err)
-		http.Error(w, `{"error": "service unavailable"}`, http.StatusServiceUnavailable)
+}
+
+func newSingleHostProxy(target *url.URL, transport http.RoundTripper) *httputil.ReverseProxy {
+	return &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(target)
+			pr.SetXForwarded()
+			// behind a trusted load balancer the client is not the peer
+			if ip := sharedMiddleware.GetClientIP(pr.In.Context()); ip != "" {
+				pr.Out.Header.Set("X-Forwarded-For", ip)
+			}
+		},
+		Transport: transport,
+		// flush as soon as data arrives, downloads should not be buffered
+		FlushInterval:  -1,
+		ModifyResponse: checkResponse,
+		ErrorHandler:   proxyErrorHandler,
+	}
+}
+
+var errRetryableStatus = errors.New("upstream returned a retryable status")
+
+type attemptKey struct{}
+
+// attempt is the outcome of sending a request to one instance. It travels in
+// the request context so the proxy callbacks can report back to forward.
+type attempt struct {
+	final  bool
+	failed bool
+	retry  bool
+}
+
+func getAttempt(r *http.Request) *attempt {
+	a, _ := r.Context().Value(attemptKey{}).(*attempt)
+	return a
+}
+
+func isFailureStatus(code int) bool {
+	return code == http.StatusBadGateway || code == http.StatusServiceUnavailable || code == http.StatusGatewayTimeout
+}
+
+// checkResponse marks gateway-class statuses as failures. Unless this is the
+// last attempt, the response is discarded so the request can be retried.
+func checkResponse(resp *http.Response) error {
+	// the gateway already answers with the request ID it sent upstream
+	resp.Header.Del(sharedMiddleware.RequestIDHeader)
+
+	a := getAttempt(resp.Request)
+	if a == nil || !isFailureStatus(resp.StatusCode) {
+		return nil
+	}
+
+	a.failed = true
+	if a.final {
+		return nil
+	}
+	return errRetryableStatus
+}
+
+func proxyErrorHandler(w http.ResponseWriter, r *http.Request, err error) {
+	a := getAttempt(r)
+
+	if errors.Is(err, context.Canceled) {
+		// the client went away, nobody is left to read the response
 		return
 	}
-	defer resp.Body.Close()
 
-	for key, values := range resp.Header {
-		for _, value := range values {
-			w.Header().Add(key, value)
+	if a != nil {
+		a.failed = true
+		if !a.final {
+			a.retry = true
+			return
 		}
 	}
 
-	w.WriteHeader(resp.StatusCode)
+	if errors.Is(err, context.DeadlineExceeded) {
+		apperror.Write(w, r, apperror.New(apperror.CodeTimeout, "upstream timeout").Wrap(err))
+		return
+	}
+	apperror.Write(w, r, apperror.New(apperror.CodeUnavailable, "service unavailable").Wrap(err))
+}
 
-	if resp.Body != nil {
-		io.Copy(w, resp.Body)
+func (p *ReverseProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	current := p.state.Load()
+
+	route := current.table.Match(r.URL.Path)
+	if route == nil {
+		apperror.Write(w, r, apperror.NotFound("route not found"))
+		return
+	}
+	sharedMiddleware.SetRequestRoute(r.Context(), route.Prefix)
+
+	// OPTIONS is answered by the gateway, CORS preflight requests never get
+	// here, they are handled by the CORS middleware
+	allow := strings.Join(route.Methods, ", ") + ", " + http.MethodOptions
+	if r.Method == http.MethodOptions {
+		w.Header().Set("Allow", allow)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if !route.AllowsMethod(r.Method) {
+		w.Header().Set("Allow", allow)
+		apperror.Write(w, r, apperror.New(apperror.CodeMethodNotAllowed, "method not allowed"))
+		return
+	}
+
+	if route.Auth == router.AuthRequired {
+		claims, ok := middleware.GetClaimsFromContext(r.Context())
+		if !ok {
+			apperror.Write(w, r, apperror.Unauthorized("authorization header required"))
+			return
+		}
+
+		if len(route.Roles) > 0 && !slices.Contains(route.Roles, claims.Role) {
+			apperror.Write(w, r, apperror.Forbidden("insufficient permissions"))
+			return
+		}
+	}
+
+	var next http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if route.Timeout > 0 {
+			ctx, cancel := context.WithTimeout(r.Context(), time.Duration(route.Timeout))
+			defer cancel()
+			r = r.WithContext(ctx)
+		}
+
+		forward(w, r, current.pools[route.Upstream])
+	})
+
+	if route.Cache != nil {
+		next = p.cache.Middleware(route.Prefix, time.Duration(route.Cache.TTL))(next)
+	}
+
+	if limiter, ok := current.limiters[route.Prefix]; ok {
+		next = limiter.Middleware(next)
+	}
+
+	next.ServeHTTP(w, r)
+}
+
+// forward sends the request to an instance of the pool. Idempotent requests
+// without a body are retried on another instance with jittered exponential
+// backoff when the upstream fails, as long as nothing was written to the
+// client yet.
+func forward(w http.ResponseWriter, r *http.Request, pool *balancer.Pool) {
+	attempts := 1
+	idempotent := r.Method == http.MethodGet || r.Method == http.MethodHead
+	if idempotent && (r.Body == nil || r.Body == http.NoBody || r.ContentLength == 0) {
+		attempts += pool.Retry.Attempts
+	}
+
+	for i := 0; ; i++ {
+		ticket, ok := pool.Breaker.Allow()
+		if !ok {
+			retryAfter := int(math.Ceil(pool.Breaker.RetryAfter().Seconds()))
+			w.Header().Set("Retry-After", strconv.Itoa(max(retryAfter, 1)))
+			apperror.Write(w, r, apperror.New(apperror.CodeUnavailable, "service unavailable, circuit open"))
+			return
+		}
+
+		instance := pool.Next()
+		if instance == nil {
+			pool.Breaker.Record(ticket, false)
+			apperror.Write(w, r, apperror.New(apperror.CodeUnavailable, "service unavailable"))
+			return
+		}
+
+		a := &attempt{final: i == attempts-1}
+		instance.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), attemptKey{}, a)))
+
+		if r.Context().Err() != nil && !errors.Is(r.Context().Err(), context.DeadlineExceeded) {
+			// cancelled by the client, says nothing about the upstream
+			pool.Breaker.Release(ticket)
+			return
+		}
+		pool.Breaker.Record(ticket, !a.failed)
+
+		if !a.retry {
+			return
+		}
+
+		select {
+		case <-time.After(backoff(pool.Retry, i)):
+		case <-r.Context().Done():
+			apperror.Write(w, r, apperror.New(apperror.CodeTimeout, "upstream timeout"))
+			return
+		}
 	}
 }
 
-func (p *ReverseProxy) getTargetURL(path string) string {
-	if strings.HasPrefix(path, "/auth/") {
-		return p.userServiceURL
+// backoff returns a random delay in [0, min(max, base * 2^attempt)), the
+// "full jitter" strategy that spreads retries of many clients apart.
+func backoff(retry router.Retry, attempt int) time.Duration {
+	ceiling := time.Duration(retry.Backoff) << attempt
+	if ceiling <= 0 || ceiling > time.Duration(retry.MaxBackoff) {
+		ceiling = time.Duration(retry.MaxBackoff)
 	}
-	if strings.HasPrefix(path, "/files/") {
-		return p.fileStorageServiceURL
+	return time.Duration(rand.Int64N(int64(ceiling) + 1))
+}
+
+type UpstreamStatus struct {
+	Breaker   breaker.Status   `json:"circuit_breaker"`
+	Instances []InstanceStatus `json:"instances"`
+}
+
+type InstanceStatus struct {
+	URL     string `json:"url"`
+	Healthy bool   `json:"healthy"`
+}
+
+func (p *ReverseProxy) CacheStats() cache.Stats {
+	return p.cache.Stats()
+}
+
+// Status reports the circuit breaker and instance health of every upstream.
+func (p *ReverseProxy) Status() map[string]UpstreamStatus {
+	current := p.state.Load()
+
+	status := make(map[string]UpstreamStatus, len(current.pools))
+	for name, pool := range current.pools {
+		upstream := UpstreamStatus{Breaker: pool.Breaker.Status()}
+		for _, instance := range pool.Instances {
+			upstream.Instances = append(upstream.Instances, InstanceStatus{
+				URL:     instance.URL.String(),
+				Healthy: instance.Healthy(),
+			})
+		}
+		status[name] = upstream
 	}
-	if strings.HasPrefix(path, "/analysis/") {
-		return p.analysisServiceURL
+
+	return status
+}
+
+// ServiceHealth is reported on a public endpoint, so it leaves out instance
+// addresses and errors, those are logged instead.
+type ServiceHealth struct {
+	Status         string `json:"status"`
+	InstancesUp    int    `json:"instances_up"`
+	InstancesTotal int    `json:"instances_total"`
+}
+
+// Ready reports the health of every upstream as last seen by the health
+// checkers of the pools, without sending any requests itself. A service is up
+// if at least one of its instances is healthy, the system is ready if all
+// services are up.
+func (p *ReverseProxy) Ready() (bool, map[string]ServiceHealth) {
+	current := p.state.Load()
+
+	ready := true
+	services := make(map[string]ServiceHealth, len(current.pools))
+	for name, pool := range current.pools {
+		service := ServiceHealth{Status: "unavailable", InstancesTotal: len(pool.Instances)}
+		for _, instance := range pool.Instances {
+			if instance.Healthy() {
+				service.Status = "OK"
+				service.InstancesUp++
+			}
+		}
+		if service.Status != "OK" {
+			ready = false
+		}
+		services[name] = service
 	}
-	return ""
+
+	return ready, services
 }
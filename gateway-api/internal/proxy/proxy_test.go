@@ -0,0 +1,444 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/KEPTANy/plag-check/gateway-api/internal/router"
+	sharedMiddleware "github.com/KEPTANy/plag-check/shared/middleware"
+)
+
+// loadTable writes a routes file and loads it, so defaults and validation
+// apply as in production.
+func loadTable(t *testing.T, routes string) *router.Table {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "routes.json")
+	if err := os.WriteFile(path, []byte(routes), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	table, err := router.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return table
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func instanceHealth(p *ReverseProxy, upstream string) map[string]bool {
+	health := make(map[string]bool)
+	for _, instance := range p.Status()[upstream].Instances {
+		health[instance.URL] = instance.Healthy
+	}
+	return health
+}
+
+func TestReloadKeepsInstanceHealth(t *testing.T) {
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer up.Close()
+
+	routes := `{
+		"upstreams": {
+			"files": {
+				"urls": ["` + down.URL + `", "` + up.URL + `"],
+				"health_check": {"interval": "20ms", "unhealthy_threshold": 1, "healthy_threshold": 3}
+			}
+		},
+		"routes": [{"prefix": "/files/", "methods": ["GET"], "upstream": "files"}]
+	}`
+
+	p, err := NewReverseProxy(loadTable(t, routes), 1<<20, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Stop()
+
+	waitFor(t, "the failing instance to be ejected", func() bool {
+		return !instanceHealth(p, "files")[down.URL]
+	})
+
+	// same instances plus a new one, the reload must not readmit the
+	// ejected instance before it passes its health checks
+	extra := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer extra.Close()
+
+	reloaded := strings.Replace(routes, `"`+up.URL+`"`, `"`+up.URL+`", "`+extra.URL+`"`, 1)
+	if err := p.Reload(loadTable(t, reloaded)); err != nil {
+		t.Fatal(err)
+	}
+
+	health := instanceHealth(p, "files")
+	if health[down.URL] {
+		t.Errorf("ejected instance %s is healthy after reload", down.URL)
+	}
+	if !health[up.URL] || !health[extra.URL] {
+		t.Errorf("health after reload = %v, want %s and %s healthy", health, up.URL, extra.URL)
+	}
+}
+
+// flakyBackend answers the first failures requests with 503 and the rest
+// with 200. Health probes always pass and are not counted.
+type flakyBackend struct {
+	*httptest.Server
+	failures int
+	hits     atomic.Int32
+}
+
+func newFlakyBackend(t *testing.T, failures int) *flakyBackend {
+	t.Helper()
+
+	b := &flakyBackend{failures: failures}
+	b.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/health" {
+			return
+		}
+		if int(b.hits.Add(1)) <= b.failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	t.Cleanup(b.Close)
+
+	return b
+}
+
+func retryRoutes(urls ...string) string {
+	return `{
+		"upstreams": {
+			"files": {
+				"urls": ["` + strings.Join(urls, `", "`) + `"],
+				"health_check": {"interval": "1h"},
+				"circuit_breaker": {"failure_threshold": 100},
+				"retry": {"attempts": 2, "backoff": "1ms", "max_backoff": "2ms"}
+			}
+		},
+		"routes": [{"prefix": "/files/", "methods": ["GET", "HEAD", "POST", "DELETE"], "upstream": "files"}]
+	}`
+}
+
+func TestForwardRetries(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		body       string
+		failures   int
+		wantStatus int
+		wantHits   int32
+	}{
+		{"GET is retried", http.MethodGet, "", 1, http.StatusOK, 2},
+		{"HEAD is retried", http.MethodHead, "", 2, http.StatusOK, 3},
+		{"GET gives up after the retries", http.MethodGet, "", 5, http.StatusServiceUnavailable, 3},
+		{"GET with a body is not retried", http.MethodGet, "query", 1, http.StatusServiceUnavailable, 1},
+		{"POST is not retried", http.MethodPost, "", 1, http.StatusServiceUnavailable, 1},
+		{"POST with a body is not retried", http.MethodPost, "data", 1, http.StatusServiceUnavailable, 1},
+		{"DELETE is not retried", http.MethodDelete, "", 1, http.StatusServiceUnavailable, 1},
+		{"success is not retried", http.MethodGet, "", 0, http.StatusOK, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := newFlakyBackend(t, tt.failures)
+
+			p, err := NewReverseProxy(loadTable(t, retryRoutes(backend.URL)), 1<<20, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer p.Stop()
+
+			var body io.Reader
+			if tt.body != "" {
+				body = strings.NewReader(tt.body)
+			}
+
+			rec := httptest.NewRecorder()
+			p.ServeHTTP(rec, httptest.NewRequest(tt.method, "/files/1", body))
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if got := backend.hits.Load(); got != tt.wantHits {
+				t.Errorf("upstream hits = %d, want %d", got, tt.wantHits)
+			}
+		})
+	}
+}
+
+func TestForwardRetriesOnAnotherInstance(t *testing.T) {
+	// an instance that refuses connections
+	dead := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	dead.Close()
+
+	backend := newFlakyBackend(t, 0)
+
+	p, err := NewReverseProxy(loadTable(t, retryRoutes(dead.URL, backend.URL)), 1<<20, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Stop()
+
+	// round robin starts at either instance, two requests hit the dead one
+	for range 2 {
+		rec := httptest.NewRecorder()
+		p.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/files/1", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/files/1", nil))
+	rec2 := httptest.NewRecorder()
+	p.ServeHTTP(rec2, httptest.NewRequest(http.MethodPost, "/files/1", nil))
+	if rec.Code != http.StatusServiceUnavailable && rec2.Code != http.StatusServiceUnavailable {
+		t.Errorf("POST statuses = %d, %d, want one 503 from the dead instance", rec.Code, rec2.Code)
+	}
+}
+
+func TestForwardOpensBreaker(t *testing.T) {
+	backend := newFlakyBackend(t, 100)
+
+	routes := strings.Replace(retryRoutes(backend.URL),
+		`"circuit_breaker": {"failure_threshold": 100}`,
+		`"circuit_breaker": {"failure_threshold": 2, "open_timeout": "1m"}`, 1)
+
+	p, err := NewReverseProxy(loadTable(t, routes), 1<<20, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Stop()
+
+	// every failed attempt counts, the retries of one request open it
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/files/1", nil))
+
+	rec = httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/files/1", nil))
+
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") == "" {
+		t.Fatalf("status = %d, Retry-After = %q, want 503 with Retry-After", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	if !strings.Contains(rec.Body.String(), "circuit open") {
+		t.Errorf("body = %s, want circuit open error", rec.Body)
+	}
+	if got := backend.hits.Load(); got != 2 {
+		t.Errorf("upstream hits = %d, want 2", got)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	retry := router.Retry{Backoff: router.Duration(100 * time.Millisecond), MaxBackoff: router.Duration(time.Second)}
+
+	for attempt, ceiling := range []time.Duration{
+		100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second,
+	} {
+		for range 100 {
+			if got := backoff(retry, attempt); got < 0 || got > ceiling {
+				t.Fatalf("backoff(%d) = %s, want within [0, %s]", attempt, got, ceiling)
+			}
+		}
+	}
+}
+
+func TestReloadKeepsUnchangedLimiters(t *testing.T) {
+	routes := `{
+		"upstreams": {"files": {"url": "http://127.0.0.1:1", "health_check": {"interval": "1h"}}},
+		"routes": [
+			{"prefix": "/files/", "methods": ["GET"], "upstream": "files", "rate_limit": {"requests": 10, "per": "1m"}},
+			{"prefix": "/analysis/", "methods": ["GET"], "upstream": "files", "rate_limit": {"requests": 5, "per": "1m"}}
+		]
+	}`
+
+	p, err := NewReverseProxy(loadTable(t, routes), 1<<20, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Stop()
+
+	files, _ := p.state.Load().limiter("/files/")
+	analysis, _ := p.state.Load().limiter("/analysis/")
+
+	// same file, e.g. SIGHUP without changes
+	if err := p.Reload(loadTable(t, routes)); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := p.state.Load().limiter("/files/"); got != files {
+		t.Error("limiter of an unchanged route was replaced")
+	}
+
+	// a changed limit starts over with a new bucket
+	changed := strings.Replace(routes, `"requests": 5,`, `"requests": 50,`, 1)
+	if err := p.Reload(loadTable(t, changed)); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := p.state.Load().limiter("/files/"); got != files {
+		t.Error("limiter of an unchanged route was replaced by an unrelated change")
+	}
+	got, _ := p.state.Load().limiter("/analysis/")
+	if got == analysis || got.Limit().Requests != 50 {
+		t.Errorf("limiter of a changed route = %+v, want a new one with 50 requests", got.Limit())
+	}
+}
+
+func TestForwardStreamsWithForwardedHeaders(t *testing.T) {
+	release := make(chan struct{})
+	var forwarded http.Header
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded = r.Header.Clone()
+		w.Write([]byte("first"))
+		w.(http.Flusher).Flush()
+		<-release
+		w.Write([]byte("second"))
+	}))
+	defer backend.Close()
+	defer close(release)
+
+	p, err := NewReverseProxy(loadTable(t, retryRoutes(backend.URL)), 1<<20, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Stop()
+
+	gateway := httptest.NewServer(p)
+	defer gateway.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, gateway.URL+"/files/1", nil)
+	req.Host = "plagcheck.example.com"
+	req.Header.Set("X-Forwarded-For", "198.51.100.1")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	// the first chunk arrives while the upstream is still writing
+	first := make([]byte, len("first"))
+	if _, err := io.ReadFull(resp.Body, first); err != nil || string(first) != "first" {
+		t.Fatalf("read %q, %v before the upstream finished, want first", first, err)
+	}
+
+	// whatever the client wrote is dropped, backends trust this header
+	if got := forwarded.Get("X-Forwarded-For"); got != "127.0.0.1" {
+		t.Errorf("X-Forwarded-For = %q, want the address of the client only", got)
+	}
+	if got := forwarded.Get("X-Forwarded-Host"); got != "plagcheck.example.com" {
+		t.Errorf("X-Forwarded-Host = %q, want plagcheck.example.com", got)
+	}
+	if got := forwarded.Get("X-Forwarded-Proto"); got != "http" {
+		t.Errorf("X-Forwarded-Proto = %q, want http", got)
+	}
+}
+
+func TestForwardNamesClientBehindTrustedProxy(t *testing.T) {
+	var forwarded string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded = r.Header.Get("X-Forwarded-For")
+	}))
+	defer backend.Close()
+
+	p, err := NewReverseProxy(loadTable(t, retryRoutes(backend.URL)), 1<<20, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Stop()
+
+	// the test client plays the load balancer
+	trusted := []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8")}
+	gateway := httptest.NewServer(sharedMiddleware.ClientIP(trusted)(p))
+	defer gateway.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, gateway.URL+"/files/1", nil)
+	req.Header.Set("X-Forwarded-For", "10.0.0.1, 198.51.100.1")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if forwarded != "198.51.100.1" {
+		t.Errorf("X-Forwarded-For = %q, want the client named by the load balancer", forwarded)
+	}
+}
+
+func TestReadyReportsHealthChecks(t *testing.T) {
+	var probes atomic.Int32
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		probes.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		probes.Add(1)
+	}))
+	defer up.Close()
+
+	// a single round of health checks at start
+	routes := `{
+		"upstreams": {
+			"files": {
+				"urls": ["` + down.URL + `", "` + up.URL + `"],
+				"health_check": {"interval": "1h", "unhealthy_threshold": 1}
+			},
+			"users": {
+				"url": "` + down.URL + `",
+				"health_check": {"interval": "1h", "unhealthy_threshold": 1}
+			}
+		},
+		"routes": [
+			{"prefix": "/files/", "methods": ["GET"], "upstream": "files"},
+			{"prefix": "/users/", "methods": ["GET"], "upstream": "users"}
+		]
+	}`
+
+	p, err := NewReverseProxy(loadTable(t, routes), 1<<20, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Stop()
+
+	waitFor(t, "the failing instances to be ejected", func() bool {
+		return !instanceHealth(p, "files")[down.URL] && !instanceHealth(p, "users")[down.URL]
+	})
+	before := probes.Load()
+
+	ready, services := p.Ready()
+	if ready {
+		t.Error("Ready() = true, want false with users down")
+	}
+	if got, want := services["files"], (ServiceHealth{Status: "OK", InstancesUp: 1, InstancesTotal: 2}); got != want {
+		t.Errorf("files = %+v, want %+v", got, want)
+	}
+	if got, want := services["users"], (ServiceHealth{Status: "unavailable", InstancesTotal: 1}); got != want {
+		t.Errorf("users = %+v, want %+v", got, want)
+	}
+
+	if after := probes.Load(); after != before {
+		t.Errorf("Ready() sent %d probes, want none", after-before)
+	}
+}
@@ -0,0 +1,285 @@
+package router
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	AuthPublic   = "public"
+	AuthRequired = "required"
+)
+
+// Duration is a time.Duration written as a string ("10s") in the config.
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(parsed)
+	return nil
+}
+
+const (
+	BalancerRoundRobin       = "round_robin"
+	BalancerLeastConnections = "least_connections"
+)
+
+type HealthCheck struct {
+	Path     string   `json:"path"`
+	Interval Duration `json:"interval"`
+	Timeout  Duration `json:"timeout"`
+	// consecutive failed probes before an instance is ejected
+	UnhealthyThreshold int `json:"unhealthy_threshold"`
+	// consecutive successful probes before an ejected instance is readmitted
+	HealthyThreshold int `json:"healthy_threshold"`
+}
+
+type CircuitBreaker struct {
+	FailureThreshold int      `json:"failure_threshold"`
+	OpenTimeout      Duration `json:"open_timeout"`
+	HalfOpenRequests int      `json:"half_open_requests"`
+}
+
+// Retry applies only to idempotent requests without a body (GET and HEAD).
+type Retry struct {
+	Attempts   int      `json:"attempts"`
+	Backoff    Duration `json:"backoff"`
+	MaxBackoff Duration `json:"max_backoff"`
+}
+
+type Upstream struct {
+	// URL is a shorthand for a single instance, URLs lists all instances
+	URL            string         `json:"url"`
+	URLs           []string       `json:"urls"`
+	Balancer       string         `json:"balancer"`
+	HealthCheck    HealthCheck    `json:"health_check"`
+	CircuitBreaker CircuitBreaker `json:"circuit_breaker"`
+	Retry          Retry          `json:"retry"`
+}
+
+// RateLimit is a token bucket per client: Requests tokens are refilled every
+// Per, and up to Burst of them can be spent at once.
+type RateLimit struct {
+	Requests int      `json:"requests"`
+	Per      Duration `json:"per"`
+	Burst    int      `json:"burst"`
+}
+
+// Cache stores successful GET responses of a route for TTL, unless the
+// upstream says otherwise with Cache-Control.
+type Cache struct {
+	TTL Duration `json:"ttl"`
+}
+
+type Route struct {
+	Prefix   string   `json:"prefix"`
+	Methods  []string `json:"methods"`
+	Upstream string   `json:"upstream"`
+	// Timeout bounds the upstream call, zero disables it
+	Timeout Duration `json:"timeout"`
+	// Auth is either "public" or "required", Roles further restricts
+	// required routes to the listed roles
+	Auth  string   `json:"auth"`
+	Roles []string `json:"roles"`
+	// RateLimit is applied per user, or per client IP for anonymous
+	// requests, nil means unlimited
+	RateLimit *RateLimit `json:"rate_limit"`
+	// Cache is nil for routes that are never cached
+	Cache *Cache `json:"cache"`
+}
+
+type Table struct {
+	Upstreams map[string]Upstream `json:"upstreams"`
+	Routes    []Route             `json:"routes"`
+}
+
+// Load reads the route table from a JSON file. ${VAR} references in the file
+// are replaced with environment variables, so upstream addresses can still be
+// set per deployment.
+func Load(path string) (*Table, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read routes file: %w", err)
+	}
+
+	var table Table
+	if err := json.Unmarshal([]byte(os.ExpandEnv(string(data))), &table); err != nil {
+		return nil, fmt.Errorf("Failed to parse routes file: %w", err)
+	}
+
+	if err := table.validate(); err != nil {
+		return nil, err
+	}
+
+	// longest prefix wins
+	sort.SliceStable(table.Routes, func(i, j int) bool {
+		return len(table.Routes[i].Prefix) > len(table.Routes[j].Prefix)
+	})
+
+	return &table, nil
+}
+
+func (t *Table) validate() error {
+	if len(t.Routes) == 0 {
+		return errors.New("Routes file does not define any routes")
+	}
+
+	for name, upstream := range t.Upstreams {
+		if upstream.URL != "" {
+			upstream.URLs = append([]string{upstream.URL}, upstream.URLs...)
+			upstream.URL = ""
+		}
+
+		if len(upstream.URLs) == 0 {
+			return fmt.Errorf("Upstream %q has no urls", name)
+		}
+
+		for _, rawURL := range upstream.URLs {
+			u, err := url.Parse(rawURL)
+			if err != nil || u.Scheme == "" || u.Host == "" {
+				return fmt.Errorf("Upstream %q has invalid url %q", name, rawURL)
+			}
+		}
+
+		switch upstream.Balancer {
+		case "":
+			upstream.Balancer = BalancerRoundRobin
+		case BalancerRoundRobin, BalancerLeastConnections:
+		default:
+			return fmt.Errorf("Upstream %q has unknown balancer %q", name, upstream.Balancer)
+		}
+
+		check := &upstream.HealthCheck
+		if check.Path == "" {
+			check.Path = "/health"
+		}
+		if check.Interval <= 0 {
+			check.Interval = Duration(5 * time.Second)
+		}
+		if check.Timeout <= 0 {
+			check.Timeout = Duration(2 * time.Second)
+		}
+		if check.UnhealthyThreshold <= 0 {
+			check.UnhealthyThreshold = 2
+		}
+		if check.HealthyThreshold <= 0 {
+			check.HealthyThreshold = 1
+		}
+
+		cb := &upstream.CircuitBreaker
+		if cb.FailureThreshold <= 0 {
+			cb.FailureThreshold = 5
+		}
+		if cb.OpenTimeout <= 0 {
+			cb.OpenTimeout = Duration(30 * time.Second)
+		}
+		if cb.HalfOpenRequests <= 0 {
+			cb.HalfOpenRequests = 1
+		}
+
+		retry := &upstream.Retry
+		if retry.Attempts < 0 {
+			return fmt.Errorf("Upstream %q: retry attempts must not be negative", name)
+		}
+		if retry.Backoff <= 0 {
+			retry.Backoff = Duration(100 * time.Millisecond)
+		}
+		if retry.MaxBackoff < retry.Backoff {
+			retry.MaxBackoff = max(retry.Backoff, Duration(2*time.Second))
+		}
+
+		t.Upstreams[name] = upstream
+	}
+
+	for i := range t.Routes {
+		route := &t.Routes[i]
+
+		if !strings.HasPrefix(route.Prefix, "/") {
+			return fmt.Errorf("Route %q: prefix must start with '/'", route.Prefix)
+		}
+
+		if _, ok := t.Upstreams[route.Upstream]; !ok {
+			return fmt.Errorf("Route %q: unknown upstream %q", route.Prefix, route.Upstream)
+		}
+
+		if len(route.Methods) == 0 {
+			return fmt.Errorf("Route %q: no methods allowed", route.Prefix)
+		}
+		for j, method := range route.Methods {
+			route.Methods[j] = strings.ToUpper(method)
+		}
+
+		switch route.Auth {
+		case "":
+			route.Auth = AuthPublic
+		case AuthPublic, AuthRequired:
+		default:
+			return fmt.Errorf("Route %q: unknown auth mode %q", route.Prefix, route.Auth)
+		}
+
+		if len(route.Roles) > 0 && route.Auth != AuthRequired {
+			return fmt.Errorf("Route %q: roles require auth to be %q", route.Prefix, AuthRequired)
+		}
+
+		if route.Timeout < 0 {
+			return fmt.Errorf("Route %q: timeout must not be negative", route.Prefix)
+		}
+
+		if route.Cache != nil {
+			if route.Cache.TTL <= 0 {
+				return fmt.Errorf("Route %q: cache ttl must be positive", route.Prefix)
+			}
+			if !route.AllowsMethod(http.MethodGet) {
+				return fmt.Errorf("Route %q: only GET routes can be cached", route.Prefix)
+			}
+		}
+
+		if limit := route.RateLimit; limit != nil {
+			if limit.Requests <= 0 {
+				return fmt.Errorf("Route %q: rate limit requests must be positive", route.Prefix)
+			}
+			if limit.Per <= 0 {
+				limit.Per = Duration(time.Minute)
+			}
+			if limit.Burst <= 0 {
+				limit.Burst = limit.Requests
+			}
+		}
+	}
+
+	return nil
+}
+
+// Match returns the route with the longest prefix of path, or nil.
+func (t *Table) Match(path string) *Route {
+	for i := range t.Routes {
+		if strings.HasPrefix(path, t.Routes[i].Prefix) {
+			return &t.Routes[i]
+		}
+	}
+	return nil
+}
+
+func (r *Route) AllowsMethod(method string) bool {
+	if method == http.MethodHead {
+		method = http.MethodGet
+	}
+	return slices.Contains(r.Methods, method)
+}
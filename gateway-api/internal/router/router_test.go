@@ -0,0 +1,127 @@
+package router
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeRoutes(t *testing.T, routes string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "routes.json")
+	if err := os.WriteFile(path, []byte(routes), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadDefaults(t *testing.T) {
+	t.Setenv("FILES_URL", "http://files:8082")
+
+	table, err := Load(writeRoutes(t, `{
+		"upstreams": {"files": {"url": "${FILES_URL}"}},
+		"routes": [
+			{"prefix": "/files", "methods": ["get", "post"], "upstream": "files",
+			 "rate_limit": {"requests": 10}}
+		]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	upstream := table.Upstreams["files"]
+	if len(upstream.URLs) != 1 || upstream.URLs[0] != "http://files:8082" {
+		t.Errorf("URLs = %v, want the expanded url", upstream.URLs)
+	}
+	if upstream.Balancer != BalancerRoundRobin {
+		t.Errorf("Balancer = %q, want %q", upstream.Balancer, BalancerRoundRobin)
+	}
+	if check := upstream.HealthCheck; check.Path != "/health" || time.Duration(check.Interval) != 5*time.Second ||
+		check.UnhealthyThreshold != 2 || check.HealthyThreshold != 1 {
+		t.Errorf("HealthCheck = %+v, want the defaults", check)
+	}
+	if cb := upstream.CircuitBreaker; cb.FailureThreshold != 5 || cb.HalfOpenRequests != 1 {
+		t.Errorf("CircuitBreaker = %+v, want the defaults", cb)
+	}
+	if retry := upstream.Retry; time.Duration(retry.Backoff) != 100*time.Millisecond ||
+		time.Duration(retry.MaxBackoff) != 2*time.Second {
+		t.Errorf("Retry = %+v, want the defaults", retry)
+	}
+
+	route := table.Routes[0]
+	if route.Auth != AuthPublic {
+		t.Errorf("Auth = %q, want %q", route.Auth, AuthPublic)
+	}
+	if !route.AllowsMethod(http.MethodPost) || !route.AllowsMethod(http.MethodHead) || route.AllowsMethod(http.MethodDelete) {
+		t.Errorf("Methods = %v, want GET, HEAD and POST only", route.Methods)
+	}
+	if limit := route.RateLimit; time.Duration(limit.Per) != time.Minute || limit.Burst != 10 {
+		t.Errorf("RateLimit = %+v, want a burst of 10 per minute", limit)
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	const upstreams = `"upstreams": {"files": {"url": "http://files:8082"}}`
+
+	tests := []struct {
+		name   string
+		routes string
+		want   string
+	}{
+		{"no routes", `{` + upstreams + `, "routes": []}`, "does not define any routes"},
+		{"no urls", `{"upstreams": {"files": {}}, "routes": [{"prefix": "/", "methods": ["GET"], "upstream": "files"}]}`, "has no urls"},
+		{"relative url", `{"upstreams": {"files": {"url": "files:8082"}}, "routes": [{"prefix": "/", "methods": ["GET"], "upstream": "files"}]}`, "invalid url"},
+		{"unknown balancer", `{"upstreams": {"files": {"url": "http://files", "balancer": "random"}}, "routes": [{"prefix": "/", "methods": ["GET"], "upstream": "files"}]}`, "unknown balancer"},
+		{"prefix", `{` + upstreams + `, "routes": [{"prefix": "files", "methods": ["GET"], "upstream": "files"}]}`, "must start with '/'"},
+		{"unknown upstream", `{` + upstreams + `, "routes": [{"prefix": "/", "methods": ["GET"], "upstream": "users"}]}`, "unknown upstream"},
+		{"no methods", `{` + upstreams + `, "routes": [{"prefix": "/", "upstream": "files"}]}`, "no methods"},
+		{"unknown auth", `{` + upstreams + `, "routes": [{"prefix": "/", "methods": ["GET"], "upstream": "files", "auth": "maybe"}]}`, "unknown auth mode"},
+		{"roles without auth", `{` + upstreams + `, "routes": [{"prefix": "/", "methods": ["GET"], "upstream": "files", "roles": ["teacher"]}]}`, "roles require auth"},
+		{"cached POST", `{` + upstreams + `, "routes": [{"prefix": "/", "methods": ["POST"], "upstream": "files", "cache": {"ttl": "1m"}}]}`, "only GET routes"},
+		{"cache ttl", `{` + upstreams + `, "routes": [{"prefix": "/", "methods": ["GET"], "upstream": "files", "cache": {}}]}`, "cache ttl"},
+		{"rate limit", `{` + upstreams + `, "routes": [{"prefix": "/", "methods": ["GET"], "upstream": "files", "rate_limit": {}}]}`, "rate limit requests"},
+		{"duration", `{` + upstreams + `, "routes": [{"prefix": "/", "methods": ["GET"], "upstream": "files", "timeout": "soon"}]}`, "Failed to parse"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load(writeRoutes(t, tt.routes))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want it to mention %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchLongestPrefix(t *testing.T) {
+	table, err := Load(writeRoutes(t, `{
+		"upstreams": {"files": {"url": "http://files:8082"}},
+		"routes": [
+			{"prefix": "/", "methods": ["GET"], "upstream": "files"},
+			{"prefix": "/files/admin", "methods": ["GET"], "upstream": "files"},
+			{"prefix": "/files", "methods": ["GET"], "upstream": "files"}
+		]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/files/admin/stats", "/files/admin"},
+		{"/files/1", "/files"},
+		{"/users", "/"},
+	}
+
+	for _, tt := range tests {
+		if route := table.Match(tt.path); route == nil || route.Prefix != tt.want {
+			t.Errorf("Match(%q) = %+v, want prefix %q", tt.path, route, tt.want)
+		}
+	}
+}
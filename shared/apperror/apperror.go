@@ -0,0 +1,178 @@
+// Package apperror defines the typed errors handlers return to clients and
+// the JSON envelope they are written in:
+//
+//	{"error": {"code": "not_found", "message": "file not found", "details": ..., "request_id": "..."}}
+//
+// Services return these errors from any layer, wrapping them with %w where
+// context helps, and handlers write whatever they get with Write.
+package apperror
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/KEPTANy/plag-check/shared/middleware"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Code is the machine readable kind of an error, stable across messages.
+type Code string
+
+const (
+	CodeValidation       Code = "validation_failed"
+	CodeUnauthorized     Code = "unauthorized"
+	CodeForbidden        Code = "forbidden"
+	CodeNotFound         Code = "not_found"
+	CodeMethodNotAllowed Code = "method_not_allowed"
+	CodeConflict         Code = "conflict"
+	CodeTooLarge         Code = "payload_too_large"
+	CodeLocked           Code = "locked"
+	CodeRateLimited      Code = "rate_limited"
+	CodeInternal         Code = "internal"
+	CodeBadGateway       Code = "bad_gateway"
+	CodeUnavailable      Code = "service_unavailable"
+	CodeTimeout          Code = "gateway_timeout"
+)
+
+var statuses = map[Code]int{
+	CodeValidation:       http.StatusBadRequest,
+	CodeUnauthorized:     http.StatusUnauthorized,
+	CodeForbidden:        http.StatusForbidden,
+	CodeNotFound:         http.StatusNotFound,
+	CodeMethodNotAllowed: http.StatusMethodNotAllowed,
+	CodeConflict:         http.StatusConflict,
+	CodeTooLarge:         http.StatusRequestEntityTooLarge,
+	CodeLocked:           http.StatusLocked,
+	CodeRateLimited:      http.StatusTooManyRequests,
+	CodeInternal:         http.StatusInternalServerError,
+	CodeBadGateway:       http.StatusBadGateway,
+	CodeUnavailable:      http.StatusServiceUnavailable,
+	CodeTimeout:          http.StatusGatewayTimeout,
+}
+
+// Error is an error meant to be shown to the client. Message and Details are
+// public, Err is the cause and is only logged.
+type Error struct {
+	Code    Code
+	Message string
+	Details any
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Status returns the HTTP status code of the error.
+func (e *Error) Status() int {
+	if status, ok := statuses[e.Code]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// WithDetails returns a copy of e with details, e.g. the failed fields.
+func (e *Error) WithDetails(details any) *Error {
+	c := *e
+	c.Details = details
+	return &c
+}
+
+// Wrap returns a copy of e caused by err.
+func (e *Error) Wrap(err error) *Error {
+	c := *e
+	c.Err = err
+	return &c
+}
+
+func New(code Code, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+func Validation(message string) *Error {
+	return New(CodeValidation, message)
+}
+
+func Unauthorized(message string) *Error {
+	return New(CodeUnauthorized, message)
+}
+
+func Forbidden(message string) *Error {
+	return New(CodeForbidden, message)
+}
+
+func NotFound(message string) *Error {
+	return New(CodeNotFound, message)
+}
+
+func Conflict(message string) *Error {
+	return New(CodeConflict, message)
+}
+
+// Internal hides err from the client behind a generic message.
+func Internal(err error) *Error {
+	return &Error{Code: CodeInternal, Message: "internal server error", Err: err}
+}
+
+// From returns the Error in the chain of err. Repository errors without one
+// are mapped by cause: pgx.ErrNoRows means the resource does not exist, a
+// unique violation a conflict, anything else is internal.
+func From(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		return &Error{Code: CodeNotFound, Message: "resource not found", Err: err}
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+		return &Error{Code: CodeConflict, Message: "resource already exists", Err: err}
+	}
+	return Internal(err)
+}
+
+// uniqueViolation is the SQLSTATE of a duplicate key
+const uniqueViolation = "23505"
+
+type envelope struct {
+	Error body `json:"error"`
+}
+
+type body struct {
+	Code      Code   `json:"code"`
+	Message   string `json:"message"`
+	Details   any    `json:"details,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// Write writes err in the JSON envelope with the status of its code. Errors
+// that are not an Error, or wrap one, are written as internal errors. Server
+// errors with a cause are logged with it, since the client does not see it.
+func Write(w http.ResponseWriter, r *http.Request, err error) {
+	e := From(err)
+
+	if e.Status() >= http.StatusInternalServerError && e.Err != nil {
+		slog.ErrorContext(r.Context(), "Request failed", "error", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(e.Status())
+	json.NewEncoder(w).Encode(envelope{Error: body{
+		Code:      e.Code,
+		Message:   e.Message,
+		Details:   e.Details,
+		RequestID: middleware.GetRequestID(r.Context()),
+	}})
+}
@@ -0,0 +1,73 @@
+package apperror
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestFrom(t *testing.T) {
+	notFound := NotFound("file not found")
+
+	tests := []struct {
+		name       string
+		err        error
+		wantCode   Code
+		wantStatus int
+	}{
+		{"typed", notFound, CodeNotFound, http.StatusNotFound},
+		{"wrapped typed", fmt.Errorf("Failed to load file: %w", notFound), CodeNotFound, http.StatusNotFound},
+		{"no rows", fmt.Errorf("Failed to find a user: %w", pgx.ErrNoRows), CodeNotFound, http.StatusNotFound},
+		{"unique violation", fmt.Errorf("Failed to create a user: %w", &pgconn.PgError{Code: "23505"}), CodeConflict, http.StatusConflict},
+		{"other database error", &pgconn.PgError{Code: "23503"}, CodeInternal, http.StatusInternalServerError},
+		{"plain", errors.New("boom"), CodeInternal, http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := From(tt.err)
+			if e.Code != tt.wantCode || e.Status() != tt.wantStatus {
+				t.Errorf("From() = %s %d, want %s %d", e.Code, e.Status(), tt.wantCode, tt.wantStatus)
+			}
+			if tt.wantCode == CodeInternal && e.Message != "internal server error" {
+				t.Errorf("message = %q, the cause must not reach the client", e.Message)
+			}
+			if e != notFound && e.Err != tt.err {
+				t.Errorf("cause = %v, want %v", e.Err, tt.err)
+			}
+		})
+	}
+}
+
+func TestWrite(t *testing.T) {
+	rec := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	Write(rec, r, Validation("invalid file ID").WithDetails(map[string]string{"id": "not a number"}))
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", rec.Code)
+	}
+	if got := rec.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q", got)
+	}
+
+	var got struct {
+		Error struct {
+			Code    Code              `json:"code"`
+			Message string            `json:"message"`
+			Details map[string]string `json:"details"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("body %q: %v", rec.Body, err)
+	}
+	if got.Error.Code != CodeValidation || got.Error.Message != "invalid file ID" || got.Error.Details["id"] != "not a number" {
+		t.Errorf("envelope = %+v", got.Error)
+	}
+}
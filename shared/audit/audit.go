@@ -0,0 +1,86 @@
+// Package audit keeps an append-only record of sensitive actions: who did
+// what to which resource, when, from which address and in which request. The
+// audit_log table is shared by all services and is created by the migrations
+// in audit/migrations.
+package audit
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/KEPTANy/plag-check/shared/middleware"
+	"github.com/gofrs/uuid/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	ActionLogin           = "user.login"
+	ActionRoleChange      = "user.role_change"
+	ActionFileDownload    = "file.download"
+	ActionPlagiarismCheck = "analysis.plagiarism"
+	ActionWordCloud       = "analysis.wordcloud"
+	ActionWebhookCreate   = "analysis.webhook_create"
+	ActionWebhookDelete   = "analysis.webhook_delete"
+)
+
+const (
+	OutcomeSuccess = "success"
+	// OutcomeFailure is an attempt that failed, e.g. a wrong password
+	OutcomeFailure = "failure"
+	// OutcomeDenied is an attempt refused by policy, e.g. a locked account
+	// or a file of another student
+	OutcomeDenied = "denied"
+)
+
+type Event struct {
+	// ActorID is uuid.Nil when the actor is unknown, e.g. a login attempt
+	// with a wrong username
+	ActorID      uuid.UUID
+	ActorRole    string
+	Action       string
+	ResourceType string
+	ResourceID   string
+	Outcome      string
+	Details      map[string]any
+}
+
+// Log writes and reads the audit log on behalf of one service.
+type Log struct {
+	pool    *pgxpool.Pool
+	service string
+}
+
+func New(pool *pgxpool.Pool, service string) *Log {
+	return &Log{pool: pool, service: service}
+}
+
+// Record appends an event. The client address and request ID are taken from
+// ctx, see middleware.ClientIP and middleware.RequestIDMiddleware.
+// A failure is logged here as well, so callers that go on anyway may ignore
+// it.
+func (l *Log) Record(ctx context.Context, event Event) error {
+	var actorID *uuid.UUID
+	if event.ActorID != uuid.Nil {
+		actorID = &event.ActorID
+	}
+
+	query := `
+		INSERT INTO audit_log (
+			service, actor_id, actor_role, action, resource_type, resource_id,
+			outcome, ip, request_id, details
+		) VALUES ($1, $2, NULLIF($3, ''), $4, $5, NULLIF($6, ''), $7, NULLIF($8, ''), NULLIF($9, ''), $10)
+	`
+
+	_, err := l.pool.Exec(ctx, query,
+		l.service, actorID, event.ActorRole, event.Action, event.ResourceType, event.ResourceID,
+		event.Outcome, middleware.GetClientIP(ctx), middleware.GetRequestID(ctx), event.Details,
+	)
+	if err != nil {
+		err = fmt.Errorf("Failed to write audit log: %w", err)
+		slog.ErrorContext(ctx, "Failed to record audit event", "action", event.Action, "error", err)
+		return err
+	}
+
+	return nil
+}
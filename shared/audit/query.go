@@ -0,0 +1,155 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+)
+
+type Entry struct {
+	ID           int64          `json:"id"`
+	OccurredAt   time.Time      `json:"occurred_at"`
+	Service      string         `json:"service"`
+	ActorID      *uuid.UUID     `json:"actor_id,omitempty"`
+	ActorRole    string         `json:"actor_role,omitempty"`
+	Action       string         `json:"action"`
+	ResourceType string         `json:"resource_type"`
+	ResourceID   string         `json:"resource_id,omitempty"`
+	Outcome      string         `json:"outcome"`
+	IP           string         `json:"ip,omitempty"`
+	RequestID    string         `json:"request_id,omitempty"`
+	Details      map[string]any `json:"details,omitempty"`
+}
+
+// Filter selects entries, zero fields match everything. Entries come newest
+// first; BeforeID continues a listing after its last entry.
+type Filter struct {
+	ActorID      uuid.UUID
+	Action       string
+	ResourceType string
+	ResourceID   string
+	Service      string
+	Outcome      string
+	IP           string
+	RequestID    string
+	From         time.Time
+	To           time.Time
+	BeforeID     int64
+	// Limit of 0 means no limit
+	Limit int
+}
+
+func (f *Filter) where() (string, []any) {
+	var (
+		conds []string
+		args  []any
+	)
+	add := func(cond string, arg any) {
+		args = append(args, arg)
+		conds = append(conds, strings.ReplaceAll(cond, "?", "$"+strconv.Itoa(len(args))))
+	}
+
+	if f.ActorID != uuid.Nil {
+		add("actor_id = ?", f.ActorID)
+	}
+	if f.Action != "" {
+		add("action = ?", f.Action)
+	}
+	if f.ResourceType != "" {
+		add("resource_type = ?", f.ResourceType)
+	}
+	if f.ResourceID != "" {
+		add("resource_id = ?", f.ResourceID)
+	}
+	if f.Service != "" {
+		add("service = ?", f.Service)
+	}
+	if f.Outcome != "" {
+		add("outcome = ?", f.Outcome)
+	}
+	if f.IP != "" {
+		add("ip = ?", f.IP)
+	}
+	if f.RequestID != "" {
+		add("request_id = ?", f.RequestID)
+	}
+	if !f.From.IsZero() {
+		add("occurred_at >= ?", f.From)
+	}
+	if !f.To.IsZero() {
+		add("occurred_at < ?", f.To)
+	}
+	if f.BeforeID > 0 {
+		add("id < ?", f.BeforeID)
+	}
+
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return "WHERE " + strings.Join(conds, " AND "), args
+}
+
+// Find returns the entries matching f.
+func (l *Log) Find(ctx context.Context, f Filter) ([]Entry, error) {
+	entries := []Entry{}
+	err := l.Each(ctx, f, func(entry *Entry) error {
+		entries = append(entries, *entry)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// Each streams the entries matching f to fn without holding them in memory,
+// for exports. An error from fn stops the iteration and is returned.
+func (l *Log) Each(ctx context.Context, f Filter, fn func(entry *Entry) error) error {
+	where, args := f.where()
+
+	query := `
+		SELECT
+			id, occurred_at, service, actor_id, COALESCE(actor_role, ''), action,
+			resource_type, COALESCE(resource_id, ''), outcome, COALESCE(ip, ''),
+			COALESCE(request_id, ''), details
+		FROM audit_log
+	` + where + `
+		ORDER BY id DESC
+	`
+	if f.Limit > 0 {
+		query += "LIMIT " + strconv.Itoa(f.Limit)
+	}
+
+	rows, err := l.pool.Query(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("Failed to query audit log: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var entry Entry
+		err := rows.Scan(
+			&entry.ID, &entry.OccurredAt, &entry.Service, &entry.ActorID, &entry.ActorRole, &entry.Action,
+			&entry.ResourceType, &entry.ResourceID, &entry.Outcome, &entry.IP,
+			&entry.RequestID, &entry.Details,
+		)
+		if err != nil {
+			return fmt.Errorf("Failed to read audit log: %w", err)
+		}
+
+		if err := fn(&entry); err != nil {
+			return err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("Failed to read audit log: %w", err)
+	}
+
+	return nil
+}
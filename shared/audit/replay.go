@@ -0,0 +1,57 @@
+package audit
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// ReplayHeader marks a cacheable response whose every view is audited. It
+// carries the event of the view, so a cache answering in place of the
+// service can record the views the service never sees. The actor is left
+// out, it is whoever the cache answers.
+const ReplayHeader = "X-Audit-Replay"
+
+type replay struct {
+	Action       string         `json:"action"`
+	ResourceType string         `json:"resource_type"`
+	ResourceID   string         `json:"resource_id,omitempty"`
+	Details      map[string]any `json:"details,omitempty"`
+}
+
+// SetReplay describes event in the ReplayHeader of a response.
+func SetReplay(header http.Header, event Event) {
+	value, err := json.Marshal(replay{
+		Action:       event.Action,
+		ResourceType: event.ResourceType,
+		ResourceID:   event.ResourceID,
+		Details:      event.Details,
+	})
+	if err != nil {
+		// a view that cannot be replayed must not be cached either
+		header.Set("Cache-Control", "no-store")
+		return
+	}
+	header.Set(ReplayHeader, string(value))
+}
+
+// Replay reads the event SetReplay put into header. The outcome is always
+// success, only successful responses are cached.
+func Replay(header http.Header) (Event, bool) {
+	value := header.Get(ReplayHeader)
+	if value == "" {
+		return Event{}, false
+	}
+
+	var r replay
+	if err := json.Unmarshal([]byte(value), &r); err != nil || r.Action == "" {
+		return Event{}, false
+	}
+
+	return Event{
+		Action:       r.Action,
+		ResourceType: r.ResourceType,
+		ResourceID:   r.ResourceID,
+		Outcome:      OutcomeSuccess,
+		Details:      r.Details,
+	}, true
+}
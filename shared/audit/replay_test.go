@@ -0,0 +1,38 @@
+package audit
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestReplay(t *testing.T) {
+	header := make(http.Header)
+	SetReplay(header, Event{
+		ActorRole:    "teacher",
+		Action:       ActionWordCloud,
+		ResourceType: "file",
+		ResourceID:   "7",
+		Outcome:      OutcomeSuccess,
+		Details:      map[string]any{"groups": 2},
+	})
+
+	event, ok := Replay(header)
+	if !ok {
+		t.Fatalf("Replay(%q) failed", header.Get(ReplayHeader))
+	}
+	if event.Action != ActionWordCloud || event.ResourceType != "file" || event.ResourceID != "7" {
+		t.Errorf("event = %+v, want the word cloud of file 7", event)
+	}
+	if event.ActorRole != "" {
+		t.Errorf("actor role = %q, the actor is not replayed", event.ActorRole)
+	}
+	if event.Outcome != OutcomeSuccess || event.Details["groups"] != 2.0 {
+		t.Errorf("outcome = %q, details = %v", event.Outcome, event.Details)
+	}
+
+	for _, value := range []string{"", "{", `{"resource_type":"file"}`} {
+		if _, ok := Replay(http.Header{ReplayHeader: {value}}); ok {
+			t.Errorf("Replay(%q) succeeded", value)
+		}
+	}
+}
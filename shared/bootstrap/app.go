@@ -0,0 +1,217 @@
+package bootstrap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// Lifecycle controls how a service stops.
+type Lifecycle struct {
+	// ShutdownTimeout bounds draining in-flight requests, stopping workers
+	// and running shutdown hooks altogether
+	ShutdownTimeout time.Duration
+	// DrainDelay is how long a stopping service keeps serving while
+	// reporting not ready, so load balancers stop sending it requests
+	DrainDelay time.Duration
+}
+
+// LoadLifecycle reads SHUTDOWN_TIMEOUT and SHUTDOWN_DRAIN_DELAY.
+func LoadLifecycle(env *Env) Lifecycle {
+	lc := Lifecycle{
+		ShutdownTimeout: env.Duration("SHUTDOWN_TIMEOUT", 15*time.Second),
+		DrainDelay:      env.Duration("SHUTDOWN_DRAIN_DELAY", 0),
+	}
+
+	env.Positive("SHUTDOWN_TIMEOUT", int64(lc.ShutdownTimeout))
+	if lc.DrainDelay < 0 {
+		env.Fail("SHUTDOWN_DRAIN_DELAY", "must not be negative")
+	}
+
+	return lc
+}
+
+// App runs the HTTP servers and background workers of a service. It is
+// ready once every server listens and stops being ready as soon as shutdown
+// starts. On SIGINT or SIGTERM, or when a server or worker fails, it:
+//
+//  1. reports not ready and waits for DrainDelay
+//  2. shuts the servers down, letting in-flight requests finish
+//  3. cancels the worker context and waits for the workers to return
+//  4. runs the shutdown hooks in reverse order of registration
+type App struct {
+	lifecycle Lifecycle
+
+	servers []*http.Server
+	hooks   []func(context.Context) error
+
+	ctx     context.Context
+	cancel  context.CancelFunc
+	workers sync.WaitGroup
+	failed  chan error
+
+	ready atomic.Bool
+}
+
+func New(lifecycle Lifecycle) *App {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &App{
+		lifecycle: lifecycle,
+		ctx:       ctx,
+		cancel:    cancel,
+		failed:    make(chan error, 1),
+	}
+}
+
+// Serve registers a server to start in Run.
+func (a *App) Serve(server *http.Server) {
+	a.servers = append(a.servers, server)
+}
+
+// Go starts a background worker right away. Its context is cancelled on
+// shutdown, after the servers have drained, and the worker has to return
+// then. A worker returning an error other than context.Canceled stops the
+// whole service.
+func (a *App) Go(name string, worker func(ctx context.Context) error) {
+	a.workers.Add(1)
+	go func() {
+		defer a.workers.Done()
+
+		err := worker(a.ctx)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			a.fail(fmt.Errorf("Worker %s failed: %w", name, err))
+		}
+	}()
+}
+
+// OnShutdown registers a hook to run after servers and workers have
+// stopped, e.g. closing the database pool. Hooks run in reverse order, so
+// what is set up first is torn down last.
+func (a *App) OnShutdown(hook func(ctx context.Context) error) {
+	a.hooks = append(a.hooks, hook)
+}
+
+// Ready reports whether the service accepts traffic.
+func (a *App) Ready() bool {
+	return a.ready.Load()
+}
+
+// CheckReady is Ready in the form of a health check.
+func (a *App) CheckReady(ctx context.Context) error {
+	if !a.Ready() {
+		return errors.New("Service is starting or shutting down")
+	}
+	return nil
+}
+
+func (a *App) fail(err error) {
+	select {
+	case a.failed <- err:
+	default:
+	}
+}
+
+// Run serves until the service is asked to stop and then shuts it down
+// gracefully. It returns the error that stopped the service, if any.
+func (a *App) Run() error {
+	var runErr error
+
+	listeners := make([]net.Listener, 0, len(a.servers))
+	for _, server := range a.servers {
+		ln, err := net.Listen("tcp", server.Addr)
+		if err != nil {
+			runErr = fmt.Errorf("Failed to listen on %s: %w", server.Addr, err)
+			break
+		}
+		listeners = append(listeners, ln)
+	}
+
+	if runErr == nil {
+		for i, server := range a.servers {
+			go func() {
+				if err := server.Serve(listeners[i]); !errors.Is(err, http.ErrServerClosed) {
+					a.fail(fmt.Errorf("Server on %s failed: %w", server.Addr, err))
+				}
+			}()
+			slog.Info("Server started", "addr", server.Addr)
+		}
+
+		a.ready.Store(true)
+		runErr = a.wait()
+	} else {
+		for _, ln := range listeners {
+			ln.Close()
+		}
+	}
+
+	a.ready.Store(false)
+	a.shutdown()
+
+	return runErr
+}
+
+// wait blocks until a stop signal or a failure. A signal is not an error.
+func (a *App) wait() error {
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(quit)
+
+	select {
+	case sig := <-quit:
+		slog.Info("Shutting down", "signal", sig.String())
+		a.ready.Store(false)
+		if a.lifecycle.DrainDelay > 0 {
+			time.Sleep(a.lifecycle.DrainDelay)
+		}
+		return nil
+	case err := <-a.failed:
+		slog.Error("Shutting down", "error", err)
+		return err
+	}
+}
+
+func (a *App) shutdown() {
+	ctx, cancel := context.WithTimeout(context.Background(), a.lifecycle.ShutdownTimeout)
+	defer cancel()
+
+	var servers sync.WaitGroup
+	for _, server := range a.servers {
+		servers.Go(func() {
+			if err := server.Shutdown(ctx); err != nil {
+				slog.Error("Server forced to shutdown", "addr", server.Addr, "error", err)
+				server.Close()
+			}
+		})
+	}
+	servers.Wait()
+
+	a.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		a.workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		slog.Error("Workers did not stop in time")
+	}
+
+	for i := len(a.hooks) - 1; i >= 0; i-- {
+		if err := a.hooks[i](ctx); err != nil {
+			slog.Error("Shutdown hook failed", "error", err)
+		}
+	}
+
+	slog.Info("Server exited properly")
+}
@@ -0,0 +1,147 @@
+package bootstrap
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// freeAddr returns a local address nothing listens on.
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+type events struct {
+	mu   sync.Mutex
+	list []string
+}
+
+func (e *events) add(event string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.list = append(e.list, event)
+}
+
+func (e *events) get() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return slices.Clone(e.list)
+}
+
+func TestAppShutdownOrder(t *testing.T) {
+	var got events
+	app := New(Lifecycle{ShutdownTimeout: 5 * time.Second})
+
+	started := make(chan struct{})
+	addr := freeAddr(t)
+	app.Serve(&http.Server{Addr: addr, Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !app.Ready() {
+			t.Error("not ready while serving")
+		}
+		close(started)
+		// shutdown starts meanwhile and has to wait for the request
+		time.Sleep(100 * time.Millisecond)
+		got.add("request done")
+	})})
+
+	app.Go("worker", func(ctx context.Context) error {
+		<-ctx.Done()
+		if app.Ready() {
+			t.Error("ready while shutting down")
+		}
+		got.add("worker stopped")
+		return ctx.Err()
+	})
+	app.Go("failing", func(ctx context.Context) error {
+		select {
+		case <-started:
+			return errors.New("boom")
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+
+	app.OnShutdown(func(context.Context) error {
+		got.add("first hook")
+		return nil
+	})
+	app.OnShutdown(func(context.Context) error {
+		got.add("second hook")
+		return errors.New("hook errors are only logged")
+	})
+
+	go func() {
+		for !app.Ready() {
+			time.Sleep(time.Millisecond)
+		}
+		resp, err := http.Get("http://" + addr)
+		if err != nil {
+			t.Errorf("request failed: %v", err)
+			return
+		}
+		resp.Body.Close()
+	}()
+
+	err := app.Run()
+	if err == nil || err.Error() != "Worker failing failed: boom" {
+		t.Errorf("Run() error = %v, want the failure of the worker", err)
+	}
+	if app.Ready() {
+		t.Error("ready after Run returned")
+	}
+
+	want := []string{"request done", "worker stopped", "second hook", "first hook"}
+	if !slices.Equal(got.get(), want) {
+		t.Errorf("shutdown order = %q, want %q", got.get(), want)
+	}
+}
+
+func TestAppListenFailure(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	app := New(Lifecycle{ShutdownTimeout: time.Second})
+	app.Serve(&http.Server{Addr: ln.Addr().String()})
+
+	hookRan := false
+	app.OnShutdown(func(context.Context) error {
+		hookRan = true
+		return nil
+	})
+
+	if err := app.Run(); err == nil {
+		t.Error("Run() succeeded on a taken address")
+	}
+	if app.Ready() {
+		t.Error("ready although no server started")
+	}
+	if !hookRan {
+		t.Error("shutdown hooks did not run")
+	}
+}
+
+func TestCheckReady(t *testing.T) {
+	app := New(Lifecycle{ShutdownTimeout: time.Second})
+	if err := app.CheckReady(context.Background()); err == nil {
+		t.Error("CheckReady() = nil before Run")
+	}
+
+	app.ready.Store(true)
+	if err := app.CheckReady(context.Background()); err != nil {
+		t.Errorf("CheckReady() = %v while ready", err)
+	}
+}
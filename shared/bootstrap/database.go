@@ -0,0 +1,94 @@
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/KEPTANy/plag-check/shared/tracing"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Database describes the Postgres connection and its pool.
+type Database struct {
+	URL string
+
+	MaxConns          int32
+	MinConns          int32
+	MaxConnLifetime   time.Duration
+	MaxConnIdleTime   time.Duration
+	HealthCheckPeriod time.Duration
+	ConnectTimeout    time.Duration
+}
+
+// LoadDatabase reads the connection from DB_HOST, DB_PORT, DB_USER,
+// DB_PASSWORD and DB_NAME and the pool settings from DB_MAX_CONNS,
+// DB_MIN_CONNS, DB_MAX_CONN_LIFETIME, DB_MAX_CONN_IDLE_TIME,
+// DB_HEALTH_CHECK_PERIOD and DB_CONNECT_TIMEOUT.
+func LoadDatabase(env *Env) Database {
+	host := env.Required("DB_HOST")
+	port := env.String("DB_PORT", "5432")
+	user := env.Required("DB_USER")
+	password := env.Required("DB_PASSWORD")
+	name := env.Required("DB_NAME")
+
+	// escaped, a password may contain '@' or '/'
+	u := url.URL{
+		Scheme: "postgresql",
+		User:   url.UserPassword(user, password),
+		Host:   net.JoinHostPort(host, port),
+		Path:   "/" + name,
+	}
+
+	db := Database{
+		URL:               u.String(),
+		MaxConns:          int32(env.Int("DB_MAX_CONNS", 25)),
+		MinConns:          int32(env.Int("DB_MIN_CONNS", 5)),
+		MaxConnLifetime:   env.Duration("DB_MAX_CONN_LIFETIME", time.Hour),
+		MaxConnIdleTime:   env.Duration("DB_MAX_CONN_IDLE_TIME", 30*time.Minute),
+		HealthCheckPeriod: env.Duration("DB_HEALTH_CHECK_PERIOD", time.Minute),
+		ConnectTimeout:    env.Duration("DB_CONNECT_TIMEOUT", 10*time.Second),
+	}
+
+	env.Positive("DB_MAX_CONNS", int64(db.MaxConns))
+	if db.MinConns < 0 || db.MinConns > db.MaxConns {
+		env.Fail("DB_MIN_CONNS", "must be between 0 and DB_MAX_CONNS")
+	}
+	env.Positive("DB_CONNECT_TIMEOUT", int64(db.ConnectTimeout))
+
+	return db
+}
+
+// NewPool opens a traced pool and pings the database, so a service does not
+// start without it.
+func NewPool(ctx context.Context, db Database) (*pgxpool.Pool, error) {
+	config, err := pgxpool.ParseConfig(db.URL)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse connection string: %w", err)
+	}
+
+	config.MaxConns = db.MaxConns
+	config.MinConns = db.MinConns
+	config.MaxConnLifetime = db.MaxConnLifetime
+	config.MaxConnIdleTime = db.MaxConnIdleTime
+	config.HealthCheckPeriod = db.HealthCheckPeriod
+	config.ConnConfig.ConnectTimeout = db.ConnectTimeout
+	config.ConnConfig.Tracer = tracing.PgxTracer{}
+
+	ctx, cancel := context.WithTimeout(ctx, db.ConnectTimeout)
+	defer cancel()
+
+	pool, err := pgxpool.NewWithConfig(ctx, config)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create connection pool: %w", err)
+	}
+
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("Failed to ping database: %w", err)
+	}
+
+	return pool, nil
+}
@@ -0,0 +1,159 @@
+// Package bootstrap holds what every service does before and after serving:
+// loading settings from the environment, opening the database pool and
+// running servers and background workers until a graceful shutdown.
+package bootstrap
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Env reads typed settings from environment variables. Empty variables count
+// as unset. Problems are collected instead of returned one at a time, so a
+// misconfigured service reports every bad variable at once; check them with
+// Err after loading.
+type Env struct {
+	errs []error
+}
+
+func (e *Env) lookup(name string) (string, bool) {
+	value, ok := os.LookupEnv(name)
+	if !ok || value == "" {
+		return "", false
+	}
+	return value, true
+}
+
+// Fail records a variable that is set but not valid.
+func (e *Env) Fail(name, reason string) {
+	e.errs = append(e.errs, fmt.Errorf("Failed to load %s variable: %s", name, reason))
+}
+
+// Err returns every problem found so far, or nil.
+func (e *Env) Err() error {
+	return errors.Join(e.errs...)
+}
+
+func (e *Env) Required(name string) string {
+	value, ok := e.lookup(name)
+	if !ok {
+		e.Fail(name, "not set")
+	}
+	return value
+}
+
+func (e *Env) String(name, def string) string {
+	if value, ok := e.lookup(name); ok {
+		return value
+	}
+	return def
+}
+
+func (e *Env) Int(name string, def int) int {
+	value, ok := e.lookup(name)
+	if !ok {
+		return def
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		e.Fail(name, "not an integer")
+		return def
+	}
+	return n
+}
+
+func (e *Env) Int64(name string, def int64) int64 {
+	value, ok := e.lookup(name)
+	if !ok {
+		return def
+	}
+
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		e.Fail(name, "not an integer")
+		return def
+	}
+	return n
+}
+
+func (e *Env) Bool(name string, def bool) bool {
+	value, ok := e.lookup(name)
+	if !ok {
+		return def
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		e.Fail(name, "not a boolean")
+		return def
+	}
+	return b
+}
+
+// Duration parses values like "30s" or "1h30m".
+func (e *Env) Duration(name string, def time.Duration) time.Duration {
+	value, ok := e.lookup(name)
+	if !ok {
+		return def
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		e.Fail(name, "not a duration")
+		return def
+	}
+	return d
+}
+
+// List splits a comma separated value, dropping empty items.
+func (e *Env) List(name string, def []string) []string {
+	value, ok := e.lookup(name)
+	if !ok {
+		return def
+	}
+
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// Networks parses a comma separated list of CIDR networks and single
+// addresses.
+func (e *Env) Networks(name string, def []netip.Prefix) []netip.Prefix {
+	if _, ok := e.lookup(name); !ok {
+		return def
+	}
+
+	var networks []netip.Prefix
+	for _, item := range e.List(name, nil) {
+		if addr, err := netip.ParseAddr(item); err == nil {
+			networks = append(networks, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(item)
+		if err != nil {
+			e.Fail(name, "not a list of IP addresses and CIDR networks")
+			return def
+		}
+		networks = append(networks, prefix.Masked())
+	}
+	return networks
+}
+
+// Positive records a failure unless n is above zero.
+func (e *Env) Positive(name string, n int64) {
+	if n <= 0 {
+		e.Fail(name, "must be positive")
+	}
+}
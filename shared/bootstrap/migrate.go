@@ -0,0 +1,38 @@
+package bootstrap
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/KEPTANy/plag-check/shared/migrate"
+)
+
+// MigrateCommand runs `<service> migrate ...` against the database given by
+// the DB_* variables. It needs none of the other settings of the service, so
+// it can run from the service image before the service is configured.
+func MigrateCommand(service string, fsys fs.FS, args []string) error {
+	var env Env
+	db := LoadDatabase(&env)
+	if err := env.Err(); err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	pool, err := NewPool(ctx, db)
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+
+	migrator, err := migrate.New(pool, service, fsys)
+	if err != nil {
+		return err
+	}
+
+	return migrator.Command(ctx, args, os.Stdout)
+}
@@ -0,0 +1,45 @@
+// Package dbtx lets repositories and the event outbox share one transaction
+// without passing it around: the transaction travels in the context.
+package dbtx
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Querier is what a pool and a transaction have in common. Begin on a
+// transaction starts a savepoint.
+type Querier interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
+
+// Transactor is implemented by the repositories of the services, so the
+// service layer can group repository calls and published events.
+type Transactor interface {
+	InTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+type txKey struct{}
+
+// From returns the transaction of ctx, or pool outside of InTx.
+func From(ctx context.Context, pool *pgxpool.Pool) Querier {
+	if tx, ok := ctx.Value(txKey{}).(pgx.Tx); ok {
+		return tx
+	}
+	return pool
+}
+
+// InTx runs fn in a transaction that queries made through From with the
+// context passed to fn join. It commits when fn returns nil. Nested calls run
+// in a savepoint of the outer transaction.
+func InTx(ctx context.Context, pool *pgxpool.Pool, fn func(ctx context.Context) error) error {
+	return pgx.BeginFunc(ctx, From(ctx, pool), func(tx pgx.Tx) error {
+		return fn(context.WithValue(ctx, txKey{}, tx))
+	})
+}
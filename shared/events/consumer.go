@@ -0,0 +1,317 @@
+package events
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Handler processes one event. Returning an error schedules a retry.
+type Handler func(ctx context.Context, event *Event) error
+
+// Consumer delivers the events of its topics to handlers. Instances of one
+// service share the subscriber name and split the deliveries between them.
+type Consumer struct {
+	pool       *pgxpool.Pool
+	subscriber string
+	handlers   map[string]Handler
+
+	// PollInterval is how often deliveries are checked without
+	// notifications, e.g. for retries that became due
+	PollInterval time.Duration
+	BatchSize    int
+	// HandlerTimeout bounds a single handler call
+	HandlerTimeout time.Duration
+	// MaxAttempts is how often a delivery is tried before it is marked
+	// failed and left alone
+	MaxAttempts int
+	// Retention is how long events are kept once nobody has to process
+	// them anymore
+	Retention time.Duration
+}
+
+func NewConsumer(pool *pgxpool.Pool, subscriber string) *Consumer {
+	return &Consumer{
+		pool:           pool,
+		subscriber:     subscriber,
+		handlers:       make(map[string]Handler),
+		PollInterval:   5 * time.Second,
+		BatchSize:      20,
+		HandlerTimeout: 30 * time.Second,
+		MaxAttempts:    10,
+		Retention:      7 * 24 * time.Hour,
+	}
+}
+
+// Handle registers the handler of a topic, before Subscribe.
+func (c *Consumer) Handle(topic string, handler Handler) {
+	c.handlers[topic] = handler
+}
+
+// Subscribe records the subscriptions and backfills deliveries for events of
+// the topics still in the outbox, so events published before the first start
+// of the consumer are handled as well. It is safe to call on every start.
+func (c *Consumer) Subscribe(ctx context.Context) error {
+	for topic := range c.handlers {
+		_, err := c.pool.Exec(ctx, `
+			INSERT INTO event_subscriptions (subscriber, topic)
+			VALUES ($1, $2)
+			ON CONFLICT DO NOTHING
+		`, c.subscriber, topic)
+		if err != nil {
+			return fmt.Errorf("Failed to subscribe to %s: %w", topic, err)
+		}
+	}
+
+	return c.backfill(ctx)
+}
+
+// backfill creates the missing deliveries of the subscribed topics. Events
+// that already have one, whatever its status, are left alone. Run repeats it
+// now and then, a publisher that started its transaction before the
+// subscription was committed may not have seen it.
+func (c *Consumer) backfill(ctx context.Context) error {
+	tag, err := c.pool.Exec(ctx, `
+		INSERT INTO event_deliveries (subscriber, event_id)
+		SELECT s.subscriber, e.id
+		FROM event_subscriptions s
+		JOIN event_outbox e ON e.topic = s.topic
+		WHERE s.subscriber = $1
+		ON CONFLICT DO NOTHING
+	`, c.subscriber)
+	if err != nil {
+		return fmt.Errorf("Failed to backfill event deliveries: %w", err)
+	}
+
+	if tag.RowsAffected() > 0 {
+		slog.InfoContext(ctx, "Backfilled event deliveries", "subscriber", c.subscriber, "count", tag.RowsAffected())
+	}
+	return nil
+}
+
+// Run delivers events until ctx is done, it is meant for bootstrap.App.Go.
+// Losing the database does not stop it, it starts over after PollInterval.
+func (c *Consumer) Run(ctx context.Context) error {
+	for {
+		err := c.run(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		slog.ErrorContext(ctx, "Event consumer failed, restarting", "subscriber", c.subscriber, "error", err)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(c.PollInterval):
+		}
+	}
+}
+
+func (c *Consumer) run(ctx context.Context) error {
+	conn, err := c.pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("Failed to acquire listener connection: %w", err)
+	}
+	// LISTEN lasts as long as the session, so the connection is taken out
+	// of the pool instead of going back to it
+	listener := conn.Hijack()
+	defer listener.Close(context.Background())
+
+	if _, err := listener.Exec(ctx, "LISTEN "+channel); err != nil {
+		return fmt.Errorf("Failed to listen for events: %w", err)
+	}
+
+	var lastCleanup time.Time
+	for {
+		for {
+			n, err := c.deliverBatch(ctx)
+			if err != nil {
+				return fmt.Errorf("Failed to deliver events: %w", err)
+			}
+			if n < c.BatchSize {
+				break
+			}
+		}
+
+		if time.Since(lastCleanup) > time.Hour {
+			if err := c.backfill(ctx); err != nil {
+				slog.ErrorContext(ctx, "Failed to backfill event deliveries", "subscriber", c.subscriber, "error", err)
+			}
+			c.cleanup(ctx)
+			lastCleanup = time.Now()
+		}
+
+		waitCtx, cancel := context.WithTimeout(ctx, c.PollInterval)
+		_, err := listener.WaitForNotification(waitCtx)
+		cancel()
+
+		if err != nil && ctx.Err() == nil && !errors.Is(err, context.DeadlineExceeded) {
+			return fmt.Errorf("Failed to wait for events: %w", err)
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+}
+
+// deliverBatch claims due deliveries by postponing them for a lease and
+// commits, so no rows stay locked while handlers run. Other instances skip
+// the claimed deliveries until the lease runs out, e.g. because this one died.
+func (c *Consumer) deliverBatch(ctx context.Context) (int, error) {
+	// handlers run one after another, the lease outlasts the whole batch
+	lease := time.Duration(c.BatchSize)*c.HandlerTimeout + time.Minute
+
+	rows, err := c.pool.Query(ctx, `
+		UPDATE event_deliveries d
+		SET next_attempt_at = NOW() + $3::interval
+		FROM event_outbox e
+		WHERE e.id = d.event_id AND d.subscriber = $1 AND d.event_id IN (
+			SELECT event_id
+			FROM event_deliveries
+			WHERE subscriber = $1 AND status = 'pending' AND next_attempt_at <= NOW()
+			ORDER BY event_id
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING e.id, e.topic, e.producer, e.payload, e.created_at, d.attempts
+	`, c.subscriber, c.BatchSize, lease)
+	if err != nil {
+		return 0, err
+	}
+
+	type delivery struct {
+		event    Event
+		attempts int
+	}
+	batch, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (delivery, error) {
+		var d delivery
+		err := row.Scan(&d.event.ID, &d.event.Topic, &d.event.Producer, &d.event.Payload, &d.event.CreatedAt, &d.attempts)
+		return d, err
+	})
+	if err != nil {
+		return 0, err
+	}
+	// RETURNING keeps no order, events are handled in the order they were
+	// published
+	slices.SortFunc(batch, func(a, b delivery) int {
+		return cmp.Compare(a.event.ID, b.event.ID)
+	})
+
+	for i, d := range batch {
+		handleErr := c.handle(ctx, &d.event)
+		if ctx.Err() != nil {
+			// shutting down, the rest of the batch does not have to wait
+			// for its lease
+			ids := make([]int64, 0, len(batch)-i)
+			for _, rest := range batch[i:] {
+				ids = append(ids, rest.event.ID)
+			}
+			c.release(ids)
+			return 0, ctx.Err()
+		}
+
+		if handleErr == nil {
+			_, err = c.pool.Exec(ctx, `
+				UPDATE event_deliveries
+				SET status = 'delivered', attempts = attempts + 1, delivered_at = NOW(), last_error = NULL
+				WHERE subscriber = $1 AND event_id = $2
+			`, c.subscriber, d.event.ID)
+			if err != nil {
+				return 0, err
+			}
+			continue
+		}
+
+		attempts := d.attempts + 1
+		status := "pending"
+		if attempts >= c.MaxAttempts {
+			status = "failed"
+			slog.ErrorContext(ctx, "Giving up on event", "subscriber", c.subscriber, "topic", d.event.Topic,
+				"event_id", d.event.ID, "attempts", attempts, "error", handleErr)
+		} else {
+			slog.WarnContext(ctx, "Failed to handle event, will retry", "subscriber", c.subscriber,
+				"topic", d.event.Topic, "event_id", d.event.ID, "attempts", attempts, "error", handleErr)
+		}
+
+		_, err = c.pool.Exec(ctx, `
+			UPDATE event_deliveries
+			SET status = $3, attempts = $4, last_error = $5, next_attempt_at = NOW() + $6::interval
+			WHERE subscriber = $1 AND event_id = $2
+		`, c.subscriber, d.event.ID, status, attempts, handleErr.Error(), backoff(attempts))
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(batch), nil
+}
+
+// release makes claimed deliveries due again. It runs on shutdown, so it
+// does not use the cancelled context of the consumer.
+func (c *Consumer) release(eventIDs []int64) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := c.pool.Exec(ctx, `
+		UPDATE event_deliveries
+		SET next_attempt_at = NOW()
+		WHERE subscriber = $1 AND event_id = ANY($2) AND status = 'pending'
+	`, c.subscriber, eventIDs)
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to release event deliveries, they are retried after their lease",
+			"subscriber", c.subscriber, "error", err)
+	}
+}
+
+func (c *Consumer) handle(ctx context.Context, event *Event) (err error) {
+	handler, ok := c.handlers[event.Topic]
+	if !ok {
+		return fmt.Errorf("No handler for topic %s", event.Topic)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.HandlerTimeout)
+	defer cancel()
+
+	defer func() {
+		if v := recover(); v != nil {
+			err = fmt.Errorf("Handler panicked: %v", v)
+		}
+	}()
+
+	return handler(ctx, event)
+}
+
+// backoff doubles the delay with every attempt, from 1s up to 10 minutes.
+func backoff(attempts int) time.Duration {
+	delay := time.Duration(math.Pow(2, float64(attempts-1))) * time.Second
+	return min(delay, 10*time.Minute)
+}
+
+// cleanup removes events older than the retention that no subscriber still
+// has to process, with their deliveries.
+func (c *Consumer) cleanup(ctx context.Context) {
+	tag, err := c.pool.Exec(ctx, `
+		DELETE FROM event_outbox e
+		WHERE e.created_at < NOW() - $1::interval
+		AND NOT EXISTS (
+			SELECT 1 FROM event_deliveries d
+			WHERE d.event_id = e.id AND d.status = 'pending'
+		)
+	`, c.Retention)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to clean up old events", "error", err)
+		return
+	}
+
+	if tag.RowsAffected() > 0 {
+		slog.InfoContext(ctx, "Cleaned up old events", "count", tag.RowsAffected())
+	}
+}
@@ -0,0 +1,123 @@
+// Package events is a small event bus on top of Postgres. Producers write
+// events into the event_outbox table in the same transaction as the change
+// they announce (see dbtx.InTx), so an event exists if and only if the change
+// was committed. Every subscriber of the topic gets its own delivery row,
+// which a Consumer picks up and retries until its handler succeeds.
+//
+// Delivery is at least once: a handler may see the same event again after a
+// crash or a failed commit and has to be idempotent, Event.ID identifies
+// redeliveries.
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/KEPTANy/plag-check/shared/dbtx"
+	"github.com/gofrs/uuid/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// channel is the Postgres notification channel consumers listen on
+const channel = "event_outbox"
+
+const (
+	TopicFileUploaded      = "file.uploaded"
+	TopicAnalysisCompleted = "analysis.completed"
+	TopicUserRegistered    = "user.registered"
+)
+
+type FileUploaded struct {
+	FileID    int       `json:"file_id"`
+	StudentID uuid.UUID `json:"student_id"`
+	FileHash  string    `json:"file_hash"`
+	FileSize  int64     `json:"file_size"`
+	Filename  string    `json:"filename"`
+	Course    string    `json:"course,omitempty"`
+}
+
+type Match struct {
+	FileID    int       `json:"file_id"`
+	StudentID uuid.UUID `json:"student_id"`
+	// Similarity is in a range of 0 to 1, identical content is 1
+	Similarity float64 `json:"similarity"`
+}
+
+// AnalysisCompleted is published once per uploaded file. Matches are earlier
+// files of other students with the same content, empty for original work.
+type AnalysisCompleted struct {
+	FileID    int       `json:"file_id"`
+	StudentID uuid.UUID `json:"student_id"`
+	Course    string    `json:"course,omitempty"`
+	Matches   []Match   `json:"matches"`
+}
+
+type UserRegistered struct {
+	UserID   uuid.UUID `json:"user_id"`
+	Username string    `json:"username"`
+	Role     string    `json:"role"`
+	// Source is "register", "roster" or "oidc"
+	Source string `json:"source"`
+}
+
+type Event struct {
+	ID        int64
+	Topic     string
+	Producer  string
+	Payload   json.RawMessage
+	CreatedAt time.Time
+}
+
+// Decode unmarshals the payload into v.
+func (e *Event) Decode(v any) error {
+	if err := json.Unmarshal(e.Payload, v); err != nil {
+		return fmt.Errorf("Failed to decode %s event %d: %w", e.Topic, e.ID, err)
+	}
+	return nil
+}
+
+type Publisher struct {
+	pool     *pgxpool.Pool
+	producer string
+}
+
+func NewPublisher(pool *pgxpool.Pool, producer string) *Publisher {
+	return &Publisher{pool: pool, producer: producer}
+}
+
+// Publish stores an event with payload encoded as JSON and a delivery for
+// every subscriber of topic. Called inside dbtx.InTx it joins the
+// transaction and the event is only seen by consumers after commit.
+func (p *Publisher) Publish(ctx context.Context, topic string, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("Failed to encode %s event: %w", topic, err)
+	}
+
+	query := `
+		WITH event AS (
+			INSERT INTO event_outbox (topic, producer, payload)
+			VALUES ($1, $2, $3)
+			RETURNING id
+		)
+		INSERT INTO event_deliveries (subscriber, event_id)
+		SELECT s.subscriber, event.id
+		FROM event_subscriptions s, event
+		WHERE s.topic = $1
+	`
+
+	db := dbtx.From(ctx, p.pool)
+	if _, err := db.Exec(ctx, query, topic, p.producer, data); err != nil {
+		return fmt.Errorf("Failed to publish %s event: %w", topic, err)
+	}
+
+	// delivered on commit, wakes consumers up instead of them waiting for
+	// the next poll
+	if _, err := db.Exec(ctx, `SELECT pg_notify($1, $2)`, channel, topic); err != nil {
+		return fmt.Errorf("Failed to notify about %s event: %w", topic, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS event_deliveries;
+DROP TABLE IF EXISTS event_subscriptions;
+DROP TABLE IF EXISTS event_outbox;
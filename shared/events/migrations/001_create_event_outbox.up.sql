@@ -0,0 +1,32 @@
+CREATE TABLE IF NOT EXISTS event_outbox (
+    id BIGSERIAL PRIMARY KEY,
+    topic VARCHAR(100) NOT NULL,
+    producer VARCHAR(100) NOT NULL,
+    payload JSONB NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS event_outbox_created_at_idx ON event_outbox (created_at);
+
+CREATE TABLE IF NOT EXISTS event_subscriptions (
+    subscriber VARCHAR(100) NOT NULL,
+    topic VARCHAR(100) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (subscriber, topic)
+);
+
+-- one row per event and subscriber, written together with the event
+CREATE TABLE IF NOT EXISTS event_deliveries (
+    subscriber VARCHAR(100) NOT NULL,
+    event_id BIGINT NOT NULL REFERENCES event_outbox (id) ON DELETE CASCADE,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'delivered', 'failed')),
+    attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT,
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    delivered_at TIMESTAMPTZ,
+    PRIMARY KEY (subscriber, event_id)
+);
+
+CREATE INDEX IF NOT EXISTS event_deliveries_pending_idx
+    ON event_deliveries (subscriber, next_attempt_at)
+    WHERE status = 'pending';
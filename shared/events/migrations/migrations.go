@@ -0,0 +1,8 @@
+// Package migrations embeds the SQL migrations of the event bus, see
+// shared/migrate for the file naming.
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS
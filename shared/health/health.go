@@ -0,0 +1,73 @@
+// Package health serves the /health endpoint of the backend services.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const checkTimeout = 2 * time.Second
+
+// Check verifies one dependency of the service, e.g. the database.
+type Check func(ctx context.Context) error
+
+type Handler struct {
+	Checks map[string]Check
+}
+
+func NewHandler(checks map[string]Check) *Handler {
+	return &Handler{Checks: checks}
+}
+
+// ServeHTTP runs all checks concurrently and reports 503 if any of them
+// fails, so load balancers stop sending traffic to an instance that cannot
+// serve it. The endpoint is public, failed checks are only named in the
+// response, their errors are logged.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), checkTimeout)
+	defer cancel()
+
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		healthy = true
+		results = make(map[string]string, len(h.Checks))
+	)
+
+	for name, check := range h.Checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			err := check(ctx)
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if err != nil {
+				slog.ErrorContext(ctx, "Health check failed", "check", name, "error", err)
+				healthy = false
+				results[name] = "unavailable"
+				return
+			}
+			results[name] = "OK"
+		}()
+	}
+	wg.Wait()
+
+	status, code := "OK", http.StatusOK
+	if !healthy {
+		status, code = "unavailable", http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]any{
+		"status": status,
+		"checks": results,
+	})
+}
@@ -0,0 +1,53 @@
+package identity
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+)
+
+func TestSignVerify(t *testing.T) {
+	id := Identity{UserID: uuid.Must(uuid.NewV4()), Username: "alice", Role: "student"}
+
+	signed, err := Sign(id, time.Minute, "secret")
+	if err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+
+	got, err := Verify(signed, "secret")
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if got.UserID != id.UserID || got.Username != id.Username || got.Role != id.Role {
+		t.Errorf("Verify() = %+v, want %+v", got, id)
+	}
+
+	payload, signature, _ := strings.Cut(signed, ".")
+	forged, _ := Sign(Identity{UserID: id.UserID, Username: "alice", Role: "teacher"}, time.Minute, "other secret")
+	forgedPayload, _, _ := strings.Cut(forged, ".")
+	expired, _ := Sign(id, -time.Minute, "secret")
+
+	tests := []struct {
+		name   string
+		value  string
+		secret string
+		want   error
+	}{
+		{"wrong secret", signed, "other secret", ErrSignature},
+		{"swapped payload", forgedPayload + "." + signature, "secret", ErrSignature},
+		{"no signature", payload, "secret", ErrMalformed},
+		{"bad signature encoding", payload + ".!!!", "secret", ErrMalformed},
+		{"expired", expired, "secret", ErrExpired},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Verify(tt.value, tt.secret); !errors.Is(err, tt.want) {
+				t.Errorf("Verify() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+// Package logging sets up JSON logging shared by all services.
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/KEPTANy/plag-check/shared/middleware"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Setup makes a JSON slog logger the default one, log.Printf included. The
+// level is read from LOG_LEVEL (debug, info, warn or error, info by default).
+// Records logged with a request context get the request, user and trace ID.
+func Setup(service string) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(strings.TrimSpace(os.Getenv("LOG_LEVEL")))); err != nil {
+		level = slog.LevelInfo
+	}
+
+	handler := slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: level})
+	logger := slog.New(&contextHandler{handler}).With(slog.String("service", service))
+
+	slog.SetDefault(logger)
+}
+
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h *contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if id := middleware.GetRequestID(ctx); id != "" {
+		record.AddAttrs(slog.String("request_id", id))
+	}
+	if user := middleware.GetRequestUser(ctx); user != "" {
+		record.AddAttrs(slog.String("user_id", user))
+	}
+	if span := trace.SpanContextFromContext(ctx); span.IsValid() {
+		record.AddAttrs(slog.String("trace_id", span.TraceID().String()))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{h.Handler.WithGroup(name)}
+}
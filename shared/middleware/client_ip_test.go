@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	gateway := []netip.Prefix{netip.MustParsePrefix("172.16.0.0/12")}
+
+	tests := []struct {
+		name      string
+		trusted   []netip.Prefix
+		peer      string
+		forwarded []string
+		want      string
+	}{
+		{"no proxies", nil, "203.0.113.7:5000", nil, "203.0.113.7"},
+		{"untrusted peer", nil, "203.0.113.7:5000", []string{"198.51.100.1"}, "203.0.113.7"},
+		{"peer outside trusted", gateway, "203.0.113.7:5000", []string{"198.51.100.1"}, "203.0.113.7"},
+		{"trusted peer", gateway, "172.18.0.5:5000", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"forged entries", gateway, "172.18.0.5:5000", []string{"10.0.0.1, 198.51.100.1"}, "198.51.100.1"},
+		{"repeated header", gateway, "172.18.0.5:5000", []string{"10.0.0.1", "198.51.100.1"}, "198.51.100.1"},
+		{"trusted peer without header", gateway, "172.18.0.5:5000", nil, "172.18.0.5"},
+		{"mapped IPv4 peer", gateway, "[::ffff:172.18.0.5]:5000", []string{"198.51.100.1"}, "198.51.100.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.peer
+			for _, value := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", value)
+			}
+
+			var got string
+			ClientIP(tt.trusted)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = GetClientIP(r.Context())
+			})).ServeHTTP(httptest.NewRecorder(), r)
+
+			if got != tt.want {
+				t.Errorf("client IP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
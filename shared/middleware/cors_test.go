@@ -0,0 +1,118 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCORS(t *testing.T) {
+	config := CORSConfig{
+		AllowedOrigins:   []string{"https://app.example.com", "https://*.example.org"},
+		AllowedMethods:   []string{"GET", "POST"},
+		AllowedHeaders:   []string{"Authorization", "Content-Type"},
+		ExposedHeaders:   []string{"ETag"},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	}
+
+	tests := []struct {
+		name      string
+		config    CORSConfig
+		method    string
+		origin    string
+		preflight bool
+
+		wantStatus      int
+		wantOrigin      string
+		wantCredentials string
+		wantMethods     string
+		wantExposed     string
+		wantServed      bool
+	}{
+		{
+			name: "exact origin", config: config, method: http.MethodGet, origin: "https://app.example.com",
+			wantStatus: http.StatusOK, wantOrigin: "https://app.example.com", wantCredentials: "true",
+			wantExposed: "ETag", wantServed: true,
+		},
+		{
+			name: "wildcard origin", config: config, method: http.MethodGet, origin: "https://lab.example.org",
+			wantStatus: http.StatusOK, wantOrigin: "https://lab.example.org", wantCredentials: "true",
+			wantExposed: "ETag", wantServed: true,
+		},
+		{
+			name: "wildcard matches no empty part", config: config, method: http.MethodGet, origin: "https://.example.org",
+			wantStatus: http.StatusOK, wantServed: true,
+		},
+		{
+			name: "disallowed origin", config: config, method: http.MethodGet, origin: "https://evil.example.net",
+			wantStatus: http.StatusOK, wantServed: true,
+		},
+		{
+			name: "no origin", config: config, method: http.MethodGet,
+			wantStatus: http.StatusOK, wantServed: true,
+		},
+		{
+			name: "preflight", config: config, method: http.MethodOptions, origin: "https://app.example.com", preflight: true,
+			wantStatus: http.StatusNoContent, wantOrigin: "https://app.example.com", wantCredentials: "true",
+			wantMethods: "GET, POST",
+		},
+		{
+			name: "preflight of disallowed origin", config: config, method: http.MethodOptions, origin: "https://evil.example.net", preflight: true,
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name:   "any origin never allows credentials",
+			config: CORSConfig{AllowedOrigins: []string{"*"}, AllowCredentials: true},
+			method: http.MethodGet, origin: "https://evil.example.net",
+			wantStatus: http.StatusOK, wantOrigin: "*", wantServed: true,
+		},
+		{
+			name:   "disabled",
+			config: CORSConfig{},
+			method: http.MethodOptions, origin: "https://app.example.com", preflight: true,
+			wantStatus: http.StatusOK, wantServed: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			served := false
+			h := CORS(tt.config)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				served = true
+			}))
+
+			r := httptest.NewRequest(tt.method, "/files", nil)
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			if tt.preflight {
+				r.Header.Set("Access-Control-Request-Method", http.MethodPost)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, r)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if served != tt.wantServed {
+				t.Errorf("served = %v, want %v", served, tt.wantServed)
+			}
+
+			header := rec.Header()
+			if got := header.Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.wantOrigin)
+			}
+			if got := header.Get("Access-Control-Allow-Credentials"); got != tt.wantCredentials {
+				t.Errorf("Access-Control-Allow-Credentials = %q, want %q", got, tt.wantCredentials)
+			}
+			if got := header.Get("Access-Control-Allow-Methods"); got != tt.wantMethods {
+				t.Errorf("Access-Control-Allow-Methods = %q, want %q", got, tt.wantMethods)
+			}
+			if got := header.Get("Access-Control-Expose-Headers"); got != tt.wantExposed {
+				t.Errorf("Access-Control-Expose-Headers = %q, want %q", got, tt.wantExposed)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests by method, route and status code.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "HTTP request latency by method and route.",
+		Buckets: []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"method", "route"})
+
+	httpInFlight = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "http_requests_in_flight",
+		Help: "HTTP requests currently being served.",
+	})
+)
+
+// any other method is counted as OTHER, clients must not be able to create
+// time series at will
+var knownMethods = map[string]bool{
+	http.MethodGet: true, http.MethodHead: true, http.MethodPost: true, http.MethodPut: true,
+	http.MethodPatch: true, http.MethodDelete: true, http.MethodOptions: true,
+}
+
+// MetricsMiddleware records request counts and latencies. It has to wrap the
+// ServeMux directly, or the mux has to be wrapped in PatternMiddleware, to
+// know the route.
+// Requests are labelled by route pattern rather than path, so IDs in paths
+// do not create a time series each.
+func MetricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		httpInFlight.Inc()
+		defer httpInFlight.Dec()
+
+		writer := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK, written: false}
+		defer func() {
+			route := requestRoute(r)
+			if route == "" {
+				route = "unmatched"
+			}
+
+			method := r.Method
+			if !knownMethods[method] {
+				method = "OTHER"
+			}
+
+			httpRequests.WithLabelValues(method, route, strconv.Itoa(writer.statusCode)).Inc()
+			httpDuration.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+		}()
+
+		next.ServeHTTP(writer, r)
+	})
+}
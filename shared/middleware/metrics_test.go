@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetricsMiddleware(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /files/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("id") == "0" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	h := TracingMiddleware(MetricsMiddleware(PatternMiddleware(mux)))
+
+	tests := []struct {
+		method, path         string
+		route, label, status string
+	}{
+		{http.MethodGet, "/files/1", "GET /files/{id}", "GET", "200"},
+		{http.MethodGet, "/files/0", "GET /files/{id}", "GET", "404"},
+		{http.MethodGet, "/missing/42", "unmatched", "GET", "404"},
+		{"BREW", "/files/1", "unmatched", "OTHER", "405"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			counter := httpRequests.WithLabelValues(tt.label, tt.route, tt.status)
+			before := testutil.ToFloat64(counter)
+
+			h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(tt.method, tt.path, nil))
+
+			if got := testutil.ToFloat64(counter) - before; got != 1 {
+				t.Errorf("http_requests_total{method=%q, route=%q, status=%q} grew by %v, want 1",
+					tt.label, tt.route, tt.status, got)
+			}
+		})
+	}
+
+	if got := testutil.ToFloat64(httpInFlight); got != 0 {
+		t.Errorf("http_requests_in_flight = %v after all requests finished", got)
+	}
+}
@@ -1,26 +1,127 @@
 package middleware
 
 import (
+	"context"
 	"encoding/json"
-	"log"
+	"log/slog"
 	"net/http"
+	"sync"
 	"time"
 )
 
 type Middleware func(http.Handler) http.Handler
 
+// RequestInfo collects what is only known deeper in the handler chain, e.g.
+// the user once the token is checked, for the request log line.
+type RequestInfo struct {
+	mu     sync.Mutex
+	userID string
+	route  string
+}
+
+type requestInfoKey struct{}
+
+func getRequestInfo(ctx context.Context) *RequestInfo {
+	info, _ := ctx.Value(requestInfoKey{}).(*RequestInfo)
+	return info
+}
+
+// withRequestInfo returns the request info of r, attaching a new one when
+// no middleware before has done it.
+func withRequestInfo(r *http.Request) (*http.Request, *RequestInfo) {
+	if info := getRequestInfo(r.Context()); info != nil {
+		return r, info
+	}
+
+	info := &RequestInfo{}
+	return r.WithContext(context.WithValue(r.Context(), requestInfoKey{}, info)), info
+}
+
+// requestRoute returns the route recorded for r or, when r is the request
+// a ServeMux was given, the matched pattern.
+func requestRoute(r *http.Request) string {
+	if info := getRequestInfo(r.Context()); info != nil {
+		info.mu.Lock()
+		defer info.mu.Unlock()
+		if info.route != "" {
+			return info.route
+		}
+	}
+	return r.Pattern
+}
+
+// SetRequestUser records the authenticated user of the request for logging.
+func SetRequestUser(ctx context.Context, userID string) {
+	if info := getRequestInfo(ctx); info != nil {
+		info.mu.Lock()
+		info.userID = userID
+		info.mu.Unlock()
+	}
+}
+
+// SetRequestRoute records the matched route when it is not a ServeMux
+// pattern, e.g. a route of the gateway table.
+func SetRequestRoute(ctx context.Context, route string) {
+	if info := getRequestInfo(ctx); info != nil {
+		info.mu.Lock()
+		info.route = route
+		info.mu.Unlock()
+	}
+}
+
+// PatternMiddleware has to wrap a ServeMux directly. It records the matched
+// pattern as the route when other middleware that replaces the request sits
+// between the mux and LoggingMiddleware, MetricsMiddleware or
+// TracingMiddleware.
+func PatternMiddleware(mux http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mux.ServeHTTP(w, r)
+
+		if info := getRequestInfo(r.Context()); info != nil && r.Pattern != "" {
+			info.mu.Lock()
+			if info.route == "" {
+				info.route = r.Pattern
+			}
+			info.mu.Unlock()
+		}
+	})
+}
+
+// GetRequestUser returns the user recorded with SetRequestUser, if any.
+func GetRequestUser(ctx context.Context) string {
+	info := getRequestInfo(ctx)
+	if info == nil {
+		return ""
+	}
+
+	info.mu.Lock()
+	defer info.mu.Unlock()
+	return info.userID
+}
+
 func LoggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
 
+		r, _ = withRequestInfo(r)
+
 		writer := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK, written: false}
 		defer func() {
-			log.Printf("[%s] %s %s - %d (%s)",
-				r.Method,
-				r.URL.Path,
-				r.RemoteAddr,
-				writer.statusCode,
-				time.Since(start),
+			route := requestRoute(r)
+
+			level := slog.LevelInfo
+			if writer.statusCode >= http.StatusInternalServerError {
+				level = slog.LevelError
+			}
+
+			slog.LogAttrs(r.Context(), level, "request",
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.String("route", route),
+				slog.Int("status", writer.statusCode),
+				slog.Int64("bytes", writer.bytes),
+				slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+				slog.String("remote_addr", r.RemoteAddr),
 			)
 		}()
 
@@ -32,12 +133,17 @@ func RecoveringMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
 			if err := recover(); err != nil {
-				log.Printf("PANIC RECOVERED: %v", err)
+				slog.ErrorContext(r.Context(), "Panic recovered", "panic", err)
 
+				// the envelope of shared/apperror, which imports this package
 				w.Header().Set("Content-Type", "application/json")
 				w.WriteHeader(http.StatusInternalServerError)
 				json.NewEncoder(w).Encode(map[string]any{
-					"error": "internal server error",
+					"error": map[string]any{
+						"code":       "internal",
+						"message":    "internal server error",
+						"request_id": GetRequestID(r.Context()),
+					},
 				})
 			}
 		}()
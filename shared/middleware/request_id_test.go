@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofrs/uuid/v5"
+)
+
+func TestRequestIDMiddleware(t *testing.T) {
+	tests := []struct {
+		name     string
+		incoming string
+		keep     bool
+	}{
+		{"none", "", false},
+		{"valid", "3f2a-b1_c.d:e", true},
+		{"uuid", "0b5c8c1e-7d1f-4b8e-9a6e-2f1c3d4e5f60", true},
+		{"forged log line", "abc\nlevel=ERROR msg=forged", false},
+		{"spaces", "a b", false},
+		{"too long", strings.Repeat("a", 129), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var inContext, forwarded string
+			h := RequestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				inContext = GetRequestID(r.Context())
+				forwarded = r.Header.Get(RequestIDHeader)
+			}))
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.incoming != "" {
+				r.Header.Set(RequestIDHeader, tt.incoming)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, r)
+
+			if tt.keep && inContext != tt.incoming {
+				t.Errorf("request ID = %q, want the caller's %q", inContext, tt.incoming)
+			}
+			if !tt.keep {
+				if _, err := uuid.FromString(inContext); err != nil {
+					t.Errorf("request ID = %q, want a generated UUID", inContext)
+				}
+			}
+			if forwarded != inContext {
+				t.Errorf("forwarded request ID = %q, want %q", forwarded, inContext)
+			}
+			if got := rec.Header().Get(RequestIDHeader); got != inContext {
+				t.Errorf("response request ID = %q, want %q", got, inContext)
+			}
+		})
+	}
+}
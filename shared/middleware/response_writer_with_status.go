@@ -6,6 +6,7 @@ type responseWriter struct {
 	http.ResponseWriter
 	statusCode int
 	written    bool
+	bytes      int64
 }
 
 func (rw *responseWriter) WriteHeader(code int) {
@@ -21,5 +22,13 @@ func (rw *responseWriter) Write(b []byte) (int, error) {
 		rw.statusCode = http.StatusOK
 	}
 	rw.written = true
-	return rw.ResponseWriter.Write(b)
+	n, err := rw.ResponseWriter.Write(b)
+	rw.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, e.g. to
+// flush streamed responses.
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
 }
@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/KEPTANy/plag-check/shared/middleware"
+
+// TracingMiddleware continues the trace of the W3C traceparent header, or
+// starts a new one, with a server span per request. It should come before
+// LoggingMiddleware, so the request log line gets the trace ID, and the mux
+// should be wrapped in PatternMiddleware to name spans by route.
+func TracingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r, _ = withRequestInfo(r)
+
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := otel.Tracer(tracerName).Start(ctx, r.Method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(r.Method),
+				semconv.URLPath(r.URL.Path),
+				semconv.ClientAddress(r.RemoteAddr),
+				attribute.String("request_id", GetRequestID(r.Context())),
+			),
+		)
+		defer span.End()
+
+		writer := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK, written: false}
+		r = r.WithContext(ctx)
+		defer func() {
+			if route := requestRoute(r); route != "" {
+				// ServeMux patterns may start with a method
+				if _, path, ok := strings.Cut(route, " "); ok {
+					route = path
+				}
+				span.SetName(r.Method + " " + route)
+				span.SetAttributes(semconv.HTTPRoute(route))
+			}
+
+			span.SetAttributes(semconv.HTTPResponseStatusCode(writer.statusCode))
+			if writer.statusCode >= http.StatusInternalServerError {
+				span.SetStatus(codes.Error, http.StatusText(writer.statusCode))
+			}
+		}()
+
+		next.ServeHTTP(writer, r)
+	})
+}
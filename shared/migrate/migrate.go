@@ -0,0 +1,326 @@
+// Package migrate applies versioned SQL migrations. Migrations are files
+// named <version>_<name>.up.sql with an optional <version>_<name>.down.sql,
+// usually embedded into the service binary. Applied versions are recorded in
+// the schema_migrations table per service, since all services share one
+// database.
+package migrate
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// lockKey is the advisory lock held while migrating. It is the same for every
+// service, so services starting together migrate one after another.
+const lockKey int64 = 0x6d69677261746573
+
+// undefinedTable is the Postgres error code of a missing table
+const undefinedTable = "42P01"
+
+var fileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	// Down is empty for migrations that cannot be rolled back
+	Down string
+}
+
+// Status is a known migration and when it was applied, AppliedAt is zero for
+// pending ones.
+type Status struct {
+	Migration
+	AppliedAt time.Time
+}
+
+type Migrator struct {
+	pool       *pgxpool.Pool
+	service    string
+	migrations []Migration
+}
+
+// New reads the migrations of service from the root of fsys.
+func New(pool *pgxpool.Pool, service string, fsys fs.FS) (*Migrator, error) {
+	migrations, err := load(fsys)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{pool: pool, service: service, migrations: migrations}, nil
+}
+
+func load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read migrations: %w", err)
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		match := fileName.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Bad migration version in %s: %w", entry.Name(), err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("Migrations %s and %s share version %d", m.Name, match[2], version)
+		}
+
+		sql, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read migration %s: %w", entry.Name(), err)
+		}
+
+		if match[3] == "up" {
+			m.Up = string(sql)
+		} else {
+			m.Down = string(sql)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("Migration %d_%s has no up file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	slices.SortFunc(migrations, func(a, b Migration) int {
+		return cmp.Compare(a.Version, b.Version)
+	})
+
+	return migrations, nil
+}
+
+// Up loads the migrations of service from fsys and applies the pending ones.
+func Up(ctx context.Context, pool *pgxpool.Pool, service string, fsys fs.FS) error {
+	migrator, err := New(pool, service, fsys)
+	if err != nil {
+		return err
+	}
+
+	_, err = migrator.Up(ctx)
+	return err
+}
+
+// Up applies every pending migration in version order, each in its own
+// transaction. It returns how many were applied.
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	applied := 0
+	err := m.locked(ctx, func(conn *pgxpool.Conn) error {
+		done, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			if _, ok := done[migration.Version]; ok {
+				continue
+			}
+
+			err := pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+				if _, err := tx.Exec(ctx, migration.Up); err != nil {
+					return err
+				}
+				_, err := tx.Exec(ctx, `
+					INSERT INTO schema_migrations (service, version, name)
+					VALUES ($1, $2, $3)
+				`, m.service, migration.Version, migration.Name)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("Failed to apply migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+
+			slog.InfoContext(ctx, "Applied migration", "version", migration.Version, "name", migration.Name)
+			applied++
+		}
+
+		return nil
+	})
+
+	return applied, err
+}
+
+// Down rolls back the last steps applied migrations, newest first.
+func (m *Migrator) Down(ctx context.Context, steps int) error {
+	return m.locked(ctx, func(conn *pgxpool.Conn) error {
+		done, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		versions := make([]int64, 0, len(done))
+		for version := range done {
+			versions = append(versions, version)
+		}
+		slices.Sort(versions)
+		slices.Reverse(versions)
+
+		for _, version := range versions[:min(steps, len(versions))] {
+			i := slices.IndexFunc(m.migrations, func(migration Migration) bool {
+				return migration.Version == version
+			})
+			if i < 0 {
+				return fmt.Errorf("Migration %d is applied but unknown to this build", version)
+			}
+
+			migration := m.migrations[i]
+			if migration.Down == "" {
+				return fmt.Errorf("Migration %d_%s cannot be rolled back", migration.Version, migration.Name)
+			}
+
+			err := pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+				if _, err := tx.Exec(ctx, migration.Down); err != nil {
+					return err
+				}
+				_, err := tx.Exec(ctx, `
+					DELETE FROM schema_migrations
+					WHERE service = $1 AND version = $2
+				`, m.service, migration.Version)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("Failed to roll back migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+
+			slog.InfoContext(ctx, "Rolled back migration", "version", migration.Version, "name", migration.Name)
+		}
+
+		return nil
+	})
+}
+
+// Status lists the known migrations in version order.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	var statuses []Status
+	err := m.locked(ctx, func(conn *pgxpool.Conn) error {
+		done, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		statuses = make([]Status, 0, len(m.migrations))
+		for _, migration := range m.migrations {
+			statuses = append(statuses, Status{Migration: migration, AppliedAt: done[migration.Version]})
+		}
+		return nil
+	})
+
+	return statuses, err
+}
+
+// locked runs fn on a single connection holding the migration lock. The
+// schema_migrations table is created under the lock as well, concurrent
+// CREATE TABLE IF NOT EXISTS statements may otherwise fail.
+func (m *Migrator) locked(ctx context.Context, fn func(conn *pgxpool.Conn) error) error {
+	conn, err := m.pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("Failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, `SELECT pg_advisory_lock($1)`, lockKey); err != nil {
+		return fmt.Errorf("Failed to take migration lock: %w", err)
+	}
+	defer func() {
+		// the session lock would outlive a failed unlock on a pooled
+		// connection, so such a connection is dropped
+		if _, err := conn.Exec(context.Background(), `SELECT pg_advisory_unlock($1)`, lockKey); err != nil {
+			conn.Conn().Close(context.Background())
+		}
+	}()
+
+	_, err = conn.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			service VARCHAR(100) NOT NULL,
+			version BIGINT NOT NULL,
+			name VARCHAR(255) NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			PRIMARY KEY (service, version)
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("Failed to create schema_migrations table: %w", err)
+	}
+
+	return fn(conn)
+}
+
+func (m *Migrator) applied(ctx context.Context, conn *pgxpool.Conn) (map[int64]time.Time, error) {
+	rows, err := conn.Query(ctx, `
+		SELECT version, applied_at
+		FROM schema_migrations
+		WHERE service = $1
+	`, m.service)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get applied migrations: %w", err)
+	}
+	defer rows.Close()
+
+	done := make(map[int64]time.Time)
+	for rows.Next() {
+		var (
+			version   int64
+			appliedAt time.Time
+		)
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, fmt.Errorf("Failed to get applied migrations: %w", err)
+		}
+		done[version] = appliedAt
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("Failed to get applied migrations: %w", err)
+	}
+
+	return done, nil
+}
+
+// Require fails unless migration version of another service has been
+// applied. It is meant for services reading tables they do not own.
+func Require(ctx context.Context, pool *pgxpool.Pool, service string, version int64) error {
+	var applied bool
+	err := pool.QueryRow(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM schema_migrations
+			WHERE service = $1 AND version = $2
+		)
+	`, service, version).Scan(&applied)
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == undefinedTable {
+		applied, err = false, nil
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to check migrations of %s: %w", service, err)
+	}
+
+	if !applied {
+		return fmt.Errorf("Migration %d of %s is not applied yet", version, service)
+	}
+	return nil
+}
@@ -0,0 +1,251 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func file(sql string) *fstest.MapFile {
+	return &fstest.MapFile{Data: []byte(sql)}
+}
+
+func TestLoad(t *testing.T) {
+	migrations, err := load(fstest.MapFS{
+		"002_add_index.up.sql":      file("CREATE INDEX"),
+		"001_create_users.up.sql":   file("CREATE TABLE"),
+		"001_create_users.down.sql": file("DROP TABLE"),
+		"010_backfill.up.sql":       file("UPDATE"),
+		// not migrations
+		"README.md":        file("docs"),
+		"003_broken.sql":   file("?"),
+		"embed.go":         file("package migrations"),
+		"004_dir.up.sql/x": file("?"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Migration{
+		{Version: 1, Name: "create_users", Up: "CREATE TABLE", Down: "DROP TABLE"},
+		{Version: 2, Name: "add_index", Up: "CREATE INDEX"},
+		{Version: 10, Name: "backfill", Up: "UPDATE"},
+	}
+	if len(migrations) != len(want) {
+		t.Fatalf("load() = %+v, want %+v", migrations, want)
+	}
+	for i := range want {
+		if migrations[i] != want[i] {
+			t.Errorf("migration %d = %+v, want %+v", i, migrations[i], want[i])
+		}
+	}
+}
+
+func TestLoadRejects(t *testing.T) {
+	tests := []struct {
+		name    string
+		fsys    fstest.MapFS
+		wantErr string
+	}{
+		{
+			name: "duplicate version",
+			fsys: fstest.MapFS{
+				"001_create_users.up.sql": file("CREATE TABLE users"),
+				"001_create_files.up.sql": file("CREATE TABLE files"),
+			},
+			wantErr: "share version 1",
+		},
+		{
+			name: "duplicate version of a down file",
+			fsys: fstest.MapFS{
+				"001_create_users.up.sql":   file("CREATE TABLE users"),
+				"001_create_files.down.sql": file("DROP TABLE files"),
+			},
+			wantErr: "share version 1",
+		},
+		{
+			name: "missing up file",
+			fsys: fstest.MapFS{
+				"001_create_users.up.sql": file("CREATE TABLE users"),
+				"002_add_index.down.sql":  file("DROP INDEX"),
+			},
+			wantErr: "2_add_index has no up file",
+		},
+		{
+			name: "version out of range",
+			fsys: fstest.MapFS{
+				"99999999999999999999_huge.up.sql": file("SELECT 1"),
+			},
+			wantErr: "Bad migration version",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := load(tt.fsys)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("load() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// testPool connects to DATABASE_URL, tests that need Postgres are skipped
+// without it.
+func testPool(t *testing.T) *pgxpool.Pool {
+	t.Helper()
+
+	url := os.Getenv("DATABASE_URL")
+	if url == "" {
+		t.Skip("DATABASE_URL is not set")
+	}
+
+	pool, err := pgxpool.New(context.Background(), url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+
+	return pool
+}
+
+// testMigrator migrates a table of its own under a service name of its own,
+// so it does not touch the schema of the real services.
+func testMigrator(t *testing.T, pool *pgxpool.Pool) (*Migrator, string) {
+	t.Helper()
+
+	suffix := fmt.Sprintf("%d", time.Now().UnixNano())
+	table, service := "migrate_test_"+suffix, "migrate-test-"+suffix
+
+	migrator, err := New(pool, service, fstest.MapFS{
+		"001_create.up.sql":   file("CREATE TABLE " + table + " (id BIGINT PRIMARY KEY)"),
+		"001_create.down.sql": file("DROP TABLE " + table),
+		"002_add.up.sql":      file("ALTER TABLE " + table + " ADD COLUMN name TEXT"),
+		"002_add.down.sql":    file("ALTER TABLE " + table + " DROP COLUMN name"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		ctx := context.Background()
+		pool.Exec(ctx, "DROP TABLE IF EXISTS "+table)
+		pool.Exec(ctx, "DELETE FROM schema_migrations WHERE service = $1", service)
+	})
+
+	return migrator, table
+}
+
+func applied(t *testing.T, migrator *Migrator) []int64 {
+	t.Helper()
+
+	statuses, err := migrator.Status(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var versions []int64
+	for _, status := range statuses {
+		if !status.AppliedAt.IsZero() {
+			versions = append(versions, status.Version)
+		}
+	}
+	return versions
+}
+
+func TestUpDown(t *testing.T) {
+	pool := testPool(t)
+	migrator, table := testMigrator(t, pool)
+	ctx := context.Background()
+
+	n, err := migrator.Up(ctx)
+	if err != nil || n != 2 {
+		t.Fatalf("Up() = %d, %v, want 2 applied", n, err)
+	}
+	if _, err := pool.Exec(ctx, "INSERT INTO "+table+" (id, name) VALUES (1, 'a')"); err != nil {
+		t.Fatalf("Migrated table is not usable: %v", err)
+	}
+
+	// nothing left to apply
+	if n, err := migrator.Up(ctx); err != nil || n != 0 {
+		t.Fatalf("second Up() = %d, %v, want 0 applied", n, err)
+	}
+	if got := applied(t, migrator); len(got) != 2 {
+		t.Fatalf("applied = %v, want [1 2]", got)
+	}
+
+	if err := migrator.Down(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if got := applied(t, migrator); len(got) != 1 || got[0] != 1 {
+		t.Fatalf("applied after Down(1) = %v, want [1]", got)
+	}
+	if _, err := pool.Exec(ctx, "SELECT name FROM "+table); err == nil {
+		t.Error("column of the rolled back migration still exists")
+	}
+
+	// more steps than applied migrations rolls back everything
+	if err := migrator.Down(ctx, 5); err != nil {
+		t.Fatal(err)
+	}
+	if got := applied(t, migrator); len(got) != 0 {
+		t.Fatalf("applied after Down(5) = %v, want none", got)
+	}
+	if _, err := pool.Exec(ctx, "SELECT 1 FROM "+table); err == nil {
+		t.Error("table of the rolled back migration still exists")
+	}
+}
+
+func TestUpWaitsForLock(t *testing.T) {
+	pool := testPool(t)
+	migrator, _ := testMigrator(t, pool)
+	ctx := context.Background()
+
+	// another service in the middle of migrating
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Release()
+	if _, err := conn.Exec(ctx, "SELECT pg_advisory_lock($1)", lockKey); err != nil {
+		t.Fatal(err)
+	}
+
+	waiting, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer cancel()
+	if _, err := migrator.Up(waiting); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Up() while locked = %v, want it to wait until the deadline", err)
+	}
+	if got := applied(t, migrator); len(got) != 0 {
+		t.Fatalf("applied while locked = %v, want none", got)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := migrator.Up(ctx)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		t.Fatalf("Up() returned %v before the lock was released", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if _, err := conn.Exec(ctx, "SELECT pg_advisory_unlock($1)", lockKey); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("Up() after the lock was released = %v", err)
+	}
+	if got := applied(t, migrator); len(got) != 2 {
+		t.Errorf("applied = %v, want [1 2]", got)
+	}
+}
@@ -3,54 +3,197 @@ package main
 import (
 	"context"
 	"log"
+	"net"
 	"net/http"
 	"os"
-	"os/signal"
-	"syscall"
+	"strings"
 	"time"
 
+	"github.com/KEPTANy/plag-check/shared/audit"
+	auditMigrations "github.com/KEPTANy/plag-check/shared/audit/migrations"
+	"github.com/KEPTANy/plag-check/shared/bootstrap"
+	"github.com/KEPTANy/plag-check/shared/events"
+	eventsMigrations "github.com/KEPTANy/plag-check/shared/events/migrations"
+	"github.com/KEPTANy/plag-check/shared/health"
+	"github.com/KEPTANy/plag-check/shared/logging"
 	"github.com/KEPTANy/plag-check/shared/middleware"
+	"github.com/KEPTANy/plag-check/shared/migrate"
+	"github.com/KEPTANy/plag-check/shared/tracing"
 	"github.com/KEPTANy/plag-check/user-service/internal/config"
 	"github.com/KEPTANy/plag-check/user-service/internal/handler"
+	intMiddleware "github.com/KEPTANy/plag-check/user-service/internal/middleware"
+	"github.com/KEPTANy/plag-check/user-service/internal/notifier"
+	"github.com/KEPTANy/plag-check/user-service/internal/oidc"
 	"github.com/KEPTANy/plag-check/user-service/internal/repository"
 	"github.com/KEPTANy/plag-check/user-service/internal/service"
-	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/KEPTANy/plag-check/user-service/migrations"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 func main() {
+	logging.Setup("user-service")
+
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := bootstrap.MigrateCommand("user-service", migrations.FS, os.Args[2:]); err != nil {
+			log.Fatalf("Failed to migrate: %v", err)
+		}
+		return
+	}
+
+	shutdownTracing, err := tracing.Setup(context.Background(), "user-service")
+	if err != nil {
+		log.Fatalf("Failed to set up tracing: %v", err)
+	}
+
 	var cfg config.Config
-	err := cfg.Load()
+	err = cfg.Load()
 	if err != nil {
 		log.Fatalf("Failed to load config: %v", err)
 	}
 
-	db, err := repository.NewPgRepository(cfg.DatabaseURL)
+	app := bootstrap.New(cfg.Lifecycle)
+	app.OnShutdown(shutdownTracing)
+
+	db, err := repository.NewPgRepository(context.Background(), cfg.Database)
 	if err != nil {
 		log.Fatalf("Failed to connect to db: %v", err)
 	}
-	defer db.Close()
+	app.OnShutdown(func(context.Context) error {
+		db.Close()
+		return nil
+	})
 
-	if err := runMigrations(db.GetPool()); err != nil {
-		log.Printf("WARNING! Failed to run migrations: %v", err)
+	if err := migrate.Up(context.Background(), db.GetPool(), "user-service", migrations.FS); err != nil {
+		log.Fatalf("Failed to run migrations: %v", err)
+	}
+	if err := migrate.Up(context.Background(), db.GetPool(), "audit", auditMigrations.FS); err != nil {
+		log.Fatalf("Failed to run audit log migrations: %v", err)
+	}
+	auditLog := audit.New(db.GetPool(), "user-service")
+	if err := migrate.Up(context.Background(), db.GetPool(), "events", eventsMigrations.FS); err != nil {
+		log.Fatalf("Failed to run event outbox migrations: %v", err)
+	}
+	publisher := events.NewPublisher(db.GetPool(), "user-service")
+
+	passwordPolicy := &service.PasswordPolicy{
+		MinLength:     cfg.PasswordMinLength,
+		RequireUpper:  cfg.PasswordRequireUpper,
+		RequireLower:  cfg.PasswordRequireLower,
+		RequireDigit:  cfg.PasswordRequireDigit,
+		RequireSymbol: cfg.PasswordRequireSymbol,
+	}
+	if cfg.BreachedPasswordsFile != "" {
+		if err := passwordPolicy.LoadBreachedPasswords(cfg.BreachedPasswordsFile); err != nil {
+			log.Fatalf("Failed to load breached passwords: %v", err)
+		}
+	}
+
+	lockoutPolicy := service.LockoutPolicy{
+		MaxFailedLogins: cfg.MaxFailedLogins,
+		Duration:        cfg.LockoutDuration,
 	}
 
 	userRepo := repository.NewUserRepository(db)
-	userService := service.NewUserService(userRepo, cfg.JWTSecret, cfg.BCryptCost)
+	notificationRepo := repository.NewNotificationRepository(db)
+	userService := service.NewUserService(
+		userRepo,
+		cfg.JWTSecret,
+		cfg.BCryptCost,
+		passwordPolicy,
+		lockoutPolicy,
+		notificationRepo,
+		cfg.ResetTokenTTL,
+		auditLog,
+		db,
+		publisher,
+	)
+
+	var resetNotifier notifier.Notifier
+	switch cfg.ResetNotifier {
+	case "smtp":
+		resetNotifier = notifier.NewSMTPNotifier(notifier.SMTPConfig{
+			Addr:     cfg.SMTPAddr,
+			From:     cfg.SMTPFrom,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+		})
+	default:
+		log.Printf("Password reset tokens are written to the log, set SMTP_ADDR to send them by e-mail")
+		resetNotifier = notifier.NewDevLogNotifier()
+	}
+	app.Go("notifications", notifier.NewSender(notificationRepo, userService, resetNotifier).Run)
 
-	healthHandler := handler.NewHealthHandler()
+	healthHandler := health.NewHandler(map[string]health.Check{
+		"serving":  app.CheckReady,
+		"postgres": db.GetPool().Ping,
+	})
 	userHandler := handler.NewUserHandler(userService)
+	auditHandler := handler.NewAuditHandler(auditLog)
 
 	mux := http.NewServeMux()
 
-	mux.Handle("GET /health", http.HandlerFunc(healthHandler.Health))
+	mux.Handle("GET /health", healthHandler)
+
+	authLimiter := intMiddleware.NewIPRateLimiter(cfg.LoginRateLimit, cfg.LoginRateWindow)
+
+	mux.Handle("POST /auth/register", authLimiter.Middleware(http.HandlerFunc(userHandler.Register)))
+	mux.Handle("POST /auth/login", authLimiter.Middleware(http.HandlerFunc(userHandler.Login)))
+	mux.Handle("POST /auth/password-reset/request",
+		authLimiter.Middleware(http.HandlerFunc(userHandler.RequestPasswordReset)))
+	mux.Handle("POST /auth/password-reset/confirm",
+		authLimiter.Middleware(http.HandlerFunc(userHandler.ConfirmPasswordReset)))
+
+	if cfg.OIDCIssuerURL != "" {
+		provider, err := oidc.NewProvider(context.Background(), oidc.Config{
+			IssuerURL:     cfg.OIDCIssuerURL,
+			ClientID:      cfg.OIDCClientID,
+			ClientSecret:  cfg.OIDCClientSecret,
+			RedirectURL:   cfg.OIDCRedirectURL,
+			Scopes:        cfg.OIDCScopes,
+			UsernameClaim: cfg.OIDCUsernameClaim,
+			RoleClaim:     cfg.OIDCRoleClaim,
+			TeacherRoles:  cfg.OIDCTeacherRoles,
+		})
+		if err != nil {
+			log.Fatalf("Failed to init OIDC provider: %v", err)
+		}
+
+		oidcHandler := handler.NewOIDCHandler(
+			provider,
+			userService,
+			cfg.OIDCTokenDuration,
+			strings.HasPrefix(cfg.OIDCRedirectURL, "https://"),
+			cfg.JWTSecret,
+		)
+
+		mux.Handle("GET /auth/oidc/login", authLimiter.Middleware(http.HandlerFunc(oidcHandler.Login)))
+		mux.Handle("GET /auth/oidc/callback", authLimiter.Middleware(http.HandlerFunc(oidcHandler.Callback)))
+	}
+
+	baseChain := middleware.Chain(
+		intMiddleware.AuthMiddleware(cfg.JWTSecret, cfg.IdentitySecret),
+	)
+
+	teacherChain := middleware.Chain(
+		baseChain,
+		intMiddleware.RequireRole("teacher"),
+	)
+
+	mux.Handle("GET /users/me", baseChain(http.HandlerFunc(userHandler.GetMe)))
+	mux.Handle("PATCH /users/me", baseChain(http.HandlerFunc(userHandler.UpdateMe)))
+	mux.Handle("POST /users/me/password", baseChain(authLimiter.Middleware(http.HandlerFunc(userHandler.ChangePassword))))
 
-	mux.Handle("POST /auth/register", http.HandlerFunc(userHandler.Register))
-	mux.Handle("POST /auth/login", http.HandlerFunc(userHandler.Login))
+	mux.Handle("GET /users/{id}", teacherChain(http.HandlerFunc(userHandler.GetUser)))
+	mux.Handle("POST /users/import", teacherChain(http.HandlerFunc(userHandler.ImportRoster)))
 
 	handler := middleware.Chain(
+		middleware.RequestIDMiddleware,
+		middleware.ClientIP(cfg.TrustedProxies),
+		middleware.TracingMiddleware,
 		middleware.RecoveringMiddleware,
 		middleware.LoggingMiddleware,
-	)(mux)
+		middleware.MetricsMiddleware,
+	)(middleware.PatternMiddleware(mux))
 
 	server := &http.Server{
 		Addr:         ":" + cfg.Port,
@@ -60,59 +203,28 @@ func main() {
 		IdleTimeout:  60 * time.Second,
 	}
 
-	go func() {
-		log.Printf("User service starting on port: %v", cfg.Port)
-		if err := server.ListenAndServe(); err != nil {
-			log.Fatalf("Failed to start server: %v", err)
-		}
-	}()
-
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
-	log.Println("Shutting down server...")
-
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	if err := server.Shutdown(ctx); err != nil {
-		log.Fatal("Server forced to shutdown:", err)
+	adminMux := http.NewServeMux()
+	adminChain := intMiddleware.AdminTokenMiddleware(cfg.AdminToken)
+	adminMux.Handle("GET /admin/audit", adminChain(http.HandlerFunc(auditHandler.List)))
+	adminMux.Handle("GET /admin/audit/export", adminChain(http.HandlerFunc(auditHandler.Export)))
+	adminMux.Handle("GET /metrics", promhttp.Handler())
+
+	// no write timeout, exports are streamed
+	adminServer := &http.Server{
+		Addr: net.JoinHostPort(cfg.AdminHost, cfg.AdminPort),
+		Handler: middleware.Chain(
+			middleware.RequestIDMiddleware,
+			middleware.RecoveringMiddleware,
+			middleware.LoggingMiddleware,
+		)(adminMux),
+		ReadHeaderTimeout: 10 * time.Second,
 	}
 
-	log.Println("Server exited properly")
-}
-
-func runMigrations(pool *pgxpool.Pool) error {
-	ctx := context.Background()
+	app.Serve(server)
+	app.Serve(adminServer)
 
-	var tableExists bool
-	err := pool.QueryRow(ctx, `
-        SELECT EXISTS (
-            SELECT FROM information_schema.tables 
-            WHERE table_schema = 'public' 
-            AND table_name = 'users'
-        )
-    `).Scan(&tableExists)
-
-	if err != nil {
-		return err
+	log.Printf("User service starting on port: %v, admin API on: %v", cfg.Port, adminServer.Addr)
+	if err := app.Run(); err != nil {
+		log.Fatalf("Service stopped: %v", err)
 	}
-
-	if !tableExists {
-		log.Println("Running database migrations...")
-
-		migrationSQL, err := os.ReadFile("migrations/001_create_users_table.up.sql")
-		if err != nil {
-			return err
-		}
-
-		_, err = pool.Exec(ctx, string(migrationSQL))
-		if err != nil {
-			return err
-		}
-
-		log.Println("Database migrations completed")
-	}
-
-	return nil
 }
@@ -1,71 +1,135 @@
 package config
 
 import (
-	"errors"
 	"fmt"
-	"os"
-	"strconv"
+	"net/netip"
+	"time"
+
+	"github.com/KEPTANy/plag-check/shared/bootstrap"
+	"golang.org/x/crypto/bcrypt"
 )
 
 type Config struct {
-	Port        string
-	DatabaseURL string
-	JWTSecret   string
-	BCryptCost  int
-}
+	Port       string
+	AdminHost  string
+	AdminPort  string
+	Database   bootstrap.Database
+	Lifecycle  bootstrap.Lifecycle
+	JWTSecret  string
+	BCryptCost int
 
-func getDatabaseURL() (string, error) {
-	host, ok := os.LookupEnv("DB_HOST")
-	if !ok {
-		return "", errors.New("Failed to load DB_HOST variable")
-	}
+	// AdminToken is the bearer token of the audit log admin API
+	AdminToken string
 
-	port, ok := os.LookupEnv("DB_PORT")
-	if !ok {
-		return "", errors.New("Failed to load DB_PORT variable")
-	}
+	// IdentitySecret verifies the identity header signed by the gateway
+	IdentitySecret string
 
-	user, ok := os.LookupEnv("DB_USER")
-	if !ok {
-		return "", errors.New("Failed to load DB_USER variable")
-	}
+	PasswordMinLength     int
+	PasswordRequireUpper  bool
+	PasswordRequireLower  bool
+	PasswordRequireDigit  bool
+	PasswordRequireSymbol bool
+	BreachedPasswordsFile string
 
-	password, ok := os.LookupEnv("DB_PASSWORD")
-	if !ok {
-		return "", errors.New("Failed to load DB_PASSWORD variable")
-	}
+	MaxFailedLogins int
+	LockoutDuration time.Duration
 
-	name, ok := os.LookupEnv("DB_NAME")
-	if !ok {
-		return "", errors.New("Failed to load DB_NAME variable")
-	}
+	LoginRateLimit  int
+	LoginRateWindow time.Duration
+
+	// ResetNotifier is "smtp", or "dev-log" which writes reset tokens to
+	// the log and is meant for local development only. It defaults to
+	// "smtp" when SMTPAddr is set and to "dev-log" otherwise
+	ResetNotifier string
+	ResetTokenTTL time.Duration
+	// mail server of the smtp notifier
+	SMTPAddr     string
+	SMTPFrom     string
+	SMTPUsername string
+	SMTPPassword string
 
-	return fmt.Sprintf("postgresql://%s:%s@%s:%s/%s", user, password, host, port, name), nil
+	// OIDC login is enabled only when OIDCIssuerURL is set
+	OIDCIssuerURL     string
+	OIDCClientID      string
+	OIDCClientSecret  string
+	OIDCRedirectURL   string
+	OIDCScopes        []string
+	OIDCUsernameClaim string
+	OIDCRoleClaim     string
+	OIDCTeacherRoles  []string
+	OIDCTokenDuration time.Duration
+
+	// TrustedProxies may set X-Forwarded-For, see middleware.ClientIP
+	TrustedProxies []netip.Prefix
 }
 
 func (c *Config) Load() error {
-	var ok bool
+	var env bootstrap.Env
 
-	c.Port, ok = os.LookupEnv("PORT")
-	if !ok {
-		return errors.New("Failed to load PORT variable")
-	}
+	c.Port = env.Required("PORT")
+	// the admin API listens on localhost unless told otherwise, metrics on
+	// it are not behind authentication
+	c.AdminHost = env.String("ADMIN_HOST", "127.0.0.1")
+	c.AdminPort = env.String("ADMIN_PORT", "9091")
+	c.AdminToken = env.Required("ADMIN_TOKEN")
+	c.Database = bootstrap.LoadDatabase(&env)
+	c.Lifecycle = bootstrap.LoadLifecycle(&env)
+
+	// the gateway, whose X-Forwarded-For names the client
+	c.TrustedProxies = env.Networks("TRUSTED_PROXIES", nil)
+
+	c.JWTSecret = env.Required("JWT_SECRET")
+	c.IdentitySecret = env.String("INTERNAL_IDENTITY_SECRET", "")
 
-	var err error
-	c.DatabaseURL, err = getDatabaseURL()
-	if err != nil {
-		return err
+	c.BCryptCost = env.Int("BCRYPT_COST", bcrypt.DefaultCost)
+	if c.BCryptCost < bcrypt.MinCost || c.BCryptCost > bcrypt.MaxCost {
+		env.Fail("BCRYPT_COST", fmt.Sprintf("must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost))
 	}
 
-	c.JWTSecret, ok = os.LookupEnv("JWT_SECRET")
-	if !ok {
-		return errors.New("Failed to load JWT_SECRET variable")
+	c.PasswordMinLength = env.Int("PASSWORD_MIN_LENGTH", 8)
+	c.PasswordRequireUpper = env.Bool("PASSWORD_REQUIRE_UPPER", false)
+	c.PasswordRequireLower = env.Bool("PASSWORD_REQUIRE_LOWER", false)
+	c.PasswordRequireDigit = env.Bool("PASSWORD_REQUIRE_DIGIT", false)
+	c.PasswordRequireSymbol = env.Bool("PASSWORD_REQUIRE_SYMBOL", false)
+	c.BreachedPasswordsFile = env.String("BREACHED_PASSWORDS_FILE", "")
+
+	c.MaxFailedLogins = env.Int("MAX_FAILED_LOGINS", 5)
+	c.LockoutDuration = env.Duration("LOCKOUT_DURATION", 15*time.Minute)
+
+	c.LoginRateLimit = env.Int("LOGIN_RATE_LIMIT", 20)
+	c.LoginRateWindow = env.Duration("LOGIN_RATE_WINDOW", time.Minute)
+
+	// a reset request must always end up somewhere, without a mail server
+	// the messages are written to the log
+	c.SMTPAddr = env.String("SMTP_ADDR", "")
+	c.ResetNotifier = "dev-log"
+	if c.SMTPAddr != "" {
+		c.ResetNotifier = "smtp"
+	}
+	c.ResetNotifier = env.String("RESET_NOTIFIER", c.ResetNotifier)
+	c.ResetTokenTTL = env.Duration("RESET_TOKEN_TTL", 30*time.Minute)
+	switch c.ResetNotifier {
+	case "smtp":
+		c.SMTPAddr = env.Required("SMTP_ADDR")
+		c.SMTPFrom = env.Required("SMTP_FROM")
+		c.SMTPUsername = env.String("SMTP_USERNAME", "")
+		c.SMTPPassword = env.String("SMTP_PASSWORD", "")
+	case "dev-log":
+	default:
+		env.Fail("RESET_NOTIFIER", `must be "smtp" or "dev-log"`)
 	}
 
-	c.BCryptCost, err = strconv.Atoi(os.Getenv("BCRYPT_COST"))
-	if err != nil {
-		return errors.New("Failed to load BCRYPT_COST variable")
+	c.OIDCIssuerURL = env.String("OIDC_ISSUER_URL", "")
+	if c.OIDCIssuerURL != "" {
+		c.OIDCClientID = env.Required("OIDC_CLIENT_ID")
+		c.OIDCRedirectURL = env.Required("OIDC_REDIRECT_URL")
+		c.OIDCClientSecret = env.String("OIDC_CLIENT_SECRET", "")
+		c.OIDCScopes = env.List("OIDC_SCOPES", []string{"openid", "profile", "email"})
+		c.OIDCUsernameClaim = env.String("OIDC_USERNAME_CLAIM", "preferred_username")
+		c.OIDCRoleClaim = env.String("OIDC_ROLE_CLAIM", "roles")
+		c.OIDCTeacherRoles = env.List("OIDC_TEACHER_ROLES", []string{"teacher"})
+		c.OIDCTokenDuration = env.Duration("OIDC_TOKEN_DURATION", time.Hour)
 	}
 
-	return nil
+	return env.Err()
 }
@@ -0,0 +1,194 @@
+package handler
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/KEPTANy/plag-check/shared/apperror"
+	"github.com/KEPTANy/plag-check/shared/audit"
+	sharedMiddleware "github.com/KEPTANy/plag-check/shared/middleware"
+	"github.com/gofrs/uuid/v5"
+)
+
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+var auditCSVHeader = []string{
+	"id", "occurred_at", "service", "actor_id", "actor_role", "action",
+	"resource_type", "resource_id", "outcome", "ip", "request_id", "details",
+}
+
+// AuditLog is the part of audit.Log the handler reads.
+type AuditLog interface {
+	Find(ctx context.Context, f audit.Filter) ([]audit.Entry, error)
+	Each(ctx context.Context, f audit.Filter, fn func(entry *audit.Entry) error) error
+}
+
+// AuditHandler serves the audit log on the admin port.
+type AuditHandler struct {
+	Log AuditLog
+}
+
+func NewAuditHandler(log AuditLog) *AuditHandler {
+	return &AuditHandler{Log: log}
+}
+
+// parseAuditFilter reads the filter from the query string. Times are RFC 3339,
+// "to" is exclusive.
+func parseAuditFilter(r *http.Request) (audit.Filter, error) {
+	q := r.URL.Query()
+
+	f := audit.Filter{
+		Action:       q.Get("action"),
+		ResourceType: q.Get("resource_type"),
+		ResourceID:   q.Get("resource_id"),
+		Service:      q.Get("service"),
+		Outcome:      q.Get("outcome"),
+		IP:           q.Get("ip"),
+		RequestID:    q.Get("request_id"),
+	}
+
+	var err error
+	if value := q.Get("actor_id"); value != "" {
+		if f.ActorID, err = uuid.FromString(value); err != nil {
+			return f, apperror.Validation("invalid actor_id")
+		}
+	}
+	if value := q.Get("from"); value != "" {
+		if f.From, err = time.Parse(time.RFC3339, value); err != nil {
+			return f, apperror.Validation("from must be an RFC 3339 time")
+		}
+	}
+	if value := q.Get("to"); value != "" {
+		if f.To, err = time.Parse(time.RFC3339, value); err != nil {
+			return f, apperror.Validation("to must be an RFC 3339 time")
+		}
+	}
+	if value := q.Get("before_id"); value != "" {
+		if f.BeforeID, err = strconv.ParseInt(value, 10, 64); err != nil || f.BeforeID <= 0 {
+			return f, apperror.Validation("before_id must be a positive number")
+		}
+	}
+
+	return f, nil
+}
+
+// List returns a page of matching entries, newest first. next_before_id
+// continues the listing and is absent on the last page.
+func (h *AuditHandler) List(w http.ResponseWriter, r *http.Request) {
+	f, err := parseAuditFilter(r)
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	f.Limit = defaultAuditLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		f.Limit, err = strconv.Atoi(value)
+		if err != nil || f.Limit <= 0 || f.Limit > maxAuditLimit {
+			apperror.Write(w, r, apperror.Validation("limit must be in a range of 1 to 1000"))
+			return
+		}
+	}
+
+	entries, err := h.Log.Find(r.Context(), f)
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	resp := map[string]any{
+		"entries": entries,
+	}
+	if len(entries) == f.Limit {
+		resp["next_before_id"] = entries[len(entries)-1].ID
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// Export streams every matching entry as CSV, newest first.
+func (h *AuditHandler) Export(w http.ResponseWriter, r *http.Request) {
+	f, err := parseAuditFilter(r)
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="audit-log.csv"`)
+
+	out := csv.NewWriter(w)
+	out.Write(auditCSVHeader)
+
+	rows := 0
+	err = h.Log.Each(r.Context(), f, func(entry *audit.Entry) error {
+		rows++
+
+		actorID := ""
+		if entry.ActorID != nil {
+			actorID = entry.ActorID.String()
+		}
+
+		details := ""
+		if entry.Details != nil {
+			data, err := json.Marshal(entry.Details)
+			if err != nil {
+				return err
+			}
+			details = string(data)
+		}
+
+		return out.Write(csvRow(
+			strconv.FormatInt(entry.ID, 10), entry.OccurredAt.UTC().Format(time.RFC3339), entry.Service,
+			actorID, entry.ActorRole, entry.Action, entry.ResourceType, entry.ResourceID,
+			entry.Outcome, entry.IP, entry.RequestID, details,
+		))
+	})
+	if err != nil && rows == 0 {
+		// nothing is sent yet, the CSV header is still buffered
+		w.Header().Del("Content-Disposition")
+		apperror.Write(w, r, err)
+		return
+	}
+	if err != nil {
+		// the status is already sent, a last row tells the reader that the
+		// file is incomplete
+		slog.ErrorContext(r.Context(), "Failed to export audit log", "error", err)
+		out.Write(exportErrorRow(sharedMiddleware.GetRequestID(r.Context())))
+	}
+
+	out.Flush()
+}
+
+// exportErrorRow ends an export that failed halfway. Its id is not a number,
+// so a reader that parses the file fails on it instead of taking the file for
+// complete.
+func exportErrorRow(requestID string) []string {
+	row := make([]string, len(auditCSVHeader))
+	row[0] = "error"
+	row[1] = "export is incomplete, see the service log"
+	row[slices.Index(auditCSVHeader, "request_id")] = requestID
+	return row
+}
+
+// csvRow neutralizes cells a spreadsheet would run as a formula. Resource
+// IDs, usernames in details and the like come from users, a leading quote
+// makes the spreadsheet show them as text.
+func csvRow(cells ...string) []string {
+	for i, cell := range cells {
+		if cell != "" && strings.ContainsRune("=+-@\t\r", rune(cell[0])) {
+			cells[i] = "'" + cell
+		}
+	}
+	return cells
+}
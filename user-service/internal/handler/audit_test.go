@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/KEPTANy/plag-check/shared/audit"
+)
+
+func TestCSVRow(t *testing.T) {
+	got := csvRow("42", "=HYPERLINK(\"http://x\")", "+1", "-1", "@SUM(A1)", "\tx", "\rx", "", "a=b", `{"username":"=cmd"}`)
+	want := []string{"42", "'=HYPERLINK(\"http://x\")", "'+1", "'-1", "'@SUM(A1)", "'\tx", "'\rx", "", "a=b", `{"username":"=cmd"}`}
+
+	if !slices.Equal(got, want) {
+		t.Errorf("csvRow() = %q, want %q", got, want)
+	}
+}
+
+// failingLog yields its entries and then fails, like a connection lost in the
+// middle of an export.
+type failingLog struct {
+	AuditLog
+	entries []audit.Entry
+}
+
+func (l *failingLog) Each(ctx context.Context, f audit.Filter, fn func(entry *audit.Entry) error) error {
+	for i := range l.entries {
+		if err := fn(&l.entries[i]); err != nil {
+			return err
+		}
+	}
+	return errors.New("connection lost")
+}
+
+func TestExportFailure(t *testing.T) {
+	tests := []struct {
+		name       string
+		entries    []audit.Entry
+		wantStatus int
+		wantRows   int
+	}{
+		{"before any row", nil, http.StatusInternalServerError, 0},
+		{"after some rows", []audit.Entry{{ID: 1, Action: "login"}, {ID: 2, Action: "login"}}, http.StatusOK, 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewAuditHandler(&failingLog{entries: tt.entries})
+			rec := httptest.NewRecorder()
+			h.Export(rec, httptest.NewRequest(http.MethodGet, "/admin/audit/export", nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantRows == 0 {
+				return
+			}
+
+			rows, err := csv.NewReader(rec.Body).ReadAll()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rows) != tt.wantRows {
+				t.Fatalf("got %d rows, want %d", len(rows), tt.wantRows)
+			}
+			if last := rows[len(rows)-1]; last[0] != "error" {
+				t.Errorf("last row = %q, want an error row", last)
+			}
+		})
+	}
+}
@@ -1,15 +0,0 @@
-package handler
-
-import "net/http"
-
-type HealthHandler struct{}
-
-func NewHealthHandler() *HealthHandler {
-	return &HealthHandler{}
-}
-
-func (h *HealthHandler) Health(w http.ResponseWriter, r *http.Request) {
-	writeJSON(w, http.StatusOK, map[string]any{
-		"status": "OK",
-	})
-}
@@ -0,0 +1,196 @@
+package handler
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/KEPTANy/plag-check/shared/apperror"
+	"github.com/KEPTANy/plag-check/user-service/internal/oidc"
+	"github.com/KEPTANy/plag-check/user-service/internal/service"
+	"golang.org/x/oauth2"
+)
+
+const (
+	oidcStateCookie = "oidc_state"
+	oidcStateTTL    = 10 * time.Minute
+)
+
+// oidcState is kept in a signed cookie between the redirect to the provider
+// and the callback, so any instance of the service can finish the flow.
+type oidcState struct {
+	State     string `json:"state"`
+	Nonce     string `json:"nonce"`
+	Verifier  string `json:"verifier"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+type OIDCHandler struct {
+	Provider      *oidc.Provider
+	UserService   service.UserService
+	TokenDuration time.Duration
+	SecureCookie  bool
+	cookieSecret  []byte
+}
+
+func NewOIDCHandler(
+	provider *oidc.Provider,
+	service service.UserService,
+	tokenDuration time.Duration,
+	secureCookie bool,
+	cookieSecret string,
+) *OIDCHandler {
+	return &OIDCHandler{
+		Provider:      provider,
+		UserService:   service,
+		TokenDuration: tokenDuration,
+		SecureCookie:  secureCookie,
+		cookieSecret:  []byte(cookieSecret),
+	}
+}
+
+func (h *OIDCHandler) Login(w http.ResponseWriter, r *http.Request) {
+	stateValue, err := randomString()
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+	nonce, err := randomString()
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	state := oidcState{
+		State:     stateValue,
+		Nonce:     nonce,
+		Verifier:  oauth2.GenerateVerifier(),
+		ExpiresAt: time.Now().Add(oidcStateTTL).Unix(),
+	}
+
+	value, err := h.signState(&state)
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    value,
+		Path:     "/auth/oidc/",
+		MaxAge:   int(oidcStateTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   h.SecureCookie,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	http.Redirect(w, r, h.Provider.AuthCodeURL(state.State, state.Nonce, state.Verifier), http.StatusFound)
+}
+
+func (h *OIDCHandler) Callback(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Path:     "/auth/oidc/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   h.SecureCookie,
+	})
+
+	if errParam := r.URL.Query().Get("error"); errParam != "" {
+		apperror.Write(w, r, apperror.Unauthorized("identity provider rejected the login").WithDetails(errParam))
+		return
+	}
+
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil {
+		apperror.Write(w, r, apperror.Validation("login session not found, start again"))
+		return
+	}
+
+	state, err := h.verifyState(cookie.Value)
+	if err != nil || state.State != r.URL.Query().Get("state") {
+		apperror.Write(w, r, apperror.Validation("invalid or expired login session, start again"))
+		return
+	}
+
+	code := r.URL.Query().Get("code")
+	if code == "" {
+		apperror.Write(w, r, apperror.Validation("authorization code is missing"))
+		return
+	}
+
+	identity, err := h.Provider.Exchange(r.Context(), code, state.Nonce, state.Verifier)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to complete OIDC login", "error", err)
+		apperror.Write(w, r, apperror.Unauthorized("failed to verify identity"))
+		return
+	}
+
+	response, err := h.UserService.OIDCLogin(r.Context(), identity, h.TokenDuration)
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (h *OIDCHandler) signState(state *oidcState) (string, error) {
+	payload, err := json.Marshal(state)
+	if err != nil {
+		return "", err
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(h.mac(encoded)), nil
+}
+
+func (h *OIDCHandler) verifyState(value string) (*oidcState, error) {
+	encoded, signature, ok := strings.Cut(value, ".")
+	if !ok {
+		return nil, errors.New("Malformed state cookie")
+	}
+
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(mac, h.mac(encoded)) {
+		return nil, errors.New("Invalid state cookie signature")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	var state oidcState
+	if err := json.Unmarshal(payload, &state); err != nil {
+		return nil, err
+	}
+
+	if time.Now().Unix() > state.ExpiresAt {
+		return nil, errors.New("State cookie expired")
+	}
+
+	return &state, nil
+}
+
+func (h *OIDCHandler) mac(data string) []byte {
+	m := hmac.New(sha256.New, h.cookieSecret)
+	m.Write([]byte("oidc-state:" + data))
+	return m.Sum(nil)
+}
+
+func randomString() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("Failed to generate random string: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,233 @@
+package handler
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KEPTANy/plag-check/user-service/internal/model"
+	"github.com/KEPTANy/plag-check/user-service/internal/oidc"
+	"github.com/KEPTANy/plag-check/user-service/internal/oidc/oidctest"
+	"github.com/KEPTANy/plag-check/user-service/internal/service"
+)
+
+// oidcUserService records the identities it logs in, other methods of
+// service.UserService are not used by OIDCHandler.
+type oidcUserService struct {
+	service.UserService
+	identities []*oidc.Identity
+}
+
+func (s *oidcUserService) OIDCLogin(ctx context.Context, identity *oidc.Identity, duration time.Duration) (*model.LoginResponse, error) {
+	s.identities = append(s.identities, identity)
+	return &model.LoginResponse{Token: "token-of-" + identity.Subject}, nil
+}
+
+type oidcFlow struct {
+	server  *oidctest.Server
+	handler *OIDCHandler
+	users   *oidcUserService
+}
+
+func newOIDCFlow(t *testing.T) *oidcFlow {
+	t.Helper()
+
+	server, err := oidctest.NewServer("plag-check")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(server.Close)
+
+	provider, err := oidc.NewProvider(context.Background(), oidc.Config{
+		IssuerURL:     server.URL,
+		ClientID:      "plag-check",
+		RedirectURL:   "http://localhost/auth/oidc/callback",
+		UsernameClaim: "preferred_username",
+		RoleClaim:     "roles",
+		TeacherRoles:  []string{"teacher"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	users := &oidcUserService{}
+	return &oidcFlow{
+		server:  server,
+		handler: NewOIDCHandler(provider, users, time.Hour, false, "cookie-secret"),
+		users:   users,
+	}
+}
+
+// login runs the login handler and returns the state cookie and the URL the
+// user is redirected to.
+func (f *oidcFlow) login(t *testing.T) (*http.Cookie, string) {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	f.handler.Login(rec, httptest.NewRequest(http.MethodGet, "/auth/oidc/login", nil))
+
+	if rec.Code != http.StatusFound {
+		t.Fatalf("Login status = %d, want %d", rec.Code, http.StatusFound)
+	}
+
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != oidcStateCookie {
+		t.Fatalf("Login cookies = %v, want %s", cookies, oidcStateCookie)
+	}
+	if !cookies[0].HttpOnly {
+		t.Error("state cookie is not HttpOnly")
+	}
+
+	return cookies[0], rec.Header().Get("Location")
+}
+
+func (f *oidcFlow) callback(cookie *http.Cookie, query url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/auth/oidc/callback?"+query.Encode(), nil)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+
+	rec := httptest.NewRecorder()
+	f.handler.Callback(rec, req)
+	return rec
+}
+
+func TestOIDCCallback(t *testing.T) {
+	f := newOIDCFlow(t)
+
+	cookie, location := f.login(t)
+	code, state, err := f.server.Authorize(location, map[string]any{
+		"sub":                "t-1",
+		"preferred_username": "ivanov",
+		"roles":              []string{"teacher"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := f.callback(cookie, url.Values{"code": {code}, "state": {state}})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Callback status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+
+	var resp model.LoginResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Token != "token-of-t-1" {
+		t.Errorf("token = %q, want token-of-t-1", resp.Token)
+	}
+
+	if len(f.users.identities) != 1 {
+		t.Fatalf("OIDCLogin called %d times, want 1", len(f.users.identities))
+	}
+	if got := f.users.identities[0]; got.Username != "ivanov" || got.Role != "teacher" {
+		t.Errorf("identity = %+v, want ivanov as teacher", got)
+	}
+
+	// the state cookie is one-shot
+	cleared := rec.Result().Cookies()
+	if len(cleared) != 1 || cleared[0].Name != oidcStateCookie || cleared[0].MaxAge >= 0 {
+		t.Errorf("Callback cookies = %v, want %s cleared", cleared, oidcStateCookie)
+	}
+}
+
+func TestOIDCCallbackRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		// claims of the ID token issued by the provider
+		claims map[string]any
+		// modify breaks the cookie or the query of a valid callback
+		modify     func(cookie *http.Cookie, query url.Values)
+		noCookie   bool
+		wantStatus int
+	}{
+		{
+			name: "tampered state cookie",
+			modify: func(cookie *http.Cookie, query url.Values) {
+				payload, signature, _ := strings.Cut(cookie.Value, ".")
+				var state oidcState
+				raw, _ := base64.RawURLEncoding.DecodeString(payload)
+				json.Unmarshal(raw, &state)
+				state.Nonce = "forged"
+				raw, _ = json.Marshal(state)
+				cookie.Value = base64.RawURLEncoding.EncodeToString(raw) + "." + signature
+			},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "state cookie signed with another secret",
+			modify: func(cookie *http.Cookie, query url.Values) {
+				other := &OIDCHandler{cookieSecret: []byte("other-secret")}
+				payload, _, _ := strings.Cut(cookie.Value, ".")
+				cookie.Value = payload + "." + base64.RawURLEncoding.EncodeToString(other.mac(payload))
+			},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "state does not match the cookie",
+			modify: func(cookie *http.Cookie, query url.Values) {
+				query.Set("state", "another-state")
+			},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "missing state cookie",
+			noCookie:   true,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "nonce mismatch",
+			claims:     map[string]any{"nonce": "replayed-token-nonce"},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "unknown code",
+			modify: func(cookie *http.Cookie, query url.Values) {
+				query.Set("code", "unknown")
+			},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "provider error",
+			modify: func(cookie *http.Cookie, query url.Values) {
+				query.Set("error", "access_denied")
+			},
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newOIDCFlow(t)
+
+			cookie, location := f.login(t)
+			code, state, err := f.server.Authorize(location, tt.claims)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			query := url.Values{"code": {code}, "state": {state}}
+			if tt.modify != nil {
+				tt.modify(cookie, query)
+			}
+			if tt.noCookie {
+				cookie = nil
+			}
+
+			rec := f.callback(cookie, query)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("Callback status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if len(f.users.identities) != 0 {
+				t.Errorf("OIDCLogin called for a rejected callback")
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/KEPTANy/plag-check/shared/apperror"
+	"github.com/KEPTANy/plag-check/user-service/internal/model"
+	"github.com/KEPTANy/plag-check/user-service/internal/service"
+)
+
+func (h *UserHandler) RequestPasswordReset(w http.ResponseWriter, r *http.Request) {
+	var req model.PasswordResetRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apperror.Write(w, r, apperror.Validation("invalid request body"))
+		return
+	}
+
+	if req.Username == "" && req.Email == "" {
+		apperror.Write(w, r, apperror.Validation("username or email must not be empty"))
+		return
+	}
+
+	if err := h.UserService.RequestPasswordReset(r.Context(), &req); err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, map[string]any{
+		"status": "if the account exists, a reset token has been sent",
+	})
+}
+
+func (h *UserHandler) ConfirmPasswordReset(w http.ResponseWriter, r *http.Request) {
+	var req model.PasswordResetConfirmRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apperror.Write(w, r, apperror.Validation("invalid request body"))
+		return
+	}
+
+	if req.Token == "" || req.NewPassword == "" {
+		apperror.Write(w, r, apperror.Validation("token and new password must not be empty"))
+		return
+	}
+
+	err := h.UserService.ConfirmPasswordReset(r.Context(), &req)
+	var policyErr *service.PasswordPolicyError
+	switch {
+	case errors.As(err, &policyErr):
+		apperror.Write(w, r, apperror.Validation("password does not meet policy").WithDetails(policyErr.Violations))
+		return
+	case err != nil:
+		apperror.Write(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,118 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/KEPTANy/plag-check/shared/apperror"
+	"github.com/KEPTANy/plag-check/user-service/internal/middleware"
+	"github.com/KEPTANy/plag-check/user-service/internal/model"
+	"github.com/KEPTANy/plag-check/user-service/internal/service"
+	"github.com/gofrs/uuid/v5"
+)
+
+func (h *UserHandler) GetMe(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		apperror.Write(w, r, apperror.Unauthorized("unauthorized"))
+		return
+	}
+
+	h.writeUser(w, r, userID)
+}
+
+func (h *UserHandler) GetUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := uuid.FromString(r.PathValue("id"))
+	if err != nil {
+		apperror.Write(w, r, apperror.Validation("bad user id"))
+		return
+	}
+
+	h.writeUser(w, r, userID)
+}
+
+func (h *UserHandler) writeUser(w http.ResponseWriter, r *http.Request, userID uuid.UUID) {
+	user, err := h.UserService.GetUser(r.Context(), userID)
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, user)
+}
+
+func (h *UserHandler) UpdateMe(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		apperror.Write(w, r, apperror.Unauthorized("unauthorized"))
+		return
+	}
+
+	var req model.UpdateProfileRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apperror.Write(w, r, apperror.Validation("invalid request body"))
+		return
+	}
+
+	if req.DisplayName != nil {
+		*req.DisplayName = strings.TrimSpace(*req.DisplayName)
+		if len(*req.DisplayName) > 255 {
+			apperror.Write(w, r, apperror.Validation("display name is too long"))
+			return
+		}
+	}
+
+	if req.Email != nil {
+		*req.Email = strings.TrimSpace(*req.Email)
+		if *req.Email != "" && !model.IsValidEmail(*req.Email) {
+			apperror.Write(w, r, apperror.Validation("invalid email"))
+			return
+		}
+	}
+
+	user, err := h.UserService.UpdateProfile(r.Context(), userID, &req)
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, user)
+}
+
+func (h *UserHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		apperror.Write(w, r, apperror.Unauthorized("unauthorized"))
+		return
+	}
+
+	var req model.ChangePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apperror.Write(w, r, apperror.Validation("invalid request body"))
+		return
+	}
+
+	if req.CurrentPassword == "" || req.NewPassword == "" {
+		apperror.Write(w, r, apperror.Validation("current and new password must not be empty"))
+		return
+	}
+
+	err := h.UserService.ChangePassword(r.Context(), userID, &req)
+	var policyErr *service.PasswordPolicyError
+	var lockedErr *service.AccountLockedError
+	switch {
+	case errors.As(err, &lockedErr):
+		writeAccountLocked(w, r, lockedErr)
+		return
+	case errors.As(err, &policyErr):
+		apperror.Write(w, r, apperror.Validation("password does not meet policy").WithDetails(policyErr.Violations))
+		return
+	case err != nil:
+		apperror.Write(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
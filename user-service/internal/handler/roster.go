@@ -0,0 +1,122 @@
+package handler
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/KEPTANy/plag-check/shared/apperror"
+	"github.com/KEPTANy/plag-check/user-service/internal/model"
+)
+
+const (
+	maxRosterSize = 1 << 20
+	maxRosterRows = 1000
+)
+
+// ImportRoster accepts a CSV either as a multipart "file" field or as a raw
+// text/csv body. The first line must be a header with a "username" column and
+// optional "name" (or "display_name") and "email" columns.
+func (h *UserHandler) ImportRoster(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxRosterSize)
+
+	var body io.Reader = r.Body
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "multipart/form-data" {
+		if err := r.ParseMultipartForm(maxRosterSize); err != nil {
+			apperror.Write(w, r, apperror.Validation("failed to parse form"))
+			return
+		}
+
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			apperror.Write(w, r, apperror.Validation("file is required"))
+			return
+		}
+		defer file.Close()
+		body = file
+	}
+
+	entries, err := parseRoster(body)
+	if err != nil {
+		apperror.Write(w, r, apperror.Validation(err.Error()))
+		return
+	}
+
+	response, err := h.UserService.ImportRoster(r.Context(), entries)
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+func parseRoster(body io.Reader) ([]model.RosterEntry, error) {
+	reader := csv.NewReader(body)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, errors.New("csv file is empty")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid csv: %v", err)
+	}
+
+	columns := map[string]int{"username": -1, "name": -1, "email": -1}
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		if name == "display_name" {
+			name = "name"
+		}
+		if _, ok := columns[name]; ok {
+			columns[name] = i
+		}
+	}
+
+	if columns["username"] < 0 {
+		return nil, errors.New("csv header must contain a username column")
+	}
+
+	field := func(record []string, column string) string {
+		i := columns[column]
+		if i < 0 || i >= len(record) {
+			return ""
+		}
+		return record[i]
+	}
+
+	var entries []model.RosterEntry
+	for row := 2; ; row++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid csv: %v", err)
+		}
+
+		if len(entries) == maxRosterRows {
+			return nil, fmt.Errorf("csv file must not contain more than %d rows", maxRosterRows)
+		}
+
+		entries = append(entries, model.RosterEntry{
+			Row:         row,
+			Username:    field(record, "username"),
+			DisplayName: field(record, "name"),
+			Email:       field(record, "email"),
+		})
+	}
+
+	if len(entries) == 0 {
+		return nil, errors.New("csv file has no rows")
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/KEPTANy/plag-check/user-service/internal/model"
+)
+
+func TestParseRoster(t *testing.T) {
+	tests := []struct {
+		name    string
+		csv     string
+		want    []model.RosterEntry
+		wantErr string
+	}{
+		{
+			name: "all columns",
+			csv:  "\ufeffEmail, Display_Name, Username\nalice@example.com, Alice, alice\n,,bob\n",
+			want: []model.RosterEntry{
+				{Row: 2, Username: "alice", DisplayName: "Alice", Email: "alice@example.com"},
+				{Row: 3, Username: "bob"},
+			},
+		},
+		{
+			name: "short rows",
+			csv:  "username,name,email\ncarol\n",
+			want: []model.RosterEntry{{Row: 2, Username: "carol"}},
+		},
+		{name: "empty", csv: "", wantErr: "csv file is empty"},
+		{name: "no username", csv: "name,email\nAlice,alice@example.com\n", wantErr: "username column"},
+		{name: "header only", csv: "username\n", wantErr: "no rows"},
+		{name: "broken quotes", csv: "username\n\"alice\n", wantErr: "invalid csv"},
+		{name: "too many rows", csv: "username\n" + strings.Repeat("x\n", maxRosterRows+1), wantErr: "more than"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := parseRoster(strings.NewReader(tt.csv))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want it to mention %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(entries, tt.want) {
+				t.Errorf("entries = %+v, want %+v", entries, tt.want)
+			}
+		})
+	}
+}
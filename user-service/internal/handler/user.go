@@ -2,9 +2,13 @@ package handler
 
 import (
 	"encoding/json"
-	"log"
+	"errors"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
+	"github.com/KEPTANy/plag-check/shared/apperror"
 	"github.com/KEPTANy/plag-check/user-service/internal/model"
 	"github.com/KEPTANy/plag-check/user-service/internal/service"
 )
@@ -21,38 +25,33 @@ func (h *UserHandler) Register(w http.ResponseWriter, r *http.Request) {
 	var req model.RegisterRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeJSON(w, http.StatusBadRequest, map[string]any{
-			"error": "invalid request body",
-		})
+		apperror.Write(w, r, apperror.Validation("invalid request body"))
 		return
 	}
 
 	if req.Username == "" {
-		writeJSON(w, http.StatusBadRequest, map[string]any{
-			"error": "username must not be empty",
-		})
+		apperror.Write(w, r, apperror.Validation("username must not be empty"))
 		return
 	}
 
 	if req.Password == "" {
-		writeJSON(w, http.StatusBadRequest, map[string]any{
-			"error": "password must not be empty",
-		})
+		apperror.Write(w, r, apperror.Validation("password must not be empty"))
 		return
 	}
 
 	if !model.IsValidRole(req.Role) {
-		writeJSON(w, http.StatusBadRequest, map[string]any{
-			"error": "invalid role",
-		})
+		apperror.Write(w, r, apperror.Validation("invalid role"))
 		return
 	}
 
 	err := h.UserService.Register(r.Context(), &req)
+	var policyErr *service.PasswordPolicyError
+	if errors.As(err, &policyErr) {
+		apperror.Write(w, r, apperror.Validation("password does not meet policy").WithDetails(policyErr.Violations))
+		return
+	}
 	if err != nil {
-		writeJSON(w, http.StatusBadRequest, map[string]any{
-			"error": "failed to register a user, try another username",
-		})
+		apperror.Write(w, r, err)
 		return
 	}
 
@@ -63,41 +62,43 @@ func (h *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
 	var req model.LoginRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeJSON(w, http.StatusBadRequest, map[string]any{
-			"error": "invalid request body",
-		})
+		apperror.Write(w, r, apperror.Validation("invalid request body"))
 		return
 	}
 
 	if req.Username == "" {
-		writeJSON(w, http.StatusBadRequest, map[string]any{
-			"error": "username must not be empty",
-		})
+		apperror.Write(w, r, apperror.Validation("username must not be empty"))
 		return
 	}
 
 	if req.Password == "" {
-		writeJSON(w, http.StatusBadRequest, map[string]any{
-			"error": "password must not be empty",
-		})
+		apperror.Write(w, r, apperror.Validation("password must not be empty"))
 		return
 	}
 
 	if req.DurationMin <= 0 || req.DurationMin > 24*60 {
-		writeJSON(w, http.StatusBadRequest, map[string]any{
-			"error": "duration must be in a range of 1 to 1440 minutes",
-		})
+		apperror.Write(w, r, apperror.Validation("duration must be in a range of 1 to 1440 minutes"))
 		return
 	}
 
 	user, err := h.UserService.Login(r.Context(), &req)
-	if err != nil {
-		writeJSON(w, http.StatusBadRequest, map[string]any{
-			"error": "failed to log in",
-		})
-		log.Printf("Failed to log in: %v", err)
+	var lockedErr *service.AccountLockedError
+	switch {
+	case errors.As(err, &lockedErr):
+		writeAccountLocked(w, r, lockedErr)
+		return
+	case err != nil:
+		apperror.Write(w, r, err)
 		return
 	}
 
 	writeJSON(w, http.StatusOK, user)
 }
+
+func writeAccountLocked(w http.ResponseWriter, r *http.Request, lockedErr *service.AccountLockedError) {
+	retryAfter := int(math.Ceil(time.Until(lockedErr.Until).Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	apperror.Write(w, r, apperror.New(apperror.CodeLocked,
+		"account is temporarily locked due to too many failed login attempts",
+	).WithDetails(map[string]any{"locked_until": lockedErr.Until}))
+}
@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/KEPTANy/plag-check/shared/apperror"
+)
+
+// AdminTokenMiddleware guards the admin API, which has no users of its own,
+// with a static bearer token.
+func AdminTokenMiddleware(token string) func(http.Handler) http.Handler {
+	want := []byte("Bearer " + token)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got := []byte(r.Header.Get("Authorization"))
+			if subtle.ConstantTimeCompare(got, want) != 1 {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+				apperror.Write(w, r, apperror.Unauthorized("invalid admin token"))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/KEPTANy/plag-check/shared/apperror"
+	"github.com/KEPTANy/plag-check/shared/identity"
+	"github.com/KEPTANy/plag-check/shared/jwt"
+	sharedMiddleware "github.com/KEPTANy/plag-check/shared/middleware"
+	"github.com/gofrs/uuid/v5"
+)
+
+type contextKey string
+
+const (
+	UserIDKey   contextKey = "user_id"
+	UsernameKey contextKey = "username"
+	RoleKey     contextKey = "role"
+)
+
+// AuthMiddleware trusts the identity signed by the gateway when identitySecret
+// is configured and the header is present, and falls back to parsing the JWT
+// itself for direct calls.
+func AuthMiddleware(jwtSecret, identitySecret string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasPrefix(r.URL.Path, "/health") {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			var userID uuid.UUID
+			var username, role string
+
+			if signed := r.Header.Get(identity.Header); signed != "" && identitySecret != "" {
+				id, err := identity.Verify(signed, identitySecret)
+				if err != nil {
+					apperror.Write(w, r, apperror.Unauthorized("invalid identity"))
+					return
+				}
+
+				userID, username, role = id.UserID, id.Username, id.Role
+			} else {
+				authHeader := r.Header.Get("Authorization")
+				if authHeader == "" {
+					apperror.Write(w, r, apperror.Unauthorized("authorization header required"))
+					return
+				}
+
+				parts := strings.Split(authHeader, " ")
+				if len(parts) != 2 || parts[0] != "Bearer" {
+					apperror.Write(w, r, apperror.Unauthorized("invalid authorization header format"))
+					return
+				}
+
+				token := parts[1]
+
+				claims, err := jwt.GetTokenClaims(token, jwtSecret)
+				if err != nil {
+					apperror.Write(w, r, apperror.Unauthorized("invalid or expired token"))
+					return
+				}
+
+				userID, username, role = claims.UserID, claims.Username, claims.Role
+			}
+
+			ctx := context.WithValue(r.Context(), UserIDKey, userID)
+			ctx = context.WithValue(ctx, UsernameKey, username)
+			ctx = context.WithValue(ctx, RoleKey, role)
+			sharedMiddleware.SetRequestUser(ctx, userID.String())
+
+			r.Header.Set("X-User-ID", userID.String())
+			r.Header.Set("X-User-Role", role)
+
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func RequireRole(requiredRole string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			role, ok := r.Context().Value(RoleKey).(string)
+			if !ok || role != requiredRole {
+				apperror.Write(w, r, apperror.Forbidden("insufficient permissions"))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func RequireAnyRole(requiredRoles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			role, ok := r.Context().Value(RoleKey).(string)
+			if !ok {
+				apperror.Write(w, r, apperror.Unauthorized("unauthorized"))
+				return
+			}
+
+			for _, requiredRole := range requiredRoles {
+				if role == requiredRole {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+
+			apperror.Write(w, r, apperror.Forbidden("insufficient permissions"))
+		})
+	}
+}
+
+func GetUserIDFromContext(ctx context.Context) (uuid.UUID, bool) {
+	userID, ok := ctx.Value(UserIDKey).(uuid.UUID)
+	return userID, ok
+}
+
+func GetRoleFromContext(ctx context.Context) (string, bool) {
+	role, ok := ctx.Value(RoleKey).(string)
+	return role, ok
+}
+
+func GetUsernameFromContext(ctx context.Context) (string, bool) {
+	username, ok := ctx.Value(UsernameKey).(string)
+	return username, ok
+}
@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/KEPTANy/plag-check/shared/apperror"
+	sharedMiddleware "github.com/KEPTANy/plag-check/shared/middleware"
+)
+
+type rateWindow struct {
+	start time.Time
+	count int
+}
+
+// IPRateLimiter allows at most limit requests per client IP in every window.
+// The IP is the one sharedMiddleware.ClientIP put into the request context.
+type IPRateLimiter struct {
+	mu      sync.Mutex
+	limit   int
+	window  time.Duration
+	clients map[string]*rateWindow
+}
+
+func NewIPRateLimiter(limit int, window time.Duration) *IPRateLimiter {
+	return &IPRateLimiter{
+		limit:   limit,
+		window:  window,
+		clients: make(map[string]*rateWindow),
+	}
+}
+
+// allow reports whether another request from ip fits in its current window
+// and, if not, how long the client has to wait.
+func (l *IPRateLimiter) allow(ip string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+
+	// drop windows that already expired so the map does not grow forever
+	if len(l.clients) > 10000 {
+		for key, w := range l.clients {
+			if now.Sub(w.start) >= l.window {
+				delete(l.clients, key)
+			}
+		}
+	}
+
+	w, ok := l.clients[ip]
+	if !ok || now.Sub(w.start) >= l.window {
+		l.clients[ip] = &rateWindow{start: now, count: 1}
+		return true, 0
+	}
+
+	if w.count >= l.limit {
+		return false, w.start.Add(l.window).Sub(now)
+	}
+
+	w.count++
+	return true, 0
+}
+
+func (l *IPRateLimiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if l.limit <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ok, retryAfter := l.allow(sharedMiddleware.GetClientIP(r.Context()))
+		if !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			apperror.Write(w, r, apperror.New(apperror.CodeRateLimited, "too many attempts, try again later"))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
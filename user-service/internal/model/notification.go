@@ -0,0 +1,22 @@
+package model
+
+import "github.com/gofrs/uuid/v5"
+
+const NotificationPasswordReset = "password_reset"
+
+const (
+	NotificationStatusPending = "pending"
+	NotificationStatusSent    = "sent"
+	NotificationStatusFailed  = "failed"
+)
+
+// Notification is a message waiting in notification_outbox. Only the
+// recipient is stored, the message is rendered when it is sent, so secrets
+// such as reset tokens never reach the database.
+type Notification struct {
+	ID        int64
+	UserID    uuid.UUID
+	Kind      string
+	Recipient string
+	Attempts  int
+}
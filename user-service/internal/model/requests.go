@@ -13,5 +13,55 @@ type LoginRequest struct {
 }
 
 type LoginResponse struct {
-	Token string `json:"token"`
+	Token              string `json:"token"`
+	MustChangePassword bool   `json:"must_change_password,omitempty"`
+}
+
+type UpdateProfileRequest struct {
+	DisplayName *string `json:"display_name"`
+	Email       *string `json:"email"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" validate:"required"`
+	NewPassword     string `json:"new_password" validate:"required"`
+}
+
+type PasswordResetRequest struct {
+	Username string `json:"username"`
+	Email    string `json:"email"`
+}
+
+type PasswordResetConfirmRequest struct {
+	Token       string `json:"token" validate:"required"`
+	NewPassword string `json:"new_password" validate:"required"`
+}
+
+type RosterEntry struct {
+	Row         int
+	Username    string
+	DisplayName string
+	Email       string
+}
+
+const (
+	ImportStatusCreated   = "created"
+	ImportStatusDuplicate = "duplicate"
+	ImportStatusInvalid   = "invalid"
+)
+
+type ImportResult struct {
+	Row             int    `json:"row"`
+	Username        string `json:"username"`
+	Status          string `json:"status"`
+	Error           string `json:"error,omitempty"`
+	UserID          string `json:"id,omitempty"`
+	OneTimePassword string `json:"one_time_password,omitempty"`
+}
+
+type ImportResponse struct {
+	Created   int            `json:"created"`
+	Duplicate int            `json:"duplicate"`
+	Invalid   int            `json:"invalid"`
+	Results   []ImportResult `json:"results"`
 }
@@ -1,14 +1,34 @@
 package model
 
-import "github.com/gofrs/uuid/v5"
+import (
+	"net/mail"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+)
 
 type User struct {
 	ID           uuid.UUID `json:"id"`
 	Username     string    `json:"username"`
 	PasswordHash string    `json:"-"`
 	Role         string    `json:"role"`
+	DisplayName  string    `json:"display_name"`
+	Email        string    `json:"email"`
+
+	MustChangePassword bool `json:"must_change_password"`
+	// External users log in through the OIDC provider, which owns their
+	// password
+	External bool `json:"-"`
+
+	FailedLoginAttempts int        `json:"-"`
+	LockedUntil         *time.Time `json:"-"`
 }
 
 func IsValidRole(role string) bool {
 	return role == "student" || role == "teacher"
 }
+
+func IsValidEmail(email string) bool {
+	addr, err := mail.ParseAddress(email)
+	return err == nil && addr.Address == email && len(email) <= 255
+}
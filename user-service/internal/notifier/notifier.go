@@ -0,0 +1,96 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// ErrUndeliverable is returned by a Notifier for a message it can never
+// deliver, e.g. to a user without an e-mail address. It is not retried.
+var ErrUndeliverable = errors.New("Message can not be delivered")
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Notifier delivers account related messages to users.
+type Notifier interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+func passwordResetMessage(to, token string, expiresAt time.Time) *Message {
+	return &Message{
+		To:      to,
+		Subject: "Password reset",
+		Body: fmt.Sprintf(
+			"A password reset was requested for your account. Use this token to set a new password: %s\n"+
+				"The token expires at %s and can be used only once.",
+			token, expiresAt.Format(time.RFC3339),
+		),
+	}
+}
+
+type devLogNotifier struct{}
+
+// NewDevLogNotifier returns a Notifier that writes messages, reset tokens
+// included, to the service log. It is meant for local development only.
+func NewDevLogNotifier() Notifier {
+	return &devLogNotifier{}
+}
+
+func (n *devLogNotifier) Send(ctx context.Context, msg *Message) error {
+	slog.WarnContext(ctx, "Notification written to the log (dev-log notifier)",
+		"recipient", msg.To, "subject", msg.Subject, "message", msg.Body)
+	return nil
+}
+
+type SMTPConfig struct {
+	// Addr is host:port of the mail server, STARTTLS is used if offered
+	Addr     string
+	From     string
+	Username string
+	Password string
+}
+
+type smtpNotifier struct {
+	cfg SMTPConfig
+}
+
+// NewSMTPNotifier returns a Notifier that sends e-mail through cfg.Addr.
+func NewSMTPNotifier(cfg SMTPConfig) Notifier {
+	return &smtpNotifier{cfg: cfg}
+}
+
+func (n *smtpNotifier) Send(ctx context.Context, msg *Message) error {
+	to, err := mail.ParseAddress(msg.To)
+	if err != nil {
+		return fmt.Errorf("%w: invalid e-mail address", ErrUndeliverable)
+	}
+
+	var auth smtp.Auth
+	if n.cfg.Username != "" {
+		host, _, _ := strings.Cut(n.cfg.Addr, ":")
+		auth = smtp.PlainAuth("", n.cfg.Username, n.cfg.Password, host)
+	}
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "From: %s\r\n", n.cfg.From)
+	fmt.Fprintf(&body, "To: %s\r\n", to.String())
+	fmt.Fprintf(&body, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&body, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	body.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	body.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+
+	if err := smtp.SendMail(n.cfg.Addr, auth, n.cfg.From, []string{to.Address}, []byte(body.String())); err != nil {
+		return fmt.Errorf("Failed to send e-mail: %w", err)
+	}
+	return nil
+}
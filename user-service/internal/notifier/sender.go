@@ -0,0 +1,140 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/KEPTANy/plag-check/user-service/internal/model"
+	"github.com/KEPTANy/plag-check/user-service/internal/repository"
+	"github.com/gofrs/uuid/v5"
+)
+
+// maxRetryDelay caps the exponential backoff between attempts
+const maxRetryDelay = time.Hour
+
+// ResetTokenIssuer mints the token of a password reset message when it is
+// sent, so the token only ever exists in the message itself.
+type ResetTokenIssuer interface {
+	IssuePasswordResetToken(ctx context.Context, userID uuid.UUID, notificationID int64) (string, time.Time, error)
+}
+
+// Sender renders and sends the messages queued in notification_outbox.
+// Instances of the service share the work through
+// NotificationRepository.ClaimNotifications.
+type Sender struct {
+	repo     repository.NotificationRepository
+	issuer   ResetTokenIssuer
+	notifier Notifier
+
+	PollInterval time.Duration
+	BatchSize    int
+	// MaxAttempts is how often a message is sent before it is marked failed
+	MaxAttempts int
+	// RetryDelay is the delay after the first failed attempt, it doubles
+	// with every further one
+	RetryDelay time.Duration
+}
+
+func NewSender(repo repository.NotificationRepository, issuer ResetTokenIssuer, notifier Notifier) *Sender {
+	return &Sender{
+		repo:         repo,
+		issuer:       issuer,
+		notifier:     notifier,
+		PollInterval: 5 * time.Second,
+		BatchSize:    20,
+		MaxAttempts:  5,
+		RetryDelay:   time.Minute,
+	}
+}
+
+// Run sends messages until ctx is done, it is meant for bootstrap.App.Go.
+func (s *Sender) Run(ctx context.Context) error {
+	for {
+		n, err := s.sendBatch(ctx)
+		if err != nil && ctx.Err() == nil {
+			slog.ErrorContext(ctx, "Failed to send notifications", "error", err)
+		}
+
+		if err == nil && n == s.BatchSize {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(s.PollInterval):
+		}
+	}
+}
+
+func (s *Sender) sendBatch(ctx context.Context) (int, error) {
+	// messages of a batch are sent one by one, the lease covers all of them
+	notifications, err := s.repo.ClaimNotifications(ctx, s.BatchSize, 10*time.Minute)
+	if err != nil {
+		return 0, err
+	}
+
+	for i := range notifications {
+		s.deliver(ctx, &notifications[i])
+	}
+
+	return len(notifications), nil
+}
+
+func (s *Sender) deliver(ctx context.Context, notification *model.Notification) {
+	err := s.send(ctx, notification)
+	if ctx.Err() != nil {
+		// shutting down, the message is sent again after its lease
+		return
+	}
+
+	attempts := notification.Attempts + 1
+	status := model.NotificationStatusSent
+	nextAttemptAt := time.Now()
+	lastError := ""
+
+	if err != nil {
+		lastError = err.Error()
+		switch {
+		case errors.Is(err, ErrUndeliverable) || attempts >= s.MaxAttempts:
+			status = model.NotificationStatusFailed
+			slog.WarnContext(ctx, "Giving up on notification", "notification_id", notification.ID,
+				"kind", notification.Kind, "attempts", attempts, "error", err)
+		default:
+			status = model.NotificationStatusPending
+			nextAttemptAt = nextAttemptAt.Add(s.backoff(attempts))
+		}
+	}
+
+	if err := s.repo.RecordNotificationAttempt(ctx, notification.ID, status, lastError, nextAttemptAt); err != nil {
+		slog.ErrorContext(ctx, "Failed to record notification attempt", "notification_id", notification.ID, "error", err)
+	}
+}
+
+// send renders the message and hands it to the notifier. Secrets are
+// created here and are not kept anywhere else.
+func (s *Sender) send(ctx context.Context, notification *model.Notification) error {
+	switch notification.Kind {
+	case model.NotificationPasswordReset:
+		token, expiresAt, err := s.issuer.IssuePasswordResetToken(ctx, notification.UserID, notification.ID)
+		if err != nil {
+			return err
+		}
+		return s.notifier.Send(ctx, passwordResetMessage(notification.Recipient, token, expiresAt))
+	default:
+		return fmt.Errorf("%w: unknown kind %q", ErrUndeliverable, notification.Kind)
+	}
+}
+
+// backoff is RetryDelay doubled for every attempt after the first, up to an
+// hour.
+func (s *Sender) backoff(attempts int) time.Duration {
+	delay := s.RetryDelay
+	for i := 1; i < attempts && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxRetryDelay)
+}
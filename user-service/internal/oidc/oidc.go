@@ -0,0 +1,160 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/KEPTANy/plag-check/shared/tracing"
+	gooidc "github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+type Config struct {
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+
+	UsernameClaim string
+	RoleClaim     string
+	TeacherRoles  []string
+}
+
+// Identity is the part of the ID token that is mapped onto a local user.
+type Identity struct {
+	Issuer      string
+	Subject     string
+	Username    string
+	DisplayName string
+	Email       string
+	Role        string
+}
+
+type Provider struct {
+	config   Config
+	oauth2   oauth2.Config
+	verifier *gooidc.IDTokenVerifier
+	client   *http.Client
+}
+
+// NewProvider fetches the discovery document of the issuer, so the provider
+// has to be reachable when the service starts.
+func NewProvider(ctx context.Context, config Config) (*Provider, error) {
+	// the provider keeps the client of ctx to fetch signing keys later
+	client := &http.Client{Timeout: 10 * time.Second, Transport: tracing.Transport(nil)}
+	ctx = gooidc.ClientContext(ctx, client)
+
+	provider, err := gooidc.NewProvider(ctx, config.IssuerURL)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to discover OIDC provider: %w", err)
+	}
+
+	scopes := config.Scopes
+	if !slices.Contains(scopes, gooidc.ScopeOpenID) {
+		scopes = append([]string{gooidc.ScopeOpenID}, scopes...)
+	}
+
+	return &Provider{
+		config: config,
+		oauth2: oauth2.Config{
+			ClientID:     config.ClientID,
+			ClientSecret: config.ClientSecret,
+			RedirectURL:  config.RedirectURL,
+			Endpoint:     provider.Endpoint(),
+			Scopes:       scopes,
+		},
+		verifier: provider.Verifier(&gooidc.Config{ClientID: config.ClientID}),
+		client:   client,
+	}, nil
+}
+
+// AuthCodeURL returns the provider URL the user is redirected to. The state,
+// nonce and PKCE verifier have to be kept by the caller until the callback.
+func (p *Provider) AuthCodeURL(state, nonce, verifier string) string {
+	return p.oauth2.AuthCodeURL(state, gooidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier))
+}
+
+// Exchange trades the authorization code for tokens, verifies the ID token
+// and maps its claims onto an Identity.
+func (p *Provider) Exchange(ctx context.Context, code, nonce, verifier string) (*Identity, error) {
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, p.client)
+	token, err := p.oauth2.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to exchange authorization code: %w", err)
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, errors.New("Token response does not contain an id_token")
+	}
+
+	idToken, err := p.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to verify id_token: %w", err)
+	}
+
+	if idToken.Nonce != nonce {
+		return nil, errors.New("id_token nonce does not match")
+	}
+
+	var claims map[string]any
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("Failed to parse id_token claims: %w", err)
+	}
+
+	identity := &Identity{
+		Issuer:      idToken.Issuer,
+		Subject:     idToken.Subject,
+		Username:    stringClaim(claims, p.config.UsernameClaim),
+		DisplayName: stringClaim(claims, "name"),
+		Role:        p.mapRole(claims),
+	}
+
+	// an address the provider does not vouch for may belong to someone else,
+	// password reset mails would go there
+	if verified, _ := claims["email_verified"].(bool); verified {
+		identity.Email = stringClaim(claims, "email")
+	}
+
+	if identity.Username == "" {
+		identity.Username = identity.Subject
+	}
+
+	return identity, nil
+}
+
+// mapRole makes the user a teacher if the role claim contains any of the
+// configured teacher roles, and a student otherwise. The claim may be a
+// string or a list of strings.
+func (p *Provider) mapRole(claims map[string]any) string {
+	var values []string
+	switch claim := claims[p.config.RoleClaim].(type) {
+	case string:
+		values = strings.Fields(strings.ReplaceAll(claim, ",", " "))
+	case []any:
+		for _, v := range claim {
+			if s, ok := v.(string); ok {
+				values = append(values, s)
+			}
+		}
+	}
+
+	for _, value := range values {
+		if slices.Contains(p.config.TeacherRoles, value) {
+			return "teacher"
+		}
+	}
+
+	return "student"
+}
+
+func stringClaim(claims map[string]any, name string) string {
+	value, _ := claims[name].(string)
+	return value
+}
@@ -0,0 +1,163 @@
+package oidc_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/KEPTANy/plag-check/user-service/internal/oidc"
+	"github.com/KEPTANy/plag-check/user-service/internal/oidc/oidctest"
+	"golang.org/x/oauth2"
+)
+
+func newProvider(t *testing.T) (*oidctest.Server, *oidc.Provider) {
+	t.Helper()
+
+	server, err := oidctest.NewServer("plag-check")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(server.Close)
+
+	provider, err := oidc.NewProvider(context.Background(), oidc.Config{
+		IssuerURL:     server.URL,
+		ClientID:      "plag-check",
+		RedirectURL:   "http://localhost/auth/oidc/callback",
+		Scopes:        []string{"profile", "email"},
+		UsernameClaim: "preferred_username",
+		RoleClaim:     "roles",
+		TeacherRoles:  []string{"staff", "teacher"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return server, provider
+}
+
+func TestExchange(t *testing.T) {
+	tests := []struct {
+		name   string
+		claims map[string]any
+		want   oidc.Identity
+	}{
+		{
+			name: "teacher from role list",
+			claims: map[string]any{
+				"sub":                "t-1",
+				"preferred_username": "ivanov",
+				"name":               "Ivan Ivanov",
+				"email":              "ivanov@example.com",
+				"email_verified":     true,
+				"roles":              []string{"employee", "staff"},
+			},
+			want: oidc.Identity{
+				Subject: "t-1", Username: "ivanov", DisplayName: "Ivan Ivanov",
+				Email: "ivanov@example.com", Role: "teacher",
+			},
+		},
+		{
+			name: "student with unverified email",
+			claims: map[string]any{
+				"sub":                "s-1",
+				"preferred_username": "petrov",
+				"email":              "petrov@example.com",
+				"email_verified":     false,
+				"roles":              "student",
+			},
+			want: oidc.Identity{Subject: "s-1", Username: "petrov", Role: "student"},
+		},
+		{
+			name: "email without verification claim",
+			claims: map[string]any{
+				"sub":                "s-3",
+				"preferred_username": "sidorov",
+				"email":              "sidorov@example.com",
+			},
+			want: oidc.Identity{Subject: "s-3", Username: "sidorov", Role: "student"},
+		},
+		{
+			name:   "username falls back to subject",
+			claims: map[string]any{"sub": "s-2", "roles": "teacher,admin"},
+			want:   oidc.Identity{Subject: "s-2", Username: "s-2", Role: "teacher"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, provider := newProvider(t)
+
+			verifier := oauth2.GenerateVerifier()
+			code, _, err := server.Authorize(provider.AuthCodeURL("state", "nonce", verifier), tt.claims)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			identity, err := provider.Exchange(context.Background(), code, "nonce", verifier)
+			if err != nil {
+				t.Fatalf("Exchange() error = %v", err)
+			}
+
+			tt.want.Issuer = server.URL
+			if *identity != tt.want {
+				t.Errorf("Exchange() = %+v, want %+v", *identity, tt.want)
+			}
+		})
+	}
+}
+
+func TestExchangeRejects(t *testing.T) {
+	tests := []struct {
+		name     string
+		claims   map[string]any
+		nonce    string
+		verifier func(string) string
+		wantErr  string
+	}{
+		{
+			name:    "nonce mismatch",
+			nonce:   "other",
+			wantErr: "nonce does not match",
+		},
+		{
+			name:     "wrong PKCE verifier",
+			verifier: func(string) string { return oauth2.GenerateVerifier() },
+			wantErr:  "Failed to exchange authorization code",
+		},
+		{
+			name:    "token for another client",
+			claims:  map[string]any{"aud": "other-client"},
+			wantErr: "Failed to verify id_token",
+		},
+		{
+			name:    "expired token",
+			claims:  map[string]any{"exp": 1},
+			wantErr: "Failed to verify id_token",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, provider := newProvider(t)
+
+			verifier := oauth2.GenerateVerifier()
+			code, _, err := server.Authorize(provider.AuthCodeURL("state", "nonce", verifier), tt.claims)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			nonce := "nonce"
+			if tt.nonce != "" {
+				nonce = tt.nonce
+			}
+			if tt.verifier != nil {
+				verifier = tt.verifier(verifier)
+			}
+
+			_, err = provider.Exchange(context.Background(), code, nonce, verifier)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Exchange() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/KEPTANy/plag-check/shared/dbtx"
+	"github.com/KEPTANy/plag-check/user-service/internal/model"
+	"github.com/gofrs/uuid/v5"
+	"github.com/jackc/pgx/v5"
+)
+
+type NotificationRepository interface {
+	AddNotification(ctx context.Context, userID uuid.UUID, kind, recipient string) error
+	// ClaimNotifications leases up to limit pending notifications that are
+	// due, so other instances skip them until the lease ends.
+	ClaimNotifications(ctx context.Context, limit int, lease time.Duration) ([]model.Notification, error)
+	RecordNotificationAttempt(ctx context.Context, id int64, status, lastError string, nextAttemptAt time.Time) error
+}
+
+type notificationRepository struct {
+	db *PgRepository
+}
+
+func NewNotificationRepository(db *PgRepository) NotificationRepository {
+	return &notificationRepository{db: db}
+}
+
+func (n *notificationRepository) AddNotification(ctx context.Context, userID uuid.UUID, kind, recipient string) error {
+	query := `
+		INSERT INTO notification_outbox (user_id, kind, recipient)
+		VALUES ($1, $2, $3)
+	`
+
+	_, err := dbtx.From(ctx, n.db.pool).Exec(ctx, query, userID, kind, recipient)
+	if err != nil {
+		return fmt.Errorf("Failed to add notification to outbox: %w", err)
+	}
+
+	return nil
+}
+
+func (n *notificationRepository) ClaimNotifications(ctx context.Context, limit int, lease time.Duration) ([]model.Notification, error) {
+	query := `
+		UPDATE notification_outbox
+		SET next_attempt_at = NOW() + $2::interval
+		WHERE id IN (
+			SELECT id
+			FROM notification_outbox
+			WHERE status = 'pending' AND next_attempt_at <= NOW()
+			ORDER BY next_attempt_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, user_id, kind, recipient, attempts
+	`
+
+	rows, err := dbtx.From(ctx, n.db.pool).Query(ctx, query, limit, lease)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to claim notifications: %w", err)
+	}
+
+	notifications, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (model.Notification, error) {
+		var notification model.Notification
+		err := row.Scan(
+			&notification.ID, &notification.UserID, &notification.Kind, &notification.Recipient,
+			&notification.Attempts,
+		)
+		return notification, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to scan notification: %w", err)
+	}
+
+	return notifications, nil
+}
+
+func (n *notificationRepository) RecordNotificationAttempt(ctx context.Context, id int64, status, lastError string, nextAttemptAt time.Time) error {
+	query := `
+		UPDATE notification_outbox
+		SET
+			status = $2,
+			attempts = attempts + 1,
+			last_error = NULLIF($3, ''),
+			next_attempt_at = $4,
+			sent_at = CASE WHEN $2 = 'sent' THEN NOW() ELSE sent_at END
+		WHERE id = $1
+	`
+
+	_, err := dbtx.From(ctx, n.db.pool).Exec(ctx, query, id, status, lastError, nextAttemptAt)
+	if err != nil {
+		return fmt.Errorf("Failed to record notification attempt: %w", err)
+	}
+
+	return nil
+}
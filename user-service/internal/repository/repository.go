@@ -2,9 +2,9 @@ package repository
 
 import (
 	"context"
-	"fmt"
-	"time"
 
+	"github.com/KEPTANy/plag-check/shared/bootstrap"
+	"github.com/KEPTANy/plag-check/shared/dbtx"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -12,28 +12,19 @@ type PgRepository struct {
 	pool *pgxpool.Pool
 }
 
-func NewPgRepository(connString string) (*PgRepository, error) {
-	config, err := pgxpool.ParseConfig(connString)
+func NewPgRepository(ctx context.Context, db bootstrap.Database) (*PgRepository, error) {
+	pool, err := bootstrap.NewPool(ctx, db)
 	if err != nil {
-		return nil, fmt.Errorf("Failed to parse connection string: %w", err)
+		return nil, err
 	}
 
-	config.MaxConns = 25
-	config.MinConns = 5
-
-	ctx, close := context.WithTimeout(context.Background(), 10*time.Second)
-	defer close()
-
-	pool, err := pgxpool.NewWithConfig(ctx, config)
-	if err != nil {
-		return nil, fmt.Errorf("Failed to create connection pool: %w", err)
-	}
-
-	if err := pool.Ping(ctx); err != nil {
-		return nil, fmt.Errorf("Failed to ping database: %w", err)
-	}
+	return &PgRepository{pool: pool}, nil
+}
 
-	return &PgRepository{pool: pool}, err
+// InTx runs fn in a transaction, repository calls and published events made
+// with the context passed to fn join it.
+func (repo *PgRepository) InTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return dbtx.InTx(ctx, repo.pool, fn)
 }
 
 func (repo *PgRepository) Close() {
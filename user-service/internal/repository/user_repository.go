@@ -2,16 +2,51 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"time"
 
+	"github.com/KEPTANy/plag-check/shared/dbtx"
 	"github.com/KEPTANy/plag-check/user-service/internal/model"
 	"github.com/gofrs/uuid/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 )
 
 type UserRepository interface {
 	CreateUser(ctx context.Context, username, password_hash, role string) (*model.User, error)
 	GetUserByID(ctx context.Context, id uuid.UUID) (*model.User, error)
 	GetUserByUsername(ctx context.Context, username string) (*model.User, error)
+	RecordFailedLogin(ctx context.Context, id uuid.UUID, maxAttempts int, lockout time.Duration) (*time.Time, error)
+	ResetFailedLogins(ctx context.Context, id uuid.UUID) error
+	UpdateProfile(ctx context.Context, id uuid.UUID, displayName, email *string) (*model.User, error)
+	UpdatePassword(ctx context.Context, id uuid.UUID, passwordHash string) error
+	CreateUsers(ctx context.Context, users []*model.User) ([]error, error)
+	GetUserByEmail(ctx context.Context, email string) (*model.User, error)
+	CreatePasswordResetToken(ctx context.Context, userID uuid.UUID, notificationID int64, tokenHash string, expiresAt time.Time) error
+	ResetPasswordWithToken(ctx context.Context, tokenHash, passwordHash string) (uuid.UUID, error)
+	GetUserByOIDCSubject(ctx context.Context, issuer, subject string) (*model.User, error)
+	CreateOIDCUser(ctx context.Context, issuer, subject string, user *model.User) (*model.User, error)
+	SyncOIDCUser(ctx context.Context, id uuid.UUID, role, displayName, email string) (*model.User, error)
+}
+
+const userColumns = `
+	id, username, password_hash, role, failed_login_attempts, locked_until,
+	COALESCE(display_name, ''), COALESCE(email, ''), must_change_password,
+	oidc_subject IS NOT NULL
+`
+
+func scanUser(row pgx.Row) (*model.User, error) {
+	var user model.User
+	err := row.Scan(
+		&user.ID, &user.Username, &user.PasswordHash, &user.Role, &user.FailedLoginAttempts, &user.LockedUntil,
+		&user.DisplayName, &user.Email, &user.MustChangePassword, &user.External,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
 }
 
 type userRepository struct {
@@ -30,7 +65,7 @@ func (u *userRepository) CreateUser(ctx context.Context, username, password_hash
 	`
 
 	var user model.User
-	err := u.db.pool.QueryRow(ctx, query, username, password_hash, role).Scan(&user.ID, &user.Username, &user.Role)
+	err := dbtx.From(ctx, u.db.pool).QueryRow(ctx, query, username, password_hash, role).Scan(&user.ID, &user.Username, &user.Role)
 	if err != nil {
 		return nil, fmt.Errorf("Failed to create a user: %w", err)
 	}
@@ -39,33 +74,299 @@ func (u *userRepository) CreateUser(ctx context.Context, username, password_hash
 }
 
 func (u *userRepository) GetUserByID(ctx context.Context, id uuid.UUID) (*model.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE id = $1`
+
+	user, err := scanUser(dbtx.From(ctx, u.db.pool).QueryRow(ctx, query, id))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to find a user: %w", err)
+	}
+
+	return user, nil
+}
+
+func (u *userRepository) GetUserByUsername(ctx context.Context, username string) (*model.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE username = $1`
+
+	user, err := scanUser(dbtx.From(ctx, u.db.pool).QueryRow(ctx, query, username))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to find a user: %w", err)
+	}
+
+	return user, nil
+}
+
+func (u *userRepository) GetUserByEmail(ctx context.Context, email string) (*model.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE LOWER(email) = LOWER($1)`
+
+	user, err := scanUser(dbtx.From(ctx, u.db.pool).QueryRow(ctx, query, email))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to find a user: %w", err)
+	}
+
+	return user, nil
+}
+
+// UpdateProfile changes only the fields that are not nil, an empty string
+// clears the field.
+func (u *userRepository) UpdateProfile(ctx context.Context, id uuid.UUID, displayName, email *string) (*model.User, error) {
 	query := `
-		SELECT id, username, password_hash, role
-		FROM users
+		UPDATE users
+		SET
+			display_name = CASE WHEN $2::text IS NULL THEN display_name ELSE NULLIF($2, '') END,
+			email = CASE WHEN $3::text IS NULL THEN email ELSE NULLIF($3, '') END
+		WHERE id = $1
+		RETURNING ` + userColumns
+
+	user, err := scanUser(dbtx.From(ctx, u.db.pool).QueryRow(ctx, query, id, displayName, email))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to update user profile: %w", err)
+	}
+
+	return user, nil
+}
+
+func (u *userRepository) UpdatePassword(ctx context.Context, id uuid.UUID, passwordHash string) error {
+	query := `
+		UPDATE users
+		SET
+			password_hash = $2,
+			must_change_password = FALSE,
+			failed_login_attempts = 0,
+			locked_until = NULL
 		WHERE id = $1
 	`
 
-	var user model.User
-	err := u.db.pool.QueryRow(ctx, query, id).Scan(&user.ID, &user.Username, &user.PasswordHash, &user.Role)
+	tag, err := dbtx.From(ctx, u.db.pool).Exec(ctx, query, id, passwordHash)
 	if err != nil {
-		return nil, fmt.Errorf("Failed to find a user: %w", err)
+		return fmt.Errorf("Failed to update password: %w", err)
 	}
 
-	return &user, nil
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("Failed to update password: %w", pgx.ErrNoRows)
+	}
+
+	return nil
 }
 
-func (u *userRepository) GetUserByUsername(ctx context.Context, username string) (*model.User, error) {
+// RecordFailedLogin increments the failed login counter and locks the account
+// once maxAttempts is reached. The counter starts over after a lockout.
+// Returns the time the account is locked until, or nil if it is not locked.
+func (u *userRepository) RecordFailedLogin(ctx context.Context, id uuid.UUID, maxAttempts int, lockout time.Duration) (*time.Time, error) {
 	query := `
-		SELECT id, username, password_hash, role
-		FROM users
-		WHERE username = $1
+		UPDATE users
+		SET
+			failed_login_attempts = CASE
+				WHEN failed_login_attempts + 1 >= $2 THEN 0
+				ELSE failed_login_attempts + 1
+			END,
+			locked_until = CASE
+				WHEN failed_login_attempts + 1 >= $2 THEN NOW() + $3 * INTERVAL '1 second'
+				ELSE locked_until
+			END
+		WHERE id = $1
+		RETURNING locked_until
 	`
 
-	var user model.User
-	err := u.db.pool.QueryRow(ctx, query, username).Scan(&user.ID, &user.Username, &user.PasswordHash, &user.Role)
+	var lockedUntil *time.Time
+	err := dbtx.From(ctx, u.db.pool).QueryRow(ctx, query, id, maxAttempts, lockout.Seconds()).Scan(&lockedUntil)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to record failed login: %w", err)
+	}
+
+	return lockedUntil, nil
+}
+
+func (u *userRepository) ResetFailedLogins(ctx context.Context, id uuid.UUID) error {
+	query := `
+		UPDATE users
+		SET failed_login_attempts = 0, locked_until = NULL
+		WHERE id = $1
+	`
+
+	_, err := dbtx.From(ctx, u.db.pool).Exec(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("Failed to reset failed logins: %w", err)
+	}
+
+	return nil
+}
+
+// CreateUsers inserts all users in a single transaction. Every insert runs in
+// its own savepoint, so a row that violates a constraint is reported in the
+// returned slice (one entry per user, nil on success) without aborting the
+// others. Any other failure rolls back the whole batch.
+func (u *userRepository) CreateUsers(ctx context.Context, users []*model.User) ([]error, error) {
+	query := `
+		INSERT INTO users (username, password_hash, role, display_name, email, must_change_password)
+		VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, ''), $6)
+		RETURNING id
+	`
+
+	tx, err := dbtx.From(ctx, u.db.pool).Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	rowErrs := make([]error, len(users))
+	for i, user := range users {
+		savepoint, err := tx.Begin(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to create savepoint: %w", err)
+		}
+
+		err = savepoint.QueryRow(
+			ctx, query, user.Username, user.PasswordHash, user.Role, user.DisplayName, user.Email, user.MustChangePassword,
+		).Scan(&user.ID)
+
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			rowErrs[i] = err
+			if err := savepoint.Rollback(ctx); err != nil {
+				return nil, fmt.Errorf("Failed to roll back savepoint: %w", err)
+			}
+			continue
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to create a user: %w", err)
+		}
+
+		if err := savepoint.Commit(ctx); err != nil {
+			return nil, fmt.Errorf("Failed to release savepoint: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("Failed to commit transaction: %w", err)
+	}
+
+	return rowErrs, nil
+}
+
+// CreatePasswordResetToken stores the hash of a token minted for a
+// notification. Tokens minted for earlier attempts to send the same
+// notification are revoked.
+func (u *userRepository) CreatePasswordResetToken(ctx context.Context, userID uuid.UUID, notificationID int64, tokenHash string, expiresAt time.Time) error {
+	return u.db.InTx(ctx, func(ctx context.Context) error {
+		db := dbtx.From(ctx, u.db.pool)
+
+		_, err := db.Exec(ctx, `
+			UPDATE password_reset_tokens
+			SET used_at = NOW()
+			WHERE notification_id = $1 AND used_at IS NULL
+		`, notificationID)
+		if err != nil {
+			return fmt.Errorf("Failed to revoke password reset tokens: %w", err)
+		}
+
+		_, err = db.Exec(ctx, `
+			INSERT INTO password_reset_tokens (user_id, notification_id, token_hash, expires_at)
+			VALUES ($1, $2, $3, $4)
+		`, userID, notificationID, tokenHash, expiresAt)
+		if err != nil {
+			return fmt.Errorf("Failed to create password reset token: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// ResetPasswordWithToken consumes an unused, unexpired reset token and sets
+// the new password of its owner. All other outstanding tokens of the user are
+// consumed as well. Returns pgx.ErrNoRows if the token is not valid.
+func (u *userRepository) ResetPasswordWithToken(ctx context.Context, tokenHash, passwordHash string) (uuid.UUID, error) {
+	tx, err := dbtx.From(ctx, u.db.pool).Begin(ctx)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("Failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var userID uuid.UUID
+	err = tx.QueryRow(ctx, `
+		SELECT user_id
+		FROM password_reset_tokens
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+		FOR UPDATE
+	`, tokenHash).Scan(&userID)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("Failed to find password reset token: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE users
+		SET
+			password_hash = $2,
+			must_change_password = FALSE,
+			failed_login_attempts = 0,
+			locked_until = NULL
+		WHERE id = $1
+	`, userID, passwordHash)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("Failed to update password: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE password_reset_tokens
+		SET used_at = NOW()
+		WHERE user_id = $1 AND used_at IS NULL
+	`, userID)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("Failed to consume password reset tokens: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return uuid.Nil, fmt.Errorf("Failed to commit transaction: %w", err)
+	}
+
+	return userID, nil
+}
+
+func (u *userRepository) GetUserByOIDCSubject(ctx context.Context, issuer, subject string) (*model.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE oidc_issuer = $1 AND oidc_subject = $2`
+
+	user, err := scanUser(dbtx.From(ctx, u.db.pool).QueryRow(ctx, query, issuer, subject))
 	if err != nil {
 		return nil, fmt.Errorf("Failed to find a user: %w", err)
 	}
 
-	return &user, nil
+	return user, nil
+}
+
+// CreateOIDCUser creates a user that can only log in through the identity
+// provider, its empty password hash never matches any password.
+func (u *userRepository) CreateOIDCUser(ctx context.Context, issuer, subject string, user *model.User) (*model.User, error) {
+	query := `
+		INSERT INTO users (username, password_hash, role, display_name, email, oidc_issuer, oidc_subject)
+		VALUES ($1, '', $2, NULLIF($3, ''), NULLIF($4, ''), $5, $6)
+		RETURNING ` + userColumns
+
+	created, err := scanUser(dbtx.From(ctx, u.db.pool).QueryRow(
+		ctx, query, user.Username, user.Role, user.DisplayName, user.Email, issuer, subject,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create a user: %w", err)
+	}
+
+	return created, nil
+}
+
+// SyncOIDCUser updates the role and profile of a user from fresh provider
+// claims. Empty claims keep the stored value.
+func (u *userRepository) SyncOIDCUser(ctx context.Context, id uuid.UUID, role, displayName, email string) (*model.User, error) {
+	query := `
+		UPDATE users
+		SET
+			role = $2,
+			display_name = COALESCE(NULLIF($3, ''), display_name),
+			email = COALESCE(NULLIF($4, ''), email)
+		WHERE id = $1
+		RETURNING ` + userColumns
+
+	user, err := scanUser(dbtx.From(ctx, u.db.pool).QueryRow(ctx, query, id, role, displayName, email))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to update a user: %w", err)
+	}
+
+	return user, nil
 }
@@ -0,0 +1,93 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/KEPTANy/plag-check/user-service/internal/model"
+	"github.com/KEPTANy/plag-check/user-service/internal/repository"
+	"github.com/gofrs/uuid/v5"
+	"github.com/jackc/pgx/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// passwordUsers keeps a single user and mimics the lockout counter of the
+// repository, other methods of repository.UserRepository are not used by
+// ChangePassword.
+type passwordUsers struct {
+	repository.UserRepository
+	user *model.User
+}
+
+func (r *passwordUsers) GetUserByID(ctx context.Context, id uuid.UUID) (*model.User, error) {
+	if id != r.user.ID {
+		return nil, pgx.ErrNoRows
+	}
+	user := *r.user
+	return &user, nil
+}
+
+func (r *passwordUsers) RecordFailedLogin(ctx context.Context, id uuid.UUID, maxAttempts int, lockout time.Duration) (*time.Time, error) {
+	r.user.FailedLoginAttempts++
+	if r.user.FailedLoginAttempts >= maxAttempts {
+		until := time.Now().Add(lockout)
+		r.user.LockedUntil = &until
+	}
+	return r.user.LockedUntil, nil
+}
+
+func (r *passwordUsers) UpdatePassword(ctx context.Context, id uuid.UUID, passwordHash string) error {
+	r.user.PasswordHash = passwordHash
+	return nil
+}
+
+func TestChangePassword(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("old password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := &passwordUsers{user: &model.User{ID: uuid.Must(uuid.NewV4()), PasswordHash: string(hash)}}
+	u := &userService{
+		db:             users,
+		bCryptCost:     bcrypt.MinCost,
+		passwordPolicy: &PasswordPolicy{MinLength: 8},
+		lockoutPolicy:  LockoutPolicy{MaxFailedLogins: 2, Duration: time.Minute},
+	}
+	ctx := context.Background()
+
+	err = u.ChangePassword(ctx, users.user.ID, &model.ChangePasswordRequest{CurrentPassword: "old password", NewPassword: "short"})
+	var policyErr *PasswordPolicyError
+	if !errors.As(err, &policyErr) {
+		t.Fatalf("weak new password: err = %v, want a policy error", err)
+	}
+
+	err = u.ChangePassword(ctx, users.user.ID, &model.ChangePasswordRequest{CurrentPassword: "old password", NewPassword: "new password"})
+	if err != nil {
+		t.Fatalf("ChangePassword() error = %v", err)
+	}
+	if bcrypt.CompareHashAndPassword([]byte(users.user.PasswordHash), []byte("new password")) != nil {
+		t.Error("the stored hash does not match the new password")
+	}
+
+	// wrong current passwords lock the account like failed logins
+	wrong := &model.ChangePasswordRequest{CurrentPassword: "old password", NewPassword: "another password"}
+	if err := u.ChangePassword(ctx, users.user.ID, wrong); !errors.Is(err, ErrWrongPassword) {
+		t.Fatalf("first wrong password: err = %v, want ErrWrongPassword", err)
+	}
+	var lockedErr *AccountLockedError
+	if err := u.ChangePassword(ctx, users.user.ID, wrong); !errors.As(err, &lockedErr) {
+		t.Fatalf("second wrong password: err = %v, want AccountLockedError", err)
+	}
+
+	// a locked account rejects even the right password
+	right := &model.ChangePasswordRequest{CurrentPassword: "new password", NewPassword: "another password"}
+	if err := u.ChangePassword(ctx, users.user.ID, right); !errors.As(err, &lockedErr) {
+		t.Errorf("locked account: err = %v, want AccountLockedError", err)
+	}
+
+	if err := u.ChangePassword(ctx, uuid.Must(uuid.NewV4()), right); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("unknown user: err = %v, want ErrUserNotFound", err)
+	}
+}
@@ -0,0 +1,101 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/KEPTANy/plag-check/shared/apperror"
+	"github.com/KEPTANy/plag-check/user-service/internal/model"
+	"github.com/gofrs/uuid/v5"
+	"github.com/jackc/pgx/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var ErrInvalidResetToken = apperror.Validation("reset token is invalid or expired")
+
+func hashResetToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// RequestPasswordReset queues a reset message for the user identified by
+// username or email. It does not report whether such a user exists, or
+// whether the user can reset a password at all, so the endpoint can not be
+// used to enumerate accounts. The token is minted by
+// IssuePasswordResetToken when the message is sent.
+func (u *userService) RequestPasswordReset(ctx context.Context, req *model.PasswordResetRequest) error {
+	var user *model.User
+	var err error
+	if req.Username != "" {
+		user, err = u.db.GetUserByUsername(ctx, req.Username)
+	} else {
+		user, err = u.db.GetUserByEmail(ctx, req.Email)
+	}
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		slog.InfoContext(ctx, "Password reset requested for unknown user")
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to find user in the db: %w", err)
+	}
+
+	// the provider owns the password of external users, and without an
+	// e-mail address there is nobody to send the token to
+	if user.External || user.Email == "" {
+		slog.InfoContext(ctx, "Password reset requested for a user it does not apply to",
+			"user_id", user.ID, "external", user.External)
+		return nil
+	}
+
+	if err := u.notifications.AddNotification(ctx, user.ID, model.NotificationPasswordReset, user.Email); err != nil {
+		return fmt.Errorf("Failed to queue password reset: %w", err)
+	}
+
+	return nil
+}
+
+// IssuePasswordResetToken mints the token of a password reset message right
+// before it is sent. Only the hash of the token is stored.
+func (u *userService) IssuePasswordResetToken(ctx context.Context, userID uuid.UUID, notificationID int64) (string, time.Time, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", time.Time{}, fmt.Errorf("Failed to generate reset token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+	expiresAt := time.Now().Add(u.resetTokenTTL)
+
+	if err := u.db.CreatePasswordResetToken(ctx, userID, notificationID, hashResetToken(token), expiresAt); err != nil {
+		return "", time.Time{}, err
+	}
+
+	return token, expiresAt, nil
+}
+
+func (u *userService) ConfirmPasswordReset(ctx context.Context, req *model.PasswordResetConfirmRequest) error {
+	if err := u.passwordPolicy.Validate(req.NewPassword); err != nil {
+		return err
+	}
+
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), u.bCryptCost)
+	if err != nil {
+		return fmt.Errorf("Failed to hash password: %w", err)
+	}
+
+	_, err = u.db.ResetPasswordWithToken(ctx, hashResetToken(req.Token), string(passwordHash))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrInvalidResetToken
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to reset password: %w", err)
+	}
+
+	return nil
+}
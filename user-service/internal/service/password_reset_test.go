@@ -0,0 +1,82 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/KEPTANy/plag-check/user-service/internal/model"
+	"github.com/KEPTANy/plag-check/user-service/internal/repository"
+	"github.com/gofrs/uuid/v5"
+	"github.com/jackc/pgx/v5"
+)
+
+// resetUsers finds users by username, other methods of
+// repository.UserRepository are not used by RequestPasswordReset.
+type resetUsers struct {
+	repository.UserRepository
+	users map[string]*model.User
+}
+
+func (r *resetUsers) GetUserByUsername(ctx context.Context, username string) (*model.User, error) {
+	user, ok := r.users[username]
+	if !ok {
+		return nil, pgx.ErrNoRows
+	}
+	return user, nil
+}
+
+type queuedNotification struct {
+	userID    uuid.UUID
+	kind      string
+	recipient string
+}
+
+type resetNotifications struct {
+	repository.NotificationRepository
+	queued []queuedNotification
+}
+
+func (n *resetNotifications) AddNotification(ctx context.Context, userID uuid.UUID, kind, recipient string) error {
+	n.queued = append(n.queued, queuedNotification{userID, kind, recipient})
+	return nil
+}
+
+func TestRequestPasswordReset(t *testing.T) {
+	alice := &model.User{ID: uuid.Must(uuid.NewV4()), Username: "alice", Email: "alice@example.com"}
+	users := &resetUsers{users: map[string]*model.User{
+		"alice": alice,
+		"bob":   {ID: uuid.Must(uuid.NewV4()), Username: "bob"},
+		"carol": {ID: uuid.Must(uuid.NewV4()), Username: "carol", Email: "carol@example.com", External: true},
+	}}
+
+	tests := []struct {
+		username string
+		want     []queuedNotification
+	}{
+		{"alice", []queuedNotification{{alice.ID, model.NotificationPasswordReset, "alice@example.com"}}},
+		{"bob", nil},     // no e-mail address
+		{"carol", nil},   // signs in through OIDC
+		{"mallory", nil}, // unknown
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.username, func(t *testing.T) {
+			notifications := &resetNotifications{}
+			u := &userService{db: users, notifications: notifications}
+
+			err := u.RequestPasswordReset(context.Background(), &model.PasswordResetRequest{Username: tt.username})
+			if err != nil {
+				t.Fatalf("RequestPasswordReset() error = %v, want nil", err)
+			}
+
+			if len(notifications.queued) != len(tt.want) {
+				t.Fatalf("queued %v, want %v", notifications.queued, tt.want)
+			}
+			for i := range tt.want {
+				if notifications.queued[i] != tt.want[i] {
+					t.Errorf("queued %v, want %v", notifications.queued[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,212 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/KEPTANy/plag-check/user-service/internal/model"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	oneTimePasswordLength = 16
+
+	lowerChars  = "abcdefghijkmnopqrstuvwxyz"
+	upperChars  = "ABCDEFGHJKLMNPQRSTUVWXYZ"
+	digitChars  = "23456789"
+	symbolChars = "!@#$%^&*-_=+?"
+)
+
+// ImportRoster creates a student account for every valid roster entry and
+// reports the outcome of each row in input order.
+func (u *userService) ImportRoster(ctx context.Context, entries []model.RosterEntry) (*model.ImportResponse, error) {
+	results := make([]model.ImportResult, len(entries))
+	seen := make(map[string]bool, len(entries))
+
+	var users []*model.User
+	var userRows []int
+	for i, entry := range entries {
+		results[i] = model.ImportResult{Row: entry.Row, Username: entry.Username}
+
+		if reason := validateRosterEntry(&entry); reason != "" {
+			results[i].Status = model.ImportStatusInvalid
+			results[i].Error = reason
+			continue
+		}
+
+		key := strings.ToLower(entry.Username)
+		if seen[key] {
+			results[i].Status = model.ImportStatusDuplicate
+			results[i].Error = "username is repeated in the file"
+			continue
+		}
+		seen[key] = true
+
+		password, err := u.generateOneTimePassword()
+		if err != nil {
+			return nil, err
+		}
+		results[i].OneTimePassword = password
+
+		users = append(users, &model.User{
+			Username:           entry.Username,
+			PasswordHash:       password,
+			Role:               "student",
+			DisplayName:        entry.DisplayName,
+			Email:              entry.Email,
+			MustChangePassword: true,
+		})
+		userRows = append(userRows, i)
+	}
+
+	if err := u.hashPasswords(users); err != nil {
+		return nil, err
+	}
+
+	var rowErrs []error
+	err := u.tx.InTx(ctx, func(ctx context.Context) error {
+		var err error
+		rowErrs, err = u.db.CreateUsers(ctx, users)
+		if err != nil {
+			return err
+		}
+
+		for j, user := range users {
+			if rowErrs[j] != nil {
+				continue
+			}
+			if err := u.publishRegistered(ctx, user, "roster"); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to import roster: %w", err)
+	}
+
+	for j, user := range users {
+		result := &results[userRows[j]]
+		if rowErrs[j] != nil {
+			result.Status = model.ImportStatusDuplicate
+			result.Error = "username or email already exists"
+			result.OneTimePassword = ""
+			continue
+		}
+
+		result.Status = model.ImportStatusCreated
+		result.UserID = user.ID.String()
+	}
+
+	response := &model.ImportResponse{Results: results}
+	for _, result := range results {
+		switch result.Status {
+		case model.ImportStatusCreated:
+			response.Created++
+		case model.ImportStatusDuplicate:
+			response.Duplicate++
+		case model.ImportStatusInvalid:
+			response.Invalid++
+		}
+	}
+
+	return response, nil
+}
+
+func validateRosterEntry(entry *model.RosterEntry) string {
+	entry.Username = strings.TrimSpace(entry.Username)
+	entry.DisplayName = strings.TrimSpace(entry.DisplayName)
+	entry.Email = strings.TrimSpace(entry.Email)
+
+	switch {
+	case entry.Username == "":
+		return "username must not be empty"
+	case len(entry.Username) > 255:
+		return "username is too long"
+	case len(entry.DisplayName) > 255:
+		return "name is too long"
+	case entry.Email != "" && !model.IsValidEmail(entry.Email):
+		return "invalid email"
+	}
+
+	return ""
+}
+
+// hashPasswords replaces the plain text PasswordHash of every user with its
+// bcrypt hash. Hashing is spread over all CPUs since a cohort may contain
+// hundreds of students.
+func (u *userService) hashPasswords(users []*model.User) error {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var firstErr error
+
+	sem := make(chan struct{}, runtime.NumCPU())
+	for _, user := range users {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			hash, err := bcrypt.GenerateFromPassword([]byte(user.PasswordHash), u.bCryptCost)
+			if err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = fmt.Errorf("Failed to hash password: %w", err)
+				}
+				mu.Unlock()
+				return
+			}
+			user.PasswordHash = string(hash)
+		}()
+	}
+	wg.Wait()
+
+	return firstErr
+}
+
+// generateOneTimePassword returns a random password that contains every
+// character class, so it passes any configuration of the password policy.
+func (u *userService) generateOneTimePassword() (string, error) {
+	length := max(oneTimePasswordLength, u.passwordPolicy.MinLength)
+	classes := []string{lowerChars, upperChars, digitChars, symbolChars}
+	all := strings.Join(classes, "")
+
+	password := make([]byte, length)
+	for i := range password {
+		chars := all
+		if i < len(classes) {
+			chars = classes[i]
+		}
+
+		c, err := randomChar(chars)
+		if err != nil {
+			return "", err
+		}
+		password[i] = c
+	}
+
+	// move the guaranteed characters away from the start
+	for i := len(password) - 1; i > 0; i-- {
+		j, err := rand.Int(rand.Reader, big.NewInt(int64(i+1)))
+		if err != nil {
+			return "", fmt.Errorf("Failed to generate password: %w", err)
+		}
+		password[i], password[j.Int64()] = password[j.Int64()], password[i]
+	}
+
+	return string(password), nil
+}
+
+func randomChar(chars string) (byte, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(len(chars))))
+	if err != nil {
+		return 0, fmt.Errorf("Failed to generate password: %w", err)
+	}
+	return chars[n.Int64()], nil
+}
@@ -0,0 +1,57 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/KEPTANy/plag-check/user-service/internal/model"
+)
+
+func TestValidateRosterEntry(t *testing.T) {
+	tests := []struct {
+		entry model.RosterEntry
+		want  string
+	}{
+		{model.RosterEntry{Username: " alice ", Email: " alice@example.com "}, ""},
+		{model.RosterEntry{Username: "  "}, "username must not be empty"},
+		{model.RosterEntry{Username: strings.Repeat("a", 256)}, "username is too long"},
+		{model.RosterEntry{Username: "bob", DisplayName: strings.Repeat("b", 256)}, "name is too long"},
+		{model.RosterEntry{Username: "carol", Email: "carol"}, "invalid email"},
+	}
+
+	for _, tt := range tests {
+		if got := validateRosterEntry(&tt.entry); got != tt.want {
+			t.Errorf("validateRosterEntry(%q) = %q, want %q", tt.entry.Username, got, tt.want)
+		}
+	}
+}
+
+func TestGenerateOneTimePassword(t *testing.T) {
+	// the strictest policy must accept every generated password
+	policy := &PasswordPolicy{
+		MinLength:     20,
+		RequireUpper:  true,
+		RequireLower:  true,
+		RequireDigit:  true,
+		RequireSymbol: true,
+	}
+	u := &userService{passwordPolicy: policy}
+
+	seen := make(map[string]bool)
+	for range 100 {
+		password, err := u.generateOneTimePassword()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(password) != policy.MinLength {
+			t.Fatalf("len(%q) = %d, want %d", password, len(password), policy.MinLength)
+		}
+		if err := policy.Validate(password); err != nil {
+			t.Fatalf("Validate(%q) = %v", password, err)
+		}
+		if seen[password] {
+			t.Fatalf("password %q was generated twice", password)
+		}
+		seen[password] = true
+	}
+}
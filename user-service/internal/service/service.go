@@ -6,34 +6,127 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/KEPTANy/plag-check/shared/apperror"
+	"github.com/KEPTANy/plag-check/shared/audit"
+	"github.com/KEPTANy/plag-check/shared/dbtx"
+	"github.com/KEPTANy/plag-check/shared/events"
 	"github.com/KEPTANy/plag-check/shared/jwt"
 	"github.com/KEPTANy/plag-check/user-service/internal/model"
+	"github.com/KEPTANy/plag-check/user-service/internal/oidc"
 	"github.com/KEPTANy/plag-check/user-service/internal/repository"
+	"github.com/gofrs/uuid/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"golang.org/x/crypto/bcrypt"
 )
 
+var (
+	ErrInvalidCredentials = apperror.Unauthorized("invalid username or password")
+	ErrUserNotFound       = apperror.NotFound("user not found")
+	ErrWrongPassword      = apperror.Forbidden("current password is incorrect")
+	ErrEmailTaken         = apperror.Conflict("email is already in use")
+	ErrUsernameTaken      = apperror.Conflict("username is already taken")
+	ErrAccountConflict    = apperror.Conflict("username or email is already used by a local account")
+)
+
+// AccountLockedError is returned by Login while an account is locked out
+// after too many failed attempts.
+type AccountLockedError struct {
+	Until time.Time
+}
+
+func (e *AccountLockedError) Error() string {
+	return fmt.Sprintf("Account is locked until %s", e.Until.Format(time.RFC3339))
+}
+
+type LockoutPolicy struct {
+	MaxFailedLogins int
+	Duration        time.Duration
+}
+
 type UserService interface {
 	Register(ctx context.Context, req *model.RegisterRequest) error
 	Login(ctx context.Context, req *model.LoginRequest) (*model.LoginResponse, error)
+	GetUser(ctx context.Context, id uuid.UUID) (*model.User, error)
+	UpdateProfile(ctx context.Context, id uuid.UUID, req *model.UpdateProfileRequest) (*model.User, error)
+	ChangePassword(ctx context.Context, id uuid.UUID, req *model.ChangePasswordRequest) error
+	ImportRoster(ctx context.Context, entries []model.RosterEntry) (*model.ImportResponse, error)
+	RequestPasswordReset(ctx context.Context, req *model.PasswordResetRequest) error
+	IssuePasswordResetToken(ctx context.Context, userID uuid.UUID, notificationID int64) (string, time.Time, error)
+	ConfirmPasswordReset(ctx context.Context, req *model.PasswordResetConfirmRequest) error
+	OIDCLogin(ctx context.Context, identity *oidc.Identity, duration time.Duration) (*model.LoginResponse, error)
 }
 
 type userService struct {
-	db         repository.UserRepository
-	jwtSecret  string
-	bCryptCost int
+	db             repository.UserRepository
+	jwtSecret      string
+	bCryptCost     int
+	passwordPolicy *PasswordPolicy
+	lockoutPolicy  LockoutPolicy
+	notifications  repository.NotificationRepository
+	resetTokenTTL  time.Duration
+	audit          *audit.Log
+	tx             dbtx.Transactor
+	publisher      *events.Publisher
+
+	// dummyHash is compared against when the username is unknown, so a
+	// login takes as long as for an existing user
+	dummyHash []byte
 }
 
-func NewUserService(db repository.UserRepository, jwtSecret string, bCryptCost int) UserService {
-	return &userService{db: db, jwtSecret: jwtSecret, bCryptCost: bCryptCost}
+func NewUserService(
+	db repository.UserRepository,
+	jwtSecret string,
+	bCryptCost int,
+	passwordPolicy *PasswordPolicy,
+	lockoutPolicy LockoutPolicy,
+	notifications repository.NotificationRepository,
+	resetTokenTTL time.Duration,
+	auditLog *audit.Log,
+	tx dbtx.Transactor,
+	publisher *events.Publisher,
+) UserService {
+	dummyHash, err := bcrypt.GenerateFromPassword([]byte("dummy password"), bCryptCost)
+	if err != nil {
+		panic(fmt.Sprintf("Failed to generate dummy password hash: %v", err))
+	}
+
+	return &userService{
+		db:             db,
+		jwtSecret:      jwtSecret,
+		bCryptCost:     bCryptCost,
+		passwordPolicy: passwordPolicy,
+		lockoutPolicy:  lockoutPolicy,
+		notifications:  notifications,
+		resetTokenTTL:  resetTokenTTL,
+		audit:          auditLog,
+		tx:             tx,
+		publisher:      publisher,
+		dummyHash:      dummyHash,
+	}
 }
 
 func (u *userService) Register(ctx context.Context, req *model.RegisterRequest) error {
+	if err := u.passwordPolicy.Validate(req.Password); err != nil {
+		return err
+	}
+
 	password_hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), u.bCryptCost)
 	if err != nil {
 		return fmt.Errorf("Failed to hash password: %w", err)
 	}
 
-	_, err = u.db.CreateUser(ctx, req.Username, string(password_hash), req.Role)
+	err = u.tx.InTx(ctx, func(ctx context.Context) error {
+		user, err := u.db.CreateUser(ctx, req.Username, string(password_hash), req.Role)
+		if err != nil {
+			return err
+		}
+		return u.publishRegistered(ctx, user, "register")
+	})
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return ErrUsernameTaken
+	}
 	if err != nil {
 		return fmt.Errorf("Failed to add user to a repository: %w", err)
 	}
@@ -41,20 +134,228 @@ func (u *userService) Register(ctx context.Context, req *model.RegisterRequest)
 	return err
 }
 
+// publishRegistered announces a new user, it is called in the transaction
+// that creates the user.
+func (u *userService) publishRegistered(ctx context.Context, user *model.User, source string) error {
+	return u.publisher.Publish(ctx, events.TopicUserRegistered, events.UserRegistered{
+		UserID:   user.ID,
+		Username: user.Username,
+		Role:     user.Role,
+		Source:   source,
+	})
+}
+
 func (u *userService) Login(ctx context.Context, req *model.LoginRequest) (*model.LoginResponse, error) {
+	user, resp, err := u.login(ctx, req)
+	u.recordLogin(ctx, user, req.Username, "password", err)
+	return resp, err
+}
+
+// login checks the credentials, the user is returned whenever it is known,
+// also for failed attempts.
+func (u *userService) login(ctx context.Context, req *model.LoginRequest) (*model.User, *model.LoginResponse, error) {
 	user, err := u.db.GetUserByUsername(ctx, req.Username)
+	if errors.Is(err, pgx.ErrNoRows) {
+		bcrypt.CompareHashAndPassword(u.dummyHash, []byte(req.Password))
+		return nil, nil, ErrInvalidCredentials
+	}
 	if err != nil {
-		return nil, fmt.Errorf("Failed to find user in the db: %w", err)
+		return nil, nil, fmt.Errorf("Failed to find user in the db: %w", err)
+	}
+
+	if user.LockedUntil != nil && user.LockedUntil.After(time.Now()) {
+		return user, nil, &AccountLockedError{Until: *user.LockedUntil}
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)); err != nil {
-		return nil, errors.New("Invalid password or username")
+		if u.lockoutPolicy.MaxFailedLogins <= 0 {
+			return user, nil, ErrInvalidCredentials
+		}
+
+		lockedUntil, err := u.db.RecordFailedLogin(ctx, user.ID, u.lockoutPolicy.MaxFailedLogins, u.lockoutPolicy.Duration)
+		if err != nil {
+			return user, nil, err
+		}
+
+		if lockedUntil != nil && lockedUntil.After(time.Now()) {
+			return user, nil, &AccountLockedError{Until: *lockedUntil}
+		}
+
+		return user, nil, ErrInvalidCredentials
+	}
+
+	if user.FailedLoginAttempts > 0 || user.LockedUntil != nil {
+		if err := u.db.ResetFailedLogins(ctx, user.ID); err != nil {
+			return user, nil, err
+		}
 	}
 
 	token, err := jwt.GenerateToken(time.Minute*time.Duration(req.DurationMin), user.ID, req.Username, user.Role, u.jwtSecret)
+	if err != nil {
+		return user, nil, fmt.Errorf("Failed to generate jwt token: %w", err)
+	}
+
+	return user, &model.LoginResponse{Token: token, MustChangePassword: user.MustChangePassword}, nil
+}
+
+// recordLogin audits a login decision. Errors that are not about the
+// credentials, e.g. a database failure, decide nothing and are not recorded.
+func (u *userService) recordLogin(ctx context.Context, user *model.User, username, method string, err error) {
+	event := audit.Event{
+		Action:       audit.ActionLogin,
+		ResourceType: "user",
+		Outcome:      audit.OutcomeSuccess,
+		Details:      map[string]any{"username": username, "method": method},
+	}
+	if user != nil {
+		event.ActorID = user.ID
+		event.ActorRole = user.Role
+		event.ResourceID = user.ID.String()
+	}
+
+	var lockedErr *AccountLockedError
+	switch {
+	case err == nil:
+	case errors.As(err, &lockedErr):
+		event.Outcome = audit.OutcomeDenied
+		event.Details["reason"] = "locked"
+	case errors.Is(err, ErrInvalidCredentials):
+		event.Outcome = audit.OutcomeFailure
+		event.Details["reason"] = "invalid_credentials"
+	default:
+		return
+	}
+
+	// a login goes on when the audit log is unavailable, the failure is
+	// logged by Record
+	u.audit.Record(ctx, event)
+}
+
+func (u *userService) GetUser(ctx context.Context, id uuid.UUID) (*model.User, error) {
+	user, err := u.db.GetUserByID(ctx, id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to find user in the db: %w", err)
+	}
+
+	return user, nil
+}
+
+func (u *userService) UpdateProfile(ctx context.Context, id uuid.UUID, req *model.UpdateProfileRequest) (*model.User, error) {
+	user, err := u.db.UpdateProfile(ctx, id, req.DisplayName, req.Email)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return nil, ErrEmailTaken
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to update user profile: %w", err)
+	}
+
+	return user, nil
+}
+
+func (u *userService) ChangePassword(ctx context.Context, id uuid.UUID, req *model.ChangePasswordRequest) error {
+	user, err := u.GetUser(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if user.LockedUntil != nil && user.LockedUntil.After(time.Now()) {
+		return &AccountLockedError{Until: *user.LockedUntil}
+	}
+
+	// wrong current passwords count towards the lockout like failed logins,
+	// so a stolen token can not be used to guess the password
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.CurrentPassword)); err != nil {
+		if u.lockoutPolicy.MaxFailedLogins <= 0 {
+			return ErrWrongPassword
+		}
+
+		lockedUntil, err := u.db.RecordFailedLogin(ctx, user.ID, u.lockoutPolicy.MaxFailedLogins, u.lockoutPolicy.Duration)
+		if err != nil {
+			return err
+		}
+		if lockedUntil != nil && lockedUntil.After(time.Now()) {
+			return &AccountLockedError{Until: *lockedUntil}
+		}
+		return ErrWrongPassword
+	}
+
+	if err := u.passwordPolicy.Validate(req.NewPassword); err != nil {
+		return err
+	}
+
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), u.bCryptCost)
+	if err != nil {
+		return fmt.Errorf("Failed to hash password: %w", err)
+	}
+
+	if err := u.db.UpdatePassword(ctx, id, string(passwordHash)); err != nil {
+		return fmt.Errorf("Failed to update password: %w", err)
+	}
+
+	return nil
+}
+
+// OIDCLogin finds or creates the local user linked to the provider identity,
+// syncs its role and profile from the claims and issues a regular token.
+func (u *userService) OIDCLogin(ctx context.Context, identity *oidc.Identity, duration time.Duration) (*model.LoginResponse, error) {
+	user, err := u.db.GetUserByOIDCSubject(ctx, identity.Issuer, identity.Subject)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		err = u.tx.InTx(ctx, func(ctx context.Context) error {
+			user, err = u.db.CreateOIDCUser(ctx, identity.Issuer, identity.Subject, &model.User{
+				Username:    identity.Username,
+				Role:        identity.Role,
+				DisplayName: identity.DisplayName,
+				Email:       identity.Email,
+			})
+			if err != nil {
+				return err
+			}
+			return u.publishRegistered(ctx, user, "oidc")
+		})
+	case err == nil:
+		previousRole := user.Role
+		user, err = u.db.SyncOIDCUser(ctx, user.ID, identity.Role, identity.DisplayName, identity.Email)
+		if err == nil && user.Role != previousRole {
+			u.audit.Record(ctx, audit.Event{
+				ActorID:      user.ID,
+				ActorRole:    user.Role,
+				Action:       audit.ActionRoleChange,
+				ResourceType: "user",
+				ResourceID:   user.ID.String(),
+				Outcome:      audit.OutcomeSuccess,
+				Details: map[string]any{
+					"from":   previousRole,
+					"to":     user.Role,
+					"source": "oidc",
+				},
+			})
+		}
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return nil, ErrAccountConflict
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to map OIDC identity to a user: %w", err)
+	}
+
+	token, err := jwt.GenerateToken(duration, user.ID, user.Username, user.Role, u.jwtSecret)
 	if err != nil {
 		return nil, fmt.Errorf("Failed to generate jwt token: %w", err)
 	}
 
+	u.recordLogin(ctx, user, user.Username, "oidc", nil)
+
 	return &model.LoginResponse{Token: token}, nil
 }
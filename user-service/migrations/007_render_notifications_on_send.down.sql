@@ -0,0 +1,8 @@
+ALTER TABLE password_reset_tokens DROP COLUMN IF EXISTS notification_id;
+
+DROP INDEX IF EXISTS notification_outbox_pending_idx;
+ALTER TABLE notification_outbox DROP COLUMN IF EXISTS last_error;
+ALTER TABLE notification_outbox DROP COLUMN IF EXISTS next_attempt_at;
+ALTER TABLE notification_outbox DROP COLUMN IF EXISTS attempts;
+ALTER TABLE notification_outbox DROP COLUMN IF EXISTS status;
+ALTER TABLE notification_outbox ADD COLUMN IF NOT EXISTS body TEXT NOT NULL DEFAULT '';
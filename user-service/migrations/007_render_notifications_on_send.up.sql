@@ -0,0 +1,14 @@
+-- messages used to carry reset tokens in plain text, they are removed and
+-- the tokens revoked; messages are now rendered when they are sent
+UPDATE password_reset_tokens SET used_at = NOW() WHERE used_at IS NULL;
+DELETE FROM notification_outbox WHERE kind = 'password_reset';
+
+ALTER TABLE notification_outbox DROP COLUMN IF EXISTS body;
+ALTER TABLE notification_outbox ADD COLUMN IF NOT EXISTS status VARCHAR(20) NOT NULL DEFAULT 'pending';
+ALTER TABLE notification_outbox ADD COLUMN IF NOT EXISTS attempts INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE notification_outbox ADD COLUMN IF NOT EXISTS next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+ALTER TABLE notification_outbox ADD COLUMN IF NOT EXISTS last_error TEXT;
+UPDATE notification_outbox SET status = 'sent' WHERE sent_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS notification_outbox_pending_idx ON notification_outbox (next_attempt_at) WHERE status = 'pending';
+
+ALTER TABLE password_reset_tokens ADD COLUMN IF NOT EXISTS notification_id INTEGER REFERENCES notification_outbox (id) ON DELETE SET NULL;